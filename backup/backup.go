@@ -0,0 +1,219 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/logging"
+)
+
+const (
+	filePrefix     = "berrycms-"
+	fileSuffix     = ".db"
+	fileTimeLayout = "20060102-150405"
+)
+
+//Settings where backups are kept, how often they're taken and how many of them are kept
+type Settings struct {
+	Dir      string
+	Interval time.Duration
+	//KeepDaily number of days to keep the newest backup of
+	KeepDaily int
+	//KeepWeekly number of weeks to keep the newest backup of
+	KeepWeekly int
+}
+
+//DefaultSettings backups are taken daily, with a week of daily and a month of weekly backups kept
+var DefaultSettings = Settings{
+	Dir:        "backups",
+	Interval:   time.Hour * 24,
+	KeepDaily:  7,
+	KeepWeekly: 4,
+}
+
+var settings = DefaultSettings
+
+//only one backup should ever be written at a time, scheduled and requested ones could otherwise overlap
+var backupLock sync.Mutex
+
+//Configure checks that the settings make sense before using them
+func Configure(s Settings) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	settings = s
+	return nil
+}
+
+//Validate checks that the settings make sense
+func (s Settings) Validate() error {
+	if len(s.Dir) == 0 {
+		return fmt.Errorf("Backup directory can't be blank")
+	}
+
+	if s.Interval < 0 {
+		return fmt.Errorf("Backup interval can't be negative")
+	}
+
+	if s.KeepDaily < 0 || s.KeepWeekly < 0 {
+		return fmt.Errorf("Number of backups to keep can't be negative")
+	}
+
+	if s.KeepDaily == 0 && s.KeepWeekly == 0 {
+		return fmt.Errorf("At least one daily or weekly backup has to be kept")
+	}
+
+	return nil
+}
+
+//Current the settings backups are being taken with
+func Current() Settings {
+	return settings
+}
+
+//Create backs up the database into the backup directory, returning the location of the new backup
+func Create() (string, error) {
+	backupLock.Lock()
+	defer backupLock.Unlock()
+
+	if err := os.MkdirAll(settings.Dir, 0700); err != nil {
+		return "", err
+	}
+
+	fileName := filepath.Join(settings.Dir, filePrefix+time.Now().Format(fileTimeLayout)+fileSuffix)
+	//backups requested within the same second as the last one would share its name
+	if _, err := os.Stat(fileName); err == nil {
+		return fileName, nil
+	}
+
+	logging.Info(fmt.Sprintf("Backing up database to %s...", fileName))
+	if err := db.Backup(db.Conn, fileName); err != nil {
+		return "", err
+	}
+
+	return fileName, nil
+}
+
+//Prune removes the backups which are no longer needed to keep the configured daily and weekly ones
+func Prune() error {
+	backupLock.Lock()
+	defer backupLock.Unlock()
+
+	files, err := ioutil.ReadDir(settings.Dir)
+	if err != nil {
+		return err
+	}
+
+	backups := map[time.Time]string{}
+	taken := []time.Time{}
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, filePrefix) || !strings.HasSuffix(name, fileSuffix) {
+			continue
+		}
+
+		//anything else in the directory which doesn't look like one of ours is left alone
+		t, err := time.ParseInLocation(fileTimeLayout, strings.TrimSuffix(strings.TrimPrefix(name, filePrefix), fileSuffix), time.Local)
+		if err != nil {
+			continue
+		}
+
+		backups[t] = filepath.Join(settings.Dir, name)
+		taken = append(taken, t)
+	}
+
+	keep := retained(taken, settings.KeepDaily, settings.KeepWeekly)
+	for _, t := range taken {
+		if keep[t] {
+			continue
+		}
+		logging.Debug(fmt.Sprintf("Removing old backup %s", backups[t]))
+		if err := os.Remove(backups[t]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//retained works out which backups to keep, the newest of each of the latest days and weeks which have any
+func retained(taken []time.Time, keepDaily int, keepWeekly int) map[time.Time]bool {
+	newestFirst := make([]time.Time, len(taken))
+	copy(newestFirst, taken)
+	sort.Slice(newestFirst, func(i, j int) bool { return newestFirst[i].After(newestFirst[j]) })
+
+	keep := map[time.Time]bool{}
+	days := map[string]bool{}
+	weeks := map[string]bool{}
+
+	for _, t := range newestFirst {
+		day := t.Format("2006-01-02")
+		if !days[day] && len(days) < keepDaily {
+			days[day] = true
+			keep[t] = true
+		}
+
+		year, week := t.ISOWeek()
+		weekKey := fmt.Sprintf("%d-%d", year, week)
+		if !weeks[weekKey] && len(weeks) < keepWeekly {
+			weeks[weekKey] = true
+			keep[t] = true
+		}
+	}
+
+	return keep
+}
+
+//Schedule takes a backup and prunes the old ones at every interval, until the context is cancelled
+func Schedule(ctx context.Context) {
+	if settings.Interval == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(settings.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := Create(); err != nil {
+				logging.Error(fmt.Sprintf("Error backing up database -> %s", err.Error()))
+				continue
+			}
+
+			if err := Prune(); err != nil {
+				logging.Error(fmt.Sprintf("Error removing old backups -> %s", err.Error()))
+			}
+		}
+	}
+}
+
+//Enabled whether backups can be taken of the connected database
+func Enabled() bool {
+	return db.Type == db.SQLITE
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetained(t *testing.T) {
+	//two backups a day for three whole weeks, starting on a Monday
+	start := time.Date(2019, 5, 27, 1, 0, 0, 0, time.Local)
+	taken := []time.Time{}
+	for day := 0; day < 21; day++ {
+		taken = append(taken, start.AddDate(0, 0, day), start.AddDate(0, 0, day).Add(time.Hour*12))
+	}
+
+	keep := retained(taken, 3, 2)
+
+	expected := []time.Time{
+		time.Date(2019, 6, 16, 13, 0, 0, 0, time.Local),
+		time.Date(2019, 6, 15, 13, 0, 0, 0, time.Local),
+		time.Date(2019, 6, 14, 13, 0, 0, 0, time.Local),
+		time.Date(2019, 6, 9, 13, 0, 0, 0, time.Local),
+	}
+
+	if len(keep) != len(expected) {
+		t.Errorf("Expected to keep %d backups, keeping %d: %v", len(expected), len(keep), keep)
+	}
+
+	for _, e := range expected {
+		if !keep[e] {
+			t.Errorf("Backup taken at %v should be kept", e)
+		}
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	defer func() { settings = DefaultSettings }()
+
+	for _, s := range []Settings{
+		{Dir: "", Interval: time.Hour, KeepDaily: 1},
+		{Dir: "backups", Interval: -time.Hour, KeepDaily: 1},
+		{Dir: "backups", Interval: time.Hour, KeepDaily: -1, KeepWeekly: 1},
+		{Dir: "backups", Interval: time.Hour},
+	} {
+		if err := Configure(s); err == nil {
+			t.Errorf("Settings %v should be refused", s)
+		}
+	}
+
+	if err := Configure(Settings{Dir: "backups", KeepWeekly: 1}); err != nil {
+		t.Errorf("Settings without scheduled backups should be accepted: %v", err)
+	}
+}
@@ -0,0 +1,639 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/util"
+	"github.com/tacusci/logging"
+)
+
+//command an operational task, the server itself is started by the serve command
+type command struct {
+	name        string
+	args        string
+	description string
+	run         func(opts *options, args []string) error
+}
+
+//commands every command, the server is started if none is given
+func commands() []command {
+	return []command{
+		{"serve", "", "Start the web server", serve},
+		{"config print", "", "Show the effective configuration with secrets redacted", configPrint},
+		{"migrate", "[version]", "Migrate the database schema up or down to the given version, the latest if none is given", migrate},
+		{"wipe", "[-table name,...] [-testdata]", "Drop and recreate every table, or just the named ones", wipe},
+		{"export", "<file>", "Export users, groups and pages to a new archive file", exportCommand},
+		{"import", "<file>", "Replace users, groups and pages with those in the archive file", importCommand},
+		{"user create", "-username name -email address [-firstname name] [-lastname name] [-role root|moderator|regular] [-group title]", "Create a user, the password is read from the terminal or stdin", userCreate},
+		{"user passwd", "<username> [-disable2fa]", "Set a user's password, unlock their account and sign them out everywhere", userPasswd},
+		{"user list", "", "List every user", userList},
+		{"user delete", "<username>", "Delete a user who isn't the author of any pages", userDelete},
+		{"group add-member", "<group> <username>", "Add a user to a group", groupAddMember},
+		{"page export", "[file]", "Export every page as JSON to the file, or stdout", pageExport},
+		{"page import", "<file> [-author username]", "Create or update pages from a JSON page export", pageImport},
+	}
+}
+
+//findCommand matches the longest command name at the start of the arguments, returning the arguments after it
+func findCommand(args []string) (*command, []string) {
+	if len(args) == 0 {
+		args = []string{"serve"}
+	}
+
+	var found *command
+	var foundWords int
+	for _, cmd := range commands() {
+		words := strings.Fields(cmd.name)
+		if len(words) <= foundWords || len(words) > len(args) {
+			continue
+		}
+
+		if strings.Join(args[:len(words)], " ") == cmd.name {
+			c := cmd
+			found, foundWords = &c, len(words)
+		}
+	}
+
+	if found == nil {
+		return nil, nil
+	}
+	return found, args[foundWords:]
+}
+
+//printUsage lists the commands and then the flags which apply to all of them
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s [flags] [command]\n\nCommands:\n", os.Args[0])
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands() {
+		fmt.Fprintf(tw, "  %s %s\t%s\n", cmd.name, cmd.args, cmd.description)
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "\nFlags:\n")
+	flag.CommandLine.SetOutput(w)
+	flag.PrintDefaults()
+}
+
+//parseCommandFlags parses the command's own flags, which can come before or after its positional arguments
+func parseCommandFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	fs.SetOutput(os.Stderr)
+
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+//expectArgs checks that exactly the named positional arguments were given
+func expectArgs(args []string, names ...string) error {
+	if len(args) != len(names) {
+		return fmt.Errorf("Expected arguments %s, got %q", strings.Join(names, " "), args)
+	}
+	return nil
+}
+
+func configPrint(opts *options, args []string) error {
+	if err := expectArgs(args); err != nil {
+		return err
+	}
+
+	printConfig(os.Stdout, flag.CommandLine, opts)
+	return nil
+}
+
+func migrate(opts *options, args []string) error {
+	if len(args) > 1 {
+		return expectArgs(args, "[version]")
+	}
+
+	if err := connectDB(opts); err != nil {
+		return err
+	}
+	defer db.Close()
+	db.Setup()
+
+	version := db.LatestSchemaVersion()
+	if len(args) == 1 {
+		var err error
+		if version, err = strconv.Atoi(args[0]); err != nil {
+			return fmt.Errorf("Schema version %s isn't a number", args[0])
+		}
+	}
+
+	if err := db.MigrateTo(db.Conn, version); err != nil {
+		return err
+	}
+
+	logging.Info(fmt.Sprintf("Database schema at version %d", version))
+	return nil
+}
+
+func wipe(opts *options, args []string) error {
+	fs := flag.NewFlagSet("wipe", flag.ContinueOnError)
+	tables := fs.String("table", "", "Comma separated tables to wipe instead of the whole database")
+	testData := fs.Bool("testdata", false, "Create testing data after wiping the whole database")
+	args, err := parseCommandFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if err := expectArgs(args); err != nil {
+		return err
+	}
+
+	if len(*tables) > 0 && *testData {
+		return errors.New("Testing data can only be created after wiping the whole database")
+	}
+
+	//if yes to all flag is was used, user won't be prompted
+	//to confirm as if statement won't continue evaluating
+	//conditions eg., the bool val returned by 'askConfirmToWipe'
+	//so it'll never be called
+	if !opts.yesToAll && !askConfirmToWipe() {
+		logging.Info("Skipping wiping database...")
+		return nil
+	}
+
+	if err := connectDB(opts); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if len(*tables) > 0 {
+		err = db.WipeTables(strings.Split(*tables, ",")...)
+	} else {
+		err = db.Wipe()
+	}
+	if err != nil {
+		return err
+	}
+
+	db.Setup()
+	if err := db.Migrate(db.Conn); err != nil {
+		return err
+	}
+
+	if *testData {
+		db.CreateTestData()
+	}
+	return nil
+}
+
+func exportCommand(opts *options, args []string) error {
+	if err := expectArgs(args, "<file>"); err != nil {
+		return err
+	}
+
+	if err := connectMigratedDB(opts); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := exportArchive(args[0]); err != nil {
+		return fmt.Errorf("Error exporting database: %s", err.Error())
+	}
+
+	logging.Info(fmt.Sprintf("Exported database to %s", args[0]))
+	return nil
+}
+
+func importCommand(opts *options, args []string) error {
+	if err := expectArgs(args, "<file>"); err != nil {
+		return err
+	}
+
+	if !opts.yesToAll && !askConfirm("⚠ Importing replaces all existing users, groups and pages, are you sure? ⚠ ") {
+		logging.Info("Skipping importing database...")
+		return nil
+	}
+
+	if err := connectMigratedDB(opts); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := importArchive(args[0]); err != nil {
+		return fmt.Errorf("Error importing database: %s", err.Error())
+	}
+
+	logging.Info(fmt.Sprintf("Imported database from %s", args[0]))
+	return nil
+}
+
+//userRoles names the roles users can be created with
+var userRoles = map[string]db.UsersRoleFlag{
+	"root":      db.ROOT_USER,
+	"moderator": db.MOD_USER,
+	"regular":   db.REG_USER,
+	"member":    db.MEMBER_USER,
+}
+
+func userCreate(opts *options, args []string) error {
+	fs := flag.NewFlagSet("user create", flag.ContinueOnError)
+	u := &db.User{}
+	fs.StringVar(&u.Username, "username", "", "Username to log in with")
+	fs.StringVar(&u.Email, "email", "", "Email address")
+	fs.StringVar(&u.FirstName, "firstname", "", "First name")
+	fs.StringVar(&u.LastName, "lastname", "", "Last name")
+	roleName := fs.String("role", "regular", "Role of the user [root/moderator/regular/member]")
+	groupTitle := fs.String("group", "", "Group to add the user to, root users are always added to Admins")
+	args, err := parseCommandFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if err := expectArgs(args); err != nil {
+		return err
+	}
+
+	if len(u.Username) == 0 || len(u.Email) == 0 {
+		return errors.New("Username and email must be given")
+	}
+
+	role, ok := userRoles[*roleName]
+	if !ok {
+		return fmt.Errorf("Unknown role %s, roles are root, moderator and regular", *roleName)
+	}
+	u.UserroleId = int(role)
+
+	if err := connectMigratedDB(opts); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	password, err := readNewPassword()
+	if err != nil {
+		return err
+	}
+	u.AuthHash = util.HashAndSalt([]byte(password))
+	u.CreatedDateTime = time.Now().Unix()
+
+	groups := []string{}
+	if role == db.ROOT_USER {
+		groups = append(groups, "Admins")
+	}
+	if len(*groupTitle) > 0 && *groupTitle != "Admins" {
+		groups = append(groups, *groupTitle)
+	}
+
+	err = db.WithTransaction(db.Conn, func(tx *sql.Tx) error {
+		ut := db.UsersTable{}
+		if err := ut.Insert(tx, u); err != nil {
+			return err
+		}
+
+		for _, title := range groups {
+			if err := addMember(tx, title, u); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created user %s\n", u.Username)
+	return nil
+}
+
+func userPasswd(opts *options, args []string) error {
+	fs := flag.NewFlagSet("user passwd", flag.ContinueOnError)
+	disableTwoFactor := fs.Bool("disable2fa", false, "Also turn off two factor authentication for the user")
+	args, err := parseCommandFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if err := expectArgs(args, "<username>"); err != nil {
+		return err
+	}
+
+	if err := connectMigratedDB(opts); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	u, err := selectUser(db.Conn, args[0])
+	if err != nil {
+		return err
+	}
+
+	password, err := readNewPassword()
+	if err != nil {
+		return err
+	}
+
+	err = db.WithTransaction(db.Conn, func(tx *sql.Tx) error {
+		ut := db.UsersTable{}
+		if err := ut.ResetPassword(tx, u, util.HashAndSalt([]byte(password)), "", time.Now().Unix()); err != nil {
+			return err
+		}
+
+		if *disableTwoFactor {
+			utft := db.UserTwoFactorTable{}
+			if _, err := utft.DeleteByUserUUID(tx, u.UUID); err != nil {
+				return err
+			}
+
+			rct := db.RecoveryCodesTable{}
+			if _, err := rct.DeleteByUserUUID(tx, u.UUID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Changed password of user %s\n", u.Username)
+	return nil
+}
+
+func userList(opts *options, args []string) error {
+	if err := expectArgs(args); err != nil {
+		return err
+	}
+
+	if err := connectMigratedDB(opts); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var users []db.User
+	if err := db.Find(db.Conn, db.From(&db.UsersTable{}).OrderBy("username", db.Ascending), &users); err != nil {
+		return err
+	}
+
+	roleNames := map[db.UsersRoleFlag]string{}
+	for name, role := range userRoles {
+		roleNames[role] = name
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "USERNAME\tROLE\tNAME\tEMAIL\tCREATED")
+	for _, u := range users {
+		created := time.Unix(u.CreatedDateTime, 0).Format("2006-01-02 15:04")
+		fmt.Fprintf(tw, "%s\t%s\t%s %s\t%s\t%s\n", u.Username, roleNames[db.UsersRoleFlag(u.UserroleId)], u.FirstName, u.LastName, u.Email, created)
+	}
+	return tw.Flush()
+}
+
+func userDelete(opts *options, args []string) error {
+	if err := expectArgs(args, "<username>"); err != nil {
+		return err
+	}
+
+	if err := connectMigratedDB(opts); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	u, err := selectUser(db.Conn, args[0])
+	if err != nil {
+		return err
+	}
+
+	if db.UsersRoleFlag(u.UserroleId) == db.ROOT_USER {
+		return fmt.Errorf("User %s is the root user and can't be deleted", u.Username)
+	}
+
+	pagesAuthored, err := db.From(&db.PagesTable{}).Where(db.Equal("authoruuid", u.UUID)).Count(db.Conn)
+	if err != nil {
+		return err
+	}
+
+	if pagesAuthored > 0 {
+		return fmt.Errorf("User %s is the author of %d pages", u.Username, pagesAuthored)
+	}
+
+	if !opts.yesToAll && !askConfirm(fmt.Sprintf("⚠ Deleting user %s is irreversible, are you sure? ⚠ ", u.Username)) {
+		logging.Info("Skipping deleting user...")
+		return nil
+	}
+
+	ut := db.UsersTable{}
+	if err := db.WithTransaction(db.Conn, func(tx *sql.Tx) error {
+		return ut.DeleteWithDependents(tx, u)
+	}); err != nil {
+		return err
+	}
+
+	fmt.Printf("Deleted user %s\n", u.Username)
+	return nil
+}
+
+func groupAddMember(opts *options, args []string) error {
+	if err := expectArgs(args, "<group>", "<username>"); err != nil {
+		return err
+	}
+
+	if err := connectMigratedDB(opts); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	u, err := selectUser(db.Conn, args[1])
+	if err != nil {
+		return err
+	}
+
+	if err := addMember(db.Conn, args[0], u); err != nil {
+		return err
+	}
+
+	fmt.Printf("Added user %s to group %s\n", u.Username, args[0])
+	return nil
+}
+
+func pageExport(opts *options, args []string) error {
+	if len(args) > 1 {
+		return expectArgs(args, "[file]")
+	}
+
+	if err := connectMigratedDB(opts); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if len(args) == 0 || args[0] == "-" {
+		return db.ExportPages(db.Conn, os.Stdout)
+	}
+
+	file, err := os.OpenFile(args[0], os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	if err := db.ExportPages(db.Conn, file); err != nil {
+		file.Close()
+		os.Remove(args[0])
+		return err
+	}
+
+	return file.Close()
+}
+
+func pageImport(opts *options, args []string) error {
+	fs := flag.NewFlagSet("page import", flag.ContinueOnError)
+	authorName := fs.String("author", "", "Username to record the changes against, the root user if not given")
+	args, err := parseCommandFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if err := expectArgs(args, "<file>"); err != nil {
+		return err
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := connectMigratedDB(opts); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var author *db.User
+	if len(*authorName) > 0 {
+		author, err = selectUser(db.Conn, *authorName)
+	} else {
+		ut := db.UsersTable{}
+		author, err = ut.SelectRootUser(db.Conn)
+		if err == nil && len(author.UUID) == 0 {
+			err = errors.New("There's no root user to import pages as, give an author")
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	imported, err := db.ImportPages(db.Conn, file, author.UUID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported %d pages\n", imported)
+	return nil
+}
+
+//selectUser finds the user with the username, it's an error for there not to be one
+func selectUser(q db.Querier, username string) (*db.User, error) {
+	ut := db.UsersTable{}
+	u, err := ut.SelectByUsername(q, username)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(u.UUID) == 0 {
+		return nil, fmt.Errorf("There's no user %s", username)
+	}
+	return u, nil
+}
+
+//addMember adds the user to the group, unless they're already a member
+func addMember(q db.Querier, groupTitle string, u *db.User) error {
+	gt := db.GroupTable{}
+	g, err := gt.SelectByTitle(q, groupTitle)
+	if err != nil {
+		return err
+	}
+
+	if len(g.UUID) == 0 {
+		return fmt.Errorf("There's no group %s", groupTitle)
+	}
+
+	gmt := db.GroupMembershipTable{}
+	groupUUIDs, err := gmt.SelectGroupUUIDsByUserUUID(q, u.UUID)
+	if err != nil {
+		return err
+	}
+
+	for _, groupUUID := range groupUUIDs {
+		if groupUUID == g.UUID {
+			return nil
+		}
+	}
+
+	return gmt.AddUserToGroup(q, u, groupTitle)
+}
+
+//readNewPassword asks for the password twice if stdin is a terminal, so it can't be mistyped, otherwise
+//a single line is read so the password can be piped in by scripts
+func readNewPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+
+		password := strings.TrimRight(line, "\r\n")
+		if len(password) == 0 {
+			return "", errors.New("No password was given on stdin")
+		}
+		return password, nil
+	}
+
+	fmt.Print("Password: ")
+	password, err := terminal.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Print("Repeat password: ")
+	repeated, err := terminal.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+
+	if len(password) == 0 {
+		return "", errors.New("Password can't be blank")
+	}
+
+	if string(password) != string(repeated) {
+		return "", errors.New("Passwords don't match")
+	}
+	return string(password), nil
+}
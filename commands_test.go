@@ -0,0 +1,63 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestFindCommand(t *testing.T) {
+	for _, test := range []struct {
+		args         []string
+		expectedName string
+		expectedArgs []string
+	}{
+		{nil, "serve", []string{}},
+		{[]string{"user", "passwd", "root", "-disable2fa"}, "user passwd", []string{"root", "-disable2fa"}},
+		{[]string{"page", "export"}, "page export", []string{}},
+		{[]string{"migrate", "3"}, "migrate", []string{"3"}},
+	} {
+		cmd, args := findCommand(test.args)
+		if cmd == nil || cmd.name != test.expectedName {
+			t.Errorf("Arguments %v should run command %s, got %v", test.args, test.expectedName, cmd)
+			continue
+		}
+
+		if !reflect.DeepEqual(args, test.expectedArgs) {
+			t.Errorf("Arguments %v should leave %v for the command, got %v", test.args, test.expectedArgs, args)
+		}
+	}
+
+	for _, args := range [][]string{{"user"}, {"user", "explode"}, {"nonsense"}} {
+		if cmd, _ := findCommand(args); cmd != nil {
+			t.Errorf("Arguments %v shouldn't match a command, got %s", args, cmd.name)
+		}
+	}
+}
+
+func TestParseCommandFlags(t *testing.T) {
+	fs := flag.NewFlagSet("page import", flag.ContinueOnError)
+	author := fs.String("author", "", "")
+	args, err := parseCommandFlags(fs, []string{"pages.json", "-author", "bob"})
+	if err != nil {
+		t.Fatalf("Unable to parse command flags: %v", err)
+	}
+
+	if *author != "bob" || !reflect.DeepEqual(args, []string{"pages.json"}) {
+		t.Errorf("Flags after positional arguments should be parsed, got author %q and arguments %v", *author, args)
+	}
+}
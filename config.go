@@ -0,0 +1,271 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+//configSetting a setting which can be given in the config file, as an environment variable or as a flag
+type configSetting struct {
+	key    string
+	env    string
+	flag   string
+	secret bool
+}
+
+//configSettings every setting which can be configured, one off actions such as wiping the database are flags only
+var configSettings = []configSetting{
+	{key: "server.address", env: "BERRY_ADDR", flag: "a"},
+	{key: "server.port", env: "BERRY_PORT", flag: "p"},
+	{key: "server.autocert", env: "BERRY_AUTOCERT", flag: "autocert"},
+	{key: "db.type", env: "BERRY_DB", flag: "db"},
+	{key: "db.user", env: "BERRY_DB_USER", flag: "dbuser"},
+	{key: "db.password", env: "BERRY_DB_PASS", flag: "dbpass", secret: true},
+	{key: "db.address", env: "BERRY_DB_ADDR", flag: "dbaddr"},
+	{key: "db.sslmode", env: "BERRY_DB_SSLMODE", flag: "dbsslmode"},
+	{key: "admin.disabled", env: "BERRY_ADMIN_DISABLED", flag: "apd"},
+	{key: "admin.hiddenprefix", env: "BERRY_ADMIN_HIDDEN_PREFIX", flag: "ahp", secret: true},
+	{key: "site.norobots", env: "BERRY_NO_ROBOTS", flag: "nrtxt"},
+	{key: "site.nositemap", env: "BERRY_NO_SITEMAP", flag: "nsxml"},
+	{key: "session.idle", env: "BERRY_SESSION_IDLE", flag: "sessionidle"},
+	{key: "session.maxage", env: "BERRY_SESSION_MAX", flag: "sessionmax"},
+	{key: "session.remembermaxage", env: "BERRY_REMEMBER_MAX", flag: "remembermax"},
+	{key: "backup.dir", env: "BERRY_BACKUP_DIR", flag: "backupdir"},
+	{key: "backup.interval", env: "BERRY_BACKUP_INTERVAL", flag: "backupinterval"},
+	{key: "backup.daily", env: "BERRY_BACKUP_DAILY", flag: "backupdaily"},
+	{key: "backup.weekly", env: "BERRY_BACKUP_WEEKLY", flag: "backupweekly"},
+	{key: "mail.transport", env: "BERRY_MAIL_TRANSPORT", flag: "mailtransport"},
+	{key: "mail.from", env: "BERRY_MAIL_FROM", flag: "mailfrom"},
+	{key: "mail.smtpaddress", env: "BERRY_SMTP_ADDR", flag: "smtpaddr"},
+	{key: "mail.smtpuser", env: "BERRY_SMTP_USER", flag: "smtpuser"},
+	{key: "mail.smtppassword", env: "BERRY_SMTP_PASS", flag: "smtppass", secret: true},
+	{key: "mail.sendmail", env: "BERRY_SENDMAIL", flag: "sendmail"},
+	{key: "mail.dir", env: "BERRY_MAIL_DIR", flag: "maildir"},
+	{key: "log.file", env: "BERRY_LOG", flag: "log"},
+	{key: "log.activity", env: "BERRY_ACTIVITY_LOG", flag: "actlog"},
+	{key: "log.debug", env: "BERRY_DEBUG", flag: "dbg"},
+	{key: "log.cpuprofile", env: "BERRY_CPU_PROFILE", flag: "cpuprofile"},
+}
+
+//configFileEnv environment variable the config file can be given in instead of the -config flag
+const configFileEnv = "BERRY_CONFIG"
+
+//loadConfig fills in the settings which weren't given as flags, first from the environment and then from
+//the config file, so flags take precedence over environment variables which take precedence over the file.
+//Where each setting came from is recorded, and every problem found is returned rather than just the first
+func (opts *options) loadConfig(fs *flag.FlagSet, lookupEnv func(string) (string, bool)) []string {
+	var problems []string
+
+	opts.configSources = map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		opts.configSources[f.Name] = fmt.Sprintf("flag -%s", f.Name)
+	})
+
+	if len(opts.configFile) == 0 {
+		opts.configFile, _ = lookupEnv(configFileEnv)
+	}
+
+	fileValues := map[string]interface{}{}
+	if len(opts.configFile) > 0 {
+		values, err := readConfigFile(opts.configFile)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("Unable to read config file %s: %s", opts.configFile, err.Error()))
+		} else {
+			fileValues = values
+		}
+	}
+
+	set := func(cs configSetting, value string, source string) {
+		previous := fs.Lookup(cs.flag).Value.String()
+		if err := fs.Set(cs.flag, value); err != nil {
+			//a value which fails to parse can still overwrite the previous one
+			fs.Set(cs.flag, previous)
+			problems = append(problems, fmt.Sprintf("Invalid value %q given by %s", value, source))
+			return
+		}
+		opts.configSources[cs.flag] = source
+	}
+
+	for _, cs := range configSettings {
+		if _, given := opts.configSources[cs.flag]; given {
+			continue
+		}
+
+		if value, ok := lookupEnv(cs.env); ok {
+			set(cs, value, fmt.Sprintf("environment variable %s", cs.env))
+			continue
+		}
+
+		if value, ok := fileValues[cs.key]; ok {
+			set(cs, fmt.Sprint(value), fmt.Sprintf("config file key %s", cs.key))
+		}
+	}
+
+	var unknownKeys []string
+	for key := range fileValues {
+		if _, ok := configSettingByKey(key); !ok {
+			unknownKeys = append(unknownKeys, key)
+		}
+	}
+	sort.Strings(unknownKeys)
+	for _, key := range unknownKeys {
+		problems = append(problems, fmt.Sprintf("Config file key %s isn't a known setting", key))
+	}
+
+	return problems
+}
+
+//validate checks every option which can be configured and reports all of the invalid ones
+func (opts *options) validate() []string {
+	var problems []string
+
+	if opts.port == 0 || opts.port > 65535 {
+		problems = append(problems, fmt.Sprintf("Port %d must be between 1 and 65535", opts.port))
+	}
+
+	if net.ParseIP(opts.addr) == nil {
+		problems = append(problems, fmt.Sprintf("Address %s isn't an IP address", opts.addr))
+	}
+
+	switch opts.sql {
+	case "sqlite", "mysql":
+	case "postgres":
+		switch opts.sqlSSLMode {
+		case "disable", "require", "verify-ca", "verify-full":
+		default:
+			problems = append(problems, fmt.Sprintf("Unknown Postgres SSL mode %s", opts.sqlSSLMode))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("Unknown database server type %s", opts.sql))
+	}
+
+	for name, timeout := range map[string]time.Duration{
+		"idle":             opts.sessionTimeouts.Idle,
+		"maximum age":      opts.sessionTimeouts.MaxAge,
+		"remember maximum": opts.sessionTimeouts.RememberMaxAge,
+	} {
+		if timeout <= 0 {
+			problems = append(problems, fmt.Sprintf("Session %s timeout %s must be greater than zero", name, timeout))
+		}
+	}
+
+	if err := opts.backupSettings.Validate(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if err := opts.mailSettings.Validate(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	sort.Strings(problems)
+	return problems
+}
+
+//readConfigFile reads the TOML config file, nested tables' keys are joined with dots
+func readConfigFile(fileName string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	if _, err := toml.DecodeFile(fileName, &values); err != nil {
+		return nil, err
+	}
+
+	flattened := map[string]interface{}{}
+	flattenConfig("", values, flattened)
+	return flattened, nil
+}
+
+func flattenConfig(prefix string, values map[string]interface{}, flattened map[string]interface{}) {
+	for key, value := range values {
+		if len(prefix) > 0 {
+			key = prefix + "." + key
+		}
+
+		if table, ok := value.(map[string]interface{}); ok {
+			flattenConfig(key, table, flattened)
+			continue
+		}
+		flattened[key] = value
+	}
+}
+
+func configSettingByKey(key string) (configSetting, bool) {
+	for _, cs := range configSettings {
+		if cs.key == key {
+			return cs, true
+		}
+	}
+	return configSetting{}, false
+}
+
+//printConfig writes the effective configuration as a config file, with secrets redacted and a comment
+//saying where each setting came from
+func printConfig(w io.Writer, fs *flag.FlagSet, opts *options) {
+	var section string
+	for _, cs := range configSettings {
+		f := fs.Lookup(cs.flag)
+		if f == nil {
+			continue
+		}
+
+		keySection, key := "", cs.key
+		if i := strings.Index(cs.key, "."); i >= 0 {
+			keySection, key = cs.key[:i], cs.key[i+1:]
+		}
+
+		if keySection != section {
+			if len(section) > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "[%s]\n", keySection)
+			section = keySection
+		}
+
+		source, ok := opts.configSources[cs.flag]
+		if !ok {
+			source = "default"
+		}
+
+		fmt.Fprintf(w, "%s = %s # %s\n", key, configValue(f, cs.secret), source)
+	}
+}
+
+//configValue formats the flag's value as it would be written in the config file
+func configValue(f *flag.Flag, secret bool) string {
+	getter, ok := f.Value.(flag.Getter)
+	if !ok {
+		return strconv.Quote(f.Value.String())
+	}
+
+	switch value := getter.Get().(type) {
+	case string:
+		if secret && len(value) > 0 {
+			return strconv.Quote("REDACTED")
+		}
+		return strconv.Quote(value)
+	case time.Duration:
+		return strconv.Quote(value.String())
+	default:
+		return fmt.Sprint(value)
+	}
+}
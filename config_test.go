@@ -0,0 +1,96 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"strings"
+	"testing"
+	"time"
+)
+
+func parseTestArgs(t *testing.T, args []string, env map[string]string) (*options, *flag.FlagSet, []string) {
+	opts := &options{}
+	fs := flag.NewFlagSet("berrycms", flag.ContinueOnError)
+	defineFlags(fs, opts)
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("Unable to parse flags %v: %v", args, err)
+	}
+
+	lookupEnv := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	problems := opts.loadConfig(fs, lookupEnv)
+	return opts, fs, append(problems, opts.validate()...)
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	opts, _, problems := parseTestArgs(t, []string{"-p", "9090"}, map[string]string{
+		"BERRY_PORT":         "7070",
+		"BERRY_DB_PASS":      "secret",
+		"BERRY_SESSION_IDLE": "5m",
+	})
+	if len(problems) > 0 {
+		t.Fatalf("Valid configuration reported problems: %v", problems)
+	}
+
+	if opts.port != 9090 {
+		t.Errorf("Flag should take precedence over environment variable, got port %d", opts.port)
+	}
+
+	if opts.sqlPassword != "secret" || opts.sessionTimeouts.Idle != time.Minute*5 {
+		t.Errorf("Environment variables should be used when flags aren't given, got %q and %s", opts.sqlPassword, opts.sessionTimeouts.Idle)
+	}
+
+	if _, given := opts.configSources["sessionmax"]; given {
+		t.Errorf("Setting left at its default shouldn't be recorded as given")
+	}
+}
+
+func TestConfigReportsAllProblems(t *testing.T) {
+	_, _, problems := parseTestArgs(t, []string{"-db", "oracle"}, map[string]string{
+		"BERRY_PORT":         "notaport",
+		"BERRY_ADDR":         "nowhere",
+		"BERRY_BACKUP_DAILY": "-1",
+	})
+
+	if len(problems) != 4 {
+		t.Errorf("Expected 4 problems, got %d: %v", len(problems), problems)
+	}
+}
+
+func TestPrintConfigRedactsSecrets(t *testing.T) {
+	opts, fs, problems := parseTestArgs(t, []string{"-dbpass", "hunter2"}, nil)
+	if len(problems) > 0 {
+		t.Fatalf("Valid configuration reported problems: %v", problems)
+	}
+
+	var out bytes.Buffer
+	printConfig(&out, fs, opts)
+
+	if strings.Contains(out.String(), "hunter2") {
+		t.Errorf("Printed config shouldn't contain the database password:\n%s", out.String())
+	}
+
+	if !strings.Contains(out.String(), "password = \"REDACTED\" # flag -dbpass") {
+		t.Errorf("Printed config should show the password was given and redacted:\n%s", out.String())
+	}
+
+	if !strings.Contains(out.String(), "[session]\nidle = \"20m0s\" # default") {
+		t.Errorf("Printed config should show defaults by section:\n%s", out.String())
+	}
+}
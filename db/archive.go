@@ -0,0 +1,339 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/tacusci/logging"
+)
+
+//ArchiveFormat version of the archive layout itself, archives of any other format can't be imported
+const ArchiveFormat = 1
+
+//Archive portable copy of a site's content which can be imported into any of the supported databases
+type Archive struct {
+	Format          int                                 `json:"format"`
+	Version         string                              `json:"version"`
+	SchemaVersion   int                                 `json:"schemaversion"`
+	CreatedDateTime int64                               `json:"createddatetime"`
+	Tables          map[string][]map[string]interface{} `json:"tables"`
+}
+
+//archivedModels the content and settings which get moved between sites, those referred to by foreign keys come first
+var archivedModels = []Model{
+	&User{},
+	&UserTwoFactor{},
+	&RecoveryCode{},
+	&Group{},
+	&GroupPermission{},
+	&GroupMembership{},
+	&Page{},
+	&PageGroupPermission{},
+	&PageRevision{},
+	&Settings{},
+}
+
+//replacedModels belong to the users being replaced on import, so they're cleared out without being archived
+var replacedModels = []Model{
+	&AuthSession{},
+	&APIToken{},
+	&AccountLock{},
+	&LoginAttempt{},
+	&PasswordReset{},
+	&Registration{},
+}
+
+//Export writes every archived table to the writer as JSON
+func Export(db *sql.DB, w io.Writer) error {
+	schemaVersion, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	archive := Archive{
+		Format:          ArchiveFormat,
+		Version:         VERSION,
+		SchemaVersion:   schemaVersion,
+		CreatedDateTime: time.Now().Unix(),
+		Tables:          map[string][]map[string]interface{}{},
+	}
+
+	for _, m := range archivedModels {
+		t, err := tableForModel(m)
+		if err != nil {
+			return err
+		}
+
+		rows, err := exportTable(db, t, m)
+		if err != nil {
+			return fmt.Errorf("Unable to export %s -> %s", t.Name(), err.Error())
+		}
+
+		logging.Debug(fmt.Sprintf("Exported %d rows from %s", len(rows), t.Name()))
+		archive.Tables[t.Name()] = rows
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(archive)
+}
+
+//exportTable reads every row of the table into a map of column names to values, in the order they were added
+func exportTable(db Querier, t Table, m Model) ([]map[string]interface{}, error) {
+	pk, err := primaryKeyOf(t, m)
+	if err != nil {
+		return nil, err
+	}
+
+	models := reflect.New(reflect.SliceOf(reflect.TypeOf(m).Elem()))
+	if err := Find(db, From(t).OrderBy(pk, Ascending), models.Interface()); err != nil {
+		return nil, err
+	}
+
+	rows := make([]map[string]interface{}, 0, models.Elem().Len())
+	for i := 0; i < models.Elem().Len(); i++ {
+		columns, err := mapColumns(t, models.Elem().Index(i).Addr().Interface().(Model))
+		if err != nil {
+			return nil, err
+		}
+
+		//the column values are read directly, model JSON tags would leave things like password hashes out
+		row := map[string]interface{}{}
+		for _, c := range columns {
+			row[c.Name] = c.value.Interface()
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+//Import replaces the archived tables' contents with those of the archive, the archive must be of the same schema
+//version as the database so everything's got somewhere to go
+func Import(db *sql.DB, r io.Reader) error {
+	decoder := json.NewDecoder(r)
+	//keeps large integers like timestamps exact
+	decoder.UseNumber()
+
+	archive := Archive{}
+	if err := decoder.Decode(&archive); err != nil {
+		return fmt.Errorf("Unable to read archive -> %s", err.Error())
+	}
+
+	if archive.Format != ArchiveFormat {
+		return fmt.Errorf("Archive is of format %d, only format %d can be imported", archive.Format, ArchiveFormat)
+	}
+
+	schemaVersion, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	if archive.SchemaVersion != schemaVersion {
+		return fmt.Errorf("Archive is of schema version %d but the database is at %d, both sites need to be migrated to the same version", archive.SchemaVersion, schemaVersion)
+	}
+
+	return WithTransaction(db, func(tx *sql.Tx) error {
+		toClear := append(append([]Model{}, archivedModels...), replacedModels...)
+		//cleared in reverse so rows are removed before those they refer to
+		for i := len(toClear) - 1; i >= 0; i-- {
+			t, err := tableForModel(toClear[i])
+			if err != nil {
+				return err
+			}
+			//the query builder won't delete without conditions, there's nothing here to bind anyway
+			if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s", quoteIdentifier(t.Name()))); err != nil {
+				return err
+			}
+		}
+
+		for _, m := range archivedModels {
+			t, err := tableForModel(m)
+			if err != nil {
+				return err
+			}
+
+			rows := archive.Tables[t.Name()]
+			for i, row := range rows {
+				if err := importRow(tx, t, m, row); err != nil {
+					return fmt.Errorf("Unable to import row %d of %s -> %s", i, t.Name(), err.Error())
+				}
+			}
+
+			logging.Debug(fmt.Sprintf("Imported %d rows into %s", len(rows), t.Name()))
+		}
+
+		return nil
+	})
+}
+
+//importRow inserts a single archived row, auto incremented IDs are left for the database to hand out again
+func importRow(db Querier, t Table, m Model, row map[string]interface{}) error {
+	model := reflect.New(reflect.TypeOf(m).Elem()).Interface().(Model)
+
+	columns, err := mapColumns(t, model)
+	if err != nil {
+		return err
+	}
+
+	if len(row) != len(columns) {
+		return fmt.Errorf("Row has %d columns, table has %d", len(row), len(columns))
+	}
+
+	for _, c := range columns {
+		value, ok := row[c.Name]
+		if !ok {
+			return fmt.Errorf("Row is missing column %s", c.Name)
+		}
+
+		if c.AutoIncrement {
+			continue
+		}
+
+		if err := setArchivedValue(c.value, value); err != nil {
+			return fmt.Errorf("Column %s %s", c.Name, err.Error())
+		}
+	}
+
+	return Insert(db, model)
+}
+
+//setArchivedValue converts a value decoded from the archive's JSON to the type of the model field
+func setArchivedValue(field reflect.Value, value interface{}) error {
+	switch field.Kind() {
+	case reflect.String:
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("should be a string, got %v", value)
+		}
+		field.SetString(s)
+	case reflect.Bool:
+		b, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("should be true or false, got %v", value)
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("should be a number, got %v", value)
+		}
+		i, err := n.Int64()
+		if err != nil {
+			return fmt.Errorf("should be a whole number, got %v", value)
+		}
+		field.SetInt(i)
+	default:
+		return fmt.Errorf("is of unsupported type %s", field.Type())
+	}
+
+	return nil
+}
+
+func primaryKeyOf(t Table, m Model) (string, error) {
+	columns, err := mapColumns(t, m)
+	if err != nil {
+		return "", err
+	}
+
+	pk, err := primaryKey(t, columns)
+	if err != nil {
+		return "", err
+	}
+
+	return pk.Name, nil
+}
+
+//ExportPages writes every page to the writer as a JSON list, unlike a full export it can be imported into any site
+func ExportPages(db Querier, w io.Writer) error {
+	var pages []Page
+	if err := Find(db, From(&PagesTable{}).OrderBy("route", Ascending), &pages); err != nil {
+		return err
+	}
+
+	if pages == nil {
+		pages = []Page{}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(pages)
+}
+
+//ImportPages adds the pages in the JSON list to the site, replacing the content of existing pages with the same route.
+//A revision is recorded against the given author for each, who also becomes the author of newly created pages
+func ImportPages(db *sql.DB, r io.Reader, authorUUID string) (int, error) {
+	var pages []Page
+	if err := json.NewDecoder(r).Decode(&pages); err != nil {
+		return 0, fmt.Errorf("Unable to read pages -> %s", err.Error())
+	}
+
+	err := WithTransaction(db, func(tx *sql.Tx) error {
+		pt := PagesTable{}
+		prt := PageRevisionsTable{}
+		for i := range pages {
+			p := &pages[i]
+			if len(p.Route) == 0 {
+				return fmt.Errorf("Page %s has no route", p.Title)
+			}
+
+			existing := &Page{}
+			err := Get(tx, existing, Equal("route", p.Route))
+			if err != nil && err != sql.ErrNoRows {
+				return err
+			}
+
+			if err == nil {
+				existing.Title = p.Title
+				existing.Content = p.Content
+				existing.Roleprotected = p.Roleprotected
+				existing.Status = p.Status
+				existing.PublishDateTime = p.PublishDateTime
+				existing.UnpublishDateTime = p.UnpublishDateTime
+				p = existing
+				err = pt.Update(tx, p)
+			} else {
+				p.PageId = 0
+				p.UUID = ""
+				p.AuthorUUID = authorUUID
+				if p.CreatedDateTime == 0 {
+					p.CreatedDateTime = time.Now().Unix()
+				}
+				err = pt.Insert(tx, p)
+			}
+
+			if err != nil {
+				return fmt.Errorf("Unable to import page %s -> %s", p.Route, err.Error())
+			}
+
+			if err := prt.InsertFromPage(tx, p, authorUUID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(pages), nil
+}
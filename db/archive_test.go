@@ -0,0 +1,182 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	ut := UsersTable{}
+	u := &User{
+		CreatedDateTime: time.Now().Unix(),
+		Username:        "archived",
+		AuthHash:        "archivedhash",
+		FirstName:       "Archived",
+		LastName:        "User",
+		Email:           "archived@local.com",
+	}
+	if err := ut.Insert(Conn, u); err != nil {
+		t.Fatalf("Unable to insert user: %v", err)
+	}
+
+	pt := PagesTable{}
+	p := &Page{CreatedDateTime: time.Now().Unix(), AuthorUUID: u.UUID, Title: "Archived", Route: "/archived", Content: "[]", Status: PAGE_DRAFT}
+	if err := pt.Insert(Conn, p); err != nil {
+		t.Fatalf("Unable to insert page: %v", err)
+	}
+
+	rt := RegistrationsTable{}
+	reg := &Registration{CreatedDateTime: time.Now().Unix(), Username: "pending", Email: "pending@local.com", AuthHash: "pendinghash", TokenHash: "pendingtoken", ExpiresDateTime: time.Now().Unix() + 3600}
+	if err := rt.Insert(Conn, reg); err != nil {
+		t.Fatalf("Unable to insert registration: %v", err)
+	}
+
+	defer func() {
+		rt.DeleteByID(Conn, reg.Registrationid)
+		pt.DeleteByUUID(Conn, p.UUID)
+		ut.DeleteByUUID(Conn, u.UUID)
+	}()
+
+	var archive bytes.Buffer
+	if err := Export(Conn, &archive); err != nil {
+		t.Fatalf("Unable to export database: %v", err)
+	}
+
+	if _, err := pt.DeleteByUUID(Conn, p.UUID); err != nil {
+		t.Fatalf("Unable to delete page: %v", err)
+	}
+
+	if err := Import(Conn, &archive); err != nil {
+		t.Fatalf("Unable to import archive: %v", err)
+	}
+
+	imported, err := pt.SelectByUUID(Conn, p.UUID)
+	if err != nil {
+		t.Fatalf("Page deleted after exporting should have been imported again: %v", err)
+	}
+
+	if imported.Title != p.Title || imported.AuthorUUID != u.UUID || imported.Status != p.Status {
+		t.Errorf("Imported page %v doesn't match the exported one %v", *imported, *p)
+	}
+
+	importedUser, err := ut.SelectByUUID(Conn, u.UUID)
+	if err != nil || importedUser.AuthHash != u.AuthHash {
+		t.Errorf("Imported user should keep their password hash, got %v: %v", importedUser, err)
+	}
+
+	if count, _ := From(TableOf(&Registration{})).Count(Conn); count != 0 {
+		t.Errorf("Pending registrations should be cleared out on import, %d left", count)
+	}
+}
+
+func TestImportRejectsMismatchedArchive(t *testing.T) {
+	schemaVersion, err := SchemaVersion(Conn)
+	if err != nil {
+		t.Fatalf("Unable to read schema version: %v", err)
+	}
+
+	for _, archive := range []Archive{
+		{Format: ArchiveFormat + 1, SchemaVersion: schemaVersion},
+		{Format: ArchiveFormat, SchemaVersion: schemaVersion + 1},
+	} {
+		encoded, _ := json.Marshal(archive)
+		if err := Import(Conn, bytes.NewReader(encoded)); err == nil {
+			t.Errorf("Importing archive of format %d and schema version %d should fail", archive.Format, archive.SchemaVersion)
+		}
+	}
+
+	if err := Import(Conn, strings.NewReader("not an archive")); err == nil {
+		t.Errorf("Importing something which isn't JSON should fail")
+	}
+}
+
+func TestExportImportPages(t *testing.T) {
+	ut := UsersTable{}
+	u := &User{
+		CreatedDateTime: time.Now().Unix(),
+		Username:        "pageimporter",
+		AuthHash:        "hash",
+		FirstName:       "Page",
+		LastName:        "Importer",
+		Email:           "pageimporter@local.com",
+	}
+	if err := ut.Insert(Conn, u); err != nil {
+		t.Fatalf("Unable to insert user: %v", err)
+	}
+
+	pt := PagesTable{}
+	prt := PageRevisionsTable{}
+	p := &Page{CreatedDateTime: time.Now().Unix(), AuthorUUID: u.UUID, Title: "Exported", Route: "/exportedpage", Content: "[]"}
+	if err := pt.Insert(Conn, p); err != nil {
+		t.Fatalf("Unable to insert page: %v", err)
+	}
+
+	var pages bytes.Buffer
+	if err := ExportPages(Conn, &pages); err != nil {
+		t.Fatalf("Unable to export pages: %v", err)
+	}
+
+	//change the exported page and add a new one to the export, importing should update the first and create the second
+	var exported []Page
+	if err := json.Unmarshal(pages.Bytes(), &exported); err != nil {
+		t.Fatalf("Unable to read exported pages: %v", err)
+	}
+
+	var toImport []Page
+	for _, ep := range exported {
+		if ep.Route == p.Route {
+			ep.Title = "Imported"
+			toImport = append(toImport, ep, Page{Title: "New", Route: "/importedpage", Content: "[]"})
+		}
+	}
+
+	importJSON, err := json.Marshal(toImport)
+	if err != nil {
+		t.Fatalf("Unable to write pages to import: %v", err)
+	}
+
+	imported, err := ImportPages(Conn, bytes.NewReader(importJSON), u.UUID)
+	if err != nil || imported != 2 {
+		t.Fatalf("Expected 2 pages to be imported, got %d: %v", imported, err)
+	}
+
+	updated, err := pt.SelectByRoute(Conn, p.Route)
+	if err != nil || updated.UUID != p.UUID || updated.Title != "Imported" {
+		t.Errorf("Existing page should have been updated in place, got %v: %v", updated, err)
+	}
+
+	created, err := pt.SelectByRoute(Conn, "/importedpage")
+	if err != nil || created.AuthorUUID != u.UUID {
+		t.Errorf("New page should have been created by the importing author, got %v: %v", created, err)
+	}
+
+	for _, page := range []*Page{updated, created} {
+		if page == nil {
+			continue
+		}
+
+		if revisions, err := prt.SelectByPageUUID(Conn, page.UUID); err != nil || len(revisions) != 1 {
+			t.Errorf("Importing page %s should record a revision, got %d: %v", page.Route, len(revisions), err)
+		}
+		prt.DeleteByPageUUID(Conn, page.UUID)
+		pt.DeleteByUUID(Conn, page.UUID)
+	}
+	ut.DeleteByUUID(Conn, u.UUID)
+}
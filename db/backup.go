@@ -0,0 +1,31 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+//Backup writes a consistent copy of the SQLite database to a new file while the server carries on using it
+func Backup(db *sql.DB, fileName string) error {
+	if Type != SQLITE {
+		return fmt.Errorf("Online backups are only supported for SQLite databases")
+	}
+
+	//VACUUM INTO refuses to overwrite an existing file, and can't be run within a transaction
+	_, err := db.Exec("VACUUM INTO ?", fileName)
+	return err
+}
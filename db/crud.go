@@ -0,0 +1,374 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+//column a table field along with the model struct field its values are read from and scanned into
+type column struct {
+	Field
+	value reflect.Value
+}
+
+//modelTable a table declared by nothing more than its model struct, the columns come from the tbl tags of the model's fields
+type modelTable struct {
+	model Model
+}
+
+//TableOf gets the table a model declares with its tbl tags, for models without a table struct of their own
+func TableOf(m Model) Table {
+	return &modelTable{model: m}
+}
+
+//initialiser models which fill in default data when their table is first created
+type initialiser interface {
+	Init(db *sql.DB)
+}
+
+func (mt *modelTable) Init(db *sql.DB) {
+	if i, ok := mt.model.(initialiser); ok {
+		i.Init(db)
+	}
+}
+
+func (mt *modelTable) Name() string { return mt.model.TableName() }
+
+func (mt *modelTable) buildFields() []Field {
+	return buildFieldsFromStruct(reflect.ValueOf(mt.model).Elem())
+}
+
+func (mt *modelTable) buildInsertStatement(m Model) string {
+	return buildInsertStatementFromTable(mt, m)
+}
+
+//tableForModel finds the registered table the model's rows are stored in, or the table the model declares itself
+func tableForModel(m Model) (Table, error) {
+	for _, t := range getTables() {
+		if t.Name() == m.TableName() {
+			return t, nil
+		}
+	}
+
+	for _, field := range buildFieldsFromModel(m) {
+		if field.PrimaryKey {
+			return TableOf(m), nil
+		}
+	}
+
+	return nil, fmt.Errorf("No table registered for model %T of table name %s", m, m.TableName())
+}
+
+//mapColumns pairs each of the table's columns with the model field of the same name, ignoring case
+func mapColumns(t Table, m Model) ([]column, error) {
+	modelValue := reflect.ValueOf(m)
+	if modelValue.Kind() != reflect.Ptr || modelValue.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("Model %T must be a pointer to a struct", m)
+	}
+	modelValue = modelValue.Elem()
+	modelType := modelValue.Type()
+
+	columns := make([]column, 0, modelType.NumField())
+	for _, field := range t.buildFields() {
+		found := false
+		for i := 0; i < modelType.NumField(); i++ {
+			if strings.EqualFold(modelType.Field(i).Name, field.Name) {
+				columns = append(columns, column{Field: field, value: modelValue.Field(i)})
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("Model %T has no field for column %s of table %s", m, field.Name, t.Name())
+		}
+	}
+
+	return columns, nil
+}
+
+func columnNames(columns []column) []string {
+	names := make([]string, 0, len(columns))
+	for _, c := range columns {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+func scanDestinations(columns []column) []interface{} {
+	dests := make([]interface{}, 0, len(columns))
+	for _, c := range columns {
+		dests = append(dests, c.value.Addr().Interface())
+	}
+	return dests
+}
+
+func primaryKey(t Table, columns []column) (column, error) {
+	for _, c := range columns {
+		if c.PrimaryKey {
+			return c, nil
+		}
+	}
+	return column{}, fmt.Errorf("Table %s has no primary key", t.Name())
+}
+
+//Insert adds the model to its table as a new row, setting its auto incremented ID once it has one
+func Insert(db Querier, m Model) error {
+	t, err := tableForModel(m)
+	if err != nil {
+		return err
+	}
+
+	columns, err := mapColumns(t, m)
+	if err != nil {
+		return err
+	}
+
+	var autoIncrement *column
+	for i, c := range columns {
+		if c.AutoIncrement {
+			autoIncrement = &columns[i]
+		}
+	}
+
+	insertStatement, args := buildInsert(t, columns)
+
+	//Postgres drivers can't report the last inserted ID, it has to be asked for
+	if autoIncrement != nil && Type == Postgres {
+		var id int64
+		if err := db.QueryRow(rebind(insertStatement+" RETURNING "+quoteIdentifier(autoIncrement.Name)), args...).Scan(&id); err != nil {
+			return err
+		}
+		autoIncrement.value.SetInt(id)
+		return nil
+	}
+
+	res, err := db.Exec(rebind(insertStatement), args...)
+	if err != nil {
+		return err
+	}
+
+	if autoIncrement != nil {
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		autoIncrement.value.SetInt(id)
+	}
+
+	return nil
+}
+
+//Upsert inserts the model, or if a row already has the same values in the conflict columns, which need a
+//unique index, updates that row instead
+func Upsert(db Querier, m Model, conflictColumns ...string) error {
+	if len(conflictColumns) == 0 {
+		return fmt.Errorf("Upserting a %T needs at least one conflict column", m)
+	}
+
+	t, err := tableForModel(m)
+	if err != nil {
+		return err
+	}
+
+	columns, err := mapColumns(t, m)
+	if err != nil {
+		return err
+	}
+
+	conflicts := map[string]bool{}
+	quotedConflictColumns := make([]string, 0, len(conflictColumns))
+	for _, conflictColumn := range conflictColumns {
+		conflicts[conflictColumn] = true
+		quotedConflictColumns = append(quotedConflictColumns, quoteIdentifier(conflictColumn))
+	}
+
+	assignments := []string{}
+	for _, c := range columns {
+		if c.AutoIncrement || conflicts[c.Name] {
+			continue
+		}
+		if Type == MySQL {
+			assignments = append(assignments, fmt.Sprintf("%s = VALUES(%s)", quoteIdentifier(c.Name), quoteIdentifier(c.Name)))
+		} else {
+			assignments = append(assignments, fmt.Sprintf("%s = excluded.%s", quoteIdentifier(c.Name), quoteIdentifier(c.Name)))
+		}
+	}
+
+	insertStatement, args := buildInsert(t, columns)
+
+	//with nothing else to update the existing row is left as it is
+	if len(assignments) == 0 {
+		assignments = append(assignments, fmt.Sprintf("%s = %s", quotedConflictColumns[0], quotedConflictColumns[0]))
+	}
+
+	var upsertStatement bytes.Buffer
+	upsertStatement.WriteString(insertStatement)
+	if Type == MySQL {
+		//MySQL works out the conflict from whichever unique index was violated
+		upsertStatement.WriteString(" ON DUPLICATE KEY UPDATE ")
+	} else {
+		upsertStatement.WriteString(fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET ", strings.Join(quotedConflictColumns, ", ")))
+	}
+	upsertStatement.WriteString(strings.Join(assignments, ", "))
+
+	_, err = db.Exec(rebind(upsertStatement.String()), args...)
+	return err
+}
+
+//buildInsert builds the insert statement for every column apart from the auto incremented one, along with the values to bind
+func buildInsert(t Table, columns []column) (string, []interface{}) {
+	names := []string{}
+	args := []interface{}{}
+	for _, c := range columns {
+		if c.AutoIncrement {
+			continue
+		}
+		names = append(names, quoteIdentifier(c.Name))
+		args = append(args, c.value.Interface())
+	}
+
+	var insertStatement bytes.Buffer
+	insertStatement.WriteString(fmt.Sprintf("INSERT INTO %s (%s) VALUES (", quoteIdentifier(t.Name()), strings.Join(names, ", ")))
+	insertStatement.WriteString(strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", "))
+	insertStatement.WriteString(")")
+
+	return insertStatement.String(), args
+}
+
+//Update saves every column of the model to the row with the same primary key
+func Update(db Querier, m Model) error {
+	t, err := tableForModel(m)
+	if err != nil {
+		return err
+	}
+
+	columns, err := mapColumns(t, m)
+	if err != nil {
+		return err
+	}
+
+	pk, err := primaryKey(t, columns)
+	if err != nil {
+		return err
+	}
+
+	assignments := []string{}
+	args := []interface{}{}
+	for _, c := range columns {
+		if c.PrimaryKey {
+			continue
+		}
+		assignments = append(assignments, fmt.Sprintf("%s = ?", quoteIdentifier(c.Name)))
+		args = append(args, c.value.Interface())
+	}
+	args = append(args, pk.value.Interface())
+
+	updateStatement := fmt.Sprintf("UPDATE %s SET %s WHERE %s = ?", quoteIdentifier(t.Name()), strings.Join(assignments, ", "), quoteIdentifier(pk.Name))
+	_, err = db.Exec(rebind(updateStatement), args...)
+	return err
+}
+
+//Get loads the first row matching the conditions into the model, returning sql.ErrNoRows if there isn't one
+func Get(db Querier, m Model, conditions ...Condition) error {
+	t, err := tableForModel(m)
+	if err != nil {
+		return err
+	}
+
+	columns, err := mapColumns(t, m)
+	if err != nil {
+		return err
+	}
+
+	return From(t).Columns(columnNames(columns)...).Where(conditions...).Limit(1).QueryRow(db).Scan(scanDestinations(columns)...)
+}
+
+//Find loads every row the query matches into the slice of models dest points to, the query's columns are
+//replaced with the ones the model needs
+func Find(db Querier, q *Query, dest interface{}) error {
+	destValue := reflect.ValueOf(dest)
+	if destValue.Kind() != reflect.Ptr || destValue.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("Destination %T must be a pointer to a slice of models", dest)
+	}
+	sliceValue := destValue.Elem()
+	elemType := sliceValue.Type().Elem()
+
+	m, ok := reflect.New(elemType).Interface().(Model)
+	if !ok {
+		return fmt.Errorf("Destination %T isn't a slice of models", dest)
+	}
+
+	if m.TableName() != q.table.Name() {
+		return fmt.Errorf("Query of table %s can't be loaded into models of table %s", q.table.Name(), m.TableName())
+	}
+
+	columns, err := mapColumns(q.table, m)
+	if err != nil {
+		return err
+	}
+
+	q.columns = nil
+	rows, err := q.Columns(columnNames(columns)...).Query(db)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	results := reflect.MakeSlice(sliceValue.Type(), 0, 0)
+	for rows.Next() {
+		elem := reflect.New(elemType)
+		elemColumns, err := mapColumns(q.table, elem.Interface().(Model))
+		if err != nil {
+			return err
+		}
+		if err := rows.Scan(scanDestinations(elemColumns)...); err != nil {
+			return err
+		}
+		results = reflect.Append(results, elem.Elem())
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	sliceValue.Set(results)
+	return nil
+}
+
+//Delete removes the row with the same primary key as the model
+func Delete(db Querier, m Model) (int64, error) {
+	t, err := tableForModel(m)
+	if err != nil {
+		return 0, err
+	}
+
+	columns, err := mapColumns(t, m)
+	if err != nil {
+		return 0, err
+	}
+
+	pk, err := primaryKey(t, columns)
+	if err != nil {
+		return 0, err
+	}
+
+	return From(t).Where(Equal(pk.Name, pk.value.Interface())).Delete(db)
+}
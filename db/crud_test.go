@@ -0,0 +1,119 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestGenericCRUD(t *testing.T) {
+	pr := &PageRevision{
+		CreatedDateTime: time.Now().Unix(),
+		UUID:            "generic-crud-revision",
+		PageUUID:        "generic-crud-page",
+		Title:           "First",
+		Route:           "/generic-crud",
+		Content:         "<p>first</p>",
+	}
+	defer From(TableOf(&PageRevision{})).Where(Equal("pageuuid", pr.PageUUID)).Delete(Conn)
+
+	if err := Insert(Conn, pr); err != nil {
+		t.Fatalf("Unable to insert page revision: %v", err)
+	}
+
+	if pr.Pagerevisionid == 0 {
+		t.Errorf("Inserting should set the auto incremented ID of the model")
+	}
+
+	pr.Title = "Second"
+	if err := Update(Conn, pr); err != nil {
+		t.Fatalf("Unable to update page revision: %v", err)
+	}
+
+	loaded := &PageRevision{}
+	if err := Get(Conn, loaded, Equal("uuid", pr.UUID)); err != nil {
+		t.Fatalf("Unable to get page revision: %v", err)
+	}
+
+	if *loaded != *pr {
+		t.Errorf("Loaded page revision %v doesn't match the saved one %v", *loaded, *pr)
+	}
+
+	revisions := []PageRevision{}
+	if err := Find(Conn, From(TableOf(&PageRevision{})).Where(Equal("pageuuid", pr.PageUUID)), &revisions); err != nil {
+		t.Fatalf("Unable to find page revisions: %v", err)
+	}
+
+	if len(revisions) != 1 || revisions[0].Title != "Second" {
+		t.Errorf("Expected to find the single updated revision, got %v", revisions)
+	}
+
+	if numDeleted, err := Delete(Conn, pr); err != nil || numDeleted != 1 {
+		t.Errorf("Expected to delete 1 page revision, deleted %d: %v", numDeleted, err)
+	}
+
+	if err := Get(Conn, loaded, Equal("uuid", pr.UUID)); err != sql.ErrNoRows {
+		t.Errorf("Getting a deleted row should report there are no rows, got %v", err)
+	}
+}
+
+//declaredModel a table declared by nothing more than its model struct
+type declaredModel struct {
+	Declaredmodelid int    `tbl:"PKNNAIUI"`
+	CreatedDateTime int64  `tbl:"NNDT"`
+	Title           string `tbl:"NNUI"`
+}
+
+func (dm *declaredModel) TableName() string { return "declaredmodels" }
+
+func TestDeclaredModelCRUD(t *testing.T) {
+	table := TableOf(&declaredModel{})
+	if _, err := Conn.Exec(createStatement(table)); err != nil {
+		t.Fatalf("Unable to create table from model: %v", err)
+	}
+	defer dropTables([]Table{table})
+
+	dm := &declaredModel{CreatedDateTime: time.Now().Unix(), Title: "Declared"}
+	if err := Insert(Conn, dm); err != nil {
+		t.Fatalf("Unable to insert declared model: %v", err)
+	}
+
+	loaded := &declaredModel{}
+	if err := Get(Conn, loaded, Equal("title", dm.Title)); err != nil || *loaded != *dm {
+		t.Errorf("Loaded model %v doesn't match the saved one %v: %v", *loaded, *dm, err)
+	}
+
+	models := []declaredModel{}
+	if err := Find(Conn, From(table), &models); err != nil || len(models) != 1 {
+		t.Errorf("Expected to find the single saved model, got %v: %v", models, err)
+	}
+
+	if numDeleted, err := Delete(Conn, dm); err != nil || numDeleted != 1 {
+		t.Errorf("Expected to delete 1 declared model, deleted %d: %v", numDeleted, err)
+	}
+}
+
+func TestGenericCRUDMismatchedModel(t *testing.T) {
+	users := []User{}
+	if err := Find(Conn, From(&PagesTable{}), &users); err == nil {
+		t.Errorf("Loading pages into user models should fail")
+	}
+
+	if _, err := mapColumns(&UsersTable{}, &Page{}); err == nil {
+		t.Errorf("Mapping a model without fields for every column should fail")
+	}
+}
@@ -17,6 +17,8 @@ package db
 import (
 	"database/sql"
 	"fmt"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/schollz/progressbar"
@@ -27,6 +29,7 @@ import (
 
 	//blank import to make sure right SQL driver is used to talk to DB
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -38,8 +41,9 @@ const (
 	VERSION           = "v0.0.1a"
 	dbFileName string = "./berrycms.db"
 
-	MySQL  DBType = iota
-	SQLITE DBType = iota
+	MySQL    DBType = iota
+	SQLITE   DBType = iota
+	Postgres DBType = iota
 )
 
 type DBType int
@@ -49,10 +53,37 @@ func (dt *DBType) DriverName() string {
 		return "mysql"
 	} else if *dt == SQLITE {
 		return "sqlite3"
+	} else if *dt == Postgres {
+		return "postgres"
 	}
 	return ""
 }
 
+//redactedLocation the database location with any password in it hidden, so it can be logged
+func redactedLocation(dbType DBType, dbLoc string) string {
+	switch dbType {
+	case MySQL:
+		//DSNs look like user:password@protocol(address)/schema, and the password may itself contain an @
+		at := strings.LastIndex(dbLoc, "@")
+		if at < 0 {
+			return dbLoc
+		}
+		if colon := strings.Index(dbLoc[:at], ":"); colon >= 0 {
+			return dbLoc[:colon+1] + "xxxxx" + dbLoc[at:]
+		}
+	case Postgres:
+		u, err := url.Parse(dbLoc)
+		if err != nil {
+			return ""
+		}
+		if _, hasPassword := u.User.Password(); hasPassword {
+			u.User = url.UserPassword(u.User.Username(), "xxxxx")
+		}
+		return u.String()
+	}
+	return dbLoc
+}
+
 //Connect connects to database
 func Connect(dbType DBType, dbRoute string, schemaName string) {
 	SchemaName = schemaName
@@ -66,8 +97,23 @@ func Connect(dbType DBType, dbRoute string, schemaName string) {
 		if dbRoute == "" {
 			dbLoc = dbFileName
 		}
+		//SQLite only enforces foreign keys when asked to, for every connection in the pool
+		if strings.Contains(dbLoc, "?") {
+			dbLoc += "&_foreign_keys=1"
+		} else {
+			dbLoc += "?_foreign_keys=1"
+		}
+	case Postgres:
+		//the route is a connection URL, the schema name is the database on the server to use
+		u, err := url.Parse(dbRoute)
+		if err != nil {
+			logging.ErrorAndExit(fmt.Sprintf("Invalid Postgres connection URL: %s", err.Error()))
+			return
+		}
+		u.Path = "/" + SchemaName
+		dbLoc = u.String()
 	}
-	logging.InfoNnl(fmt.Sprintf("Connecting to %s:%s schema...", Type.DriverName(), dbLoc))
+	logging.InfoNnl(fmt.Sprintf("Connecting to %s:%s schema...", Type.DriverName(), redactedLocation(dbType, dbLoc)))
 	db, err := sql.Open(Type.DriverName(), dbLoc)
 	if err != nil {
 		logging.ErrorNnl(fmt.Sprintf(" DB error: %s\n", err.Error()))
@@ -134,9 +180,59 @@ func Heartbeat() {
 //Wipe drops all database tables
 func Wipe() error {
 	logging.Info("Wiping database...")
-	for _, tableToDrop := range getTables() {
+	return dropTables(getTables())
+}
+
+//WipeTables drops just the named tables, Setup recreates them with their default data
+func WipeTables(names ...string) error {
+	var tablesToDrop []Table
+	for _, name := range names {
+		t := tableByName(name)
+		if t == nil {
+			return fmt.Errorf("Unknown table %s, tables are: %s", name, strings.Join(TableNames(), ", "))
+		}
+		tablesToDrop = append(tablesToDrop, t)
+	}
+
+	//keep the order tables are listed in, so those referring to others are still dropped first
+	var ordered []Table
+	for _, t := range getTables() {
+		for _, tableToDrop := range tablesToDrop {
+			if t.Name() == tableToDrop.Name() {
+				ordered = append(ordered, t)
+				break
+			}
+		}
+	}
+
+	logging.Info(fmt.Sprintf("Wiping tables %s...", strings.Join(names, ", ")))
+	return dropTables(ordered)
+}
+
+//TableNames lists the name of every table
+func TableNames() []string {
+	var names []string
+	for _, t := range getTables() {
+		names = append(names, t.Name())
+	}
+	return names
+}
+
+func tableByName(name string) Table {
+	for _, t := range getTables() {
+		if t.Name() == name {
+			return t
+		}
+	}
+	return nil
+}
+
+func dropTables(tablesToDrop []Table) error {
+	//tables are dropped in reverse so nothing is dropped while other tables still refer to it
+	for i := len(tablesToDrop) - 1; i >= 0; i-- {
+		tableToDrop := tablesToDrop[i]
 		logging.Debug(fmt.Sprintf("Dropping %s table...", tableToDrop.Name()))
-		dropSmt := fmt.Sprintf("DROP TABLE %s;", tableToDrop.Name())
+		dropSmt := fmt.Sprintf("DROP TABLE IF EXISTS %s;", quoteIdentifier(tableToDrop.Name()))
 		_, err := Conn.Exec(dropSmt)
 		if err != nil {
 			return err
@@ -164,16 +260,24 @@ func createTables(db *sql.DB) {
 	for _, tableToCreate := range tablesToCreate {
 		bar.Add(1)
 
+		if tableExists(db, tableToCreate) {
+			logging.Debug(fmt.Sprintf("Table %s already exists, skipping...", tableToCreate.Name()))
+			bar.Add(1)
+			continue
+		}
+
 		tableCreateStatement := createStatement(tableToCreate)
 
 		logging.Debug(fmt.Sprintf("Creating table %s...", tableToCreate.Name()))
 		logging.Debug(fmt.Sprintf("Running create statement: \"%s\"", tableCreateStatement))
 
 		_, err := db.Exec(tableCreateStatement)
-		tableToCreate.Init(db)
 
 		if err != nil {
 			logging.Error(err.Error())
+		} else {
+			//only fill in default data for tables which have just been created
+			tableToCreate.Init(db)
 		}
 
 		bar.Add(1)
@@ -183,6 +287,7 @@ func createTables(db *sql.DB) {
 	println()
 }
 
+//getTables lists every table, those referred to by foreign keys come before the tables referring to them
 func getTables() []Table {
-	return []Table{&SystemInfoTable{}, &UsersTable{}, &GroupTable{}, &GroupMembershipTable{}, &PagesTable{}, &AuthSessionsTable{}}
+	return []Table{&SystemInfoTable{}, &UsersTable{}, TableOf(&UserRole{}), TableOf(&RolePermission{}), &GroupTable{}, TableOf(&GroupPermission{}), &GroupMembershipTable{}, &PagesTable{}, TableOf(&PageGroupPermission{}), TableOf(&PageRevision{}), &AuthSessionsTable{}, TableOf(&UserTwoFactor{}), TableOf(&RecoveryCode{}), TableOf(&LoginAttempt{}), TableOf(&AccountLock{}), TableOf(&APIToken{}), TableOf(&PasswordReset{}), TableOf(&Registration{}), TableOf(&SessionKey{}), TableOf(&Settings{})}
 }
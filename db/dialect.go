@@ -0,0 +1,58 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+//quoteIdentifier quotes a table or column name the way the connected database expects
+func quoteIdentifier(identifier string) string {
+	if Type == Postgres {
+		return fmt.Sprintf("\"%s\"", identifier)
+	}
+	return fmt.Sprintf("`%s`", identifier)
+}
+
+//rebind swaps the '?' placeholders statements are written with for the numbered '$n' ones Postgres expects,
+//question marks inside of quoted strings are left alone
+func rebind(query string) string {
+	if Type != Postgres {
+		return query
+	}
+
+	var rebound strings.Builder
+	var quote rune
+	n := 0
+
+	for _, c := range query {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '?':
+			n++
+			rebound.WriteString(fmt.Sprintf("$%d", n))
+			continue
+		}
+		rebound.WriteRune(c)
+	}
+
+	return rebound.String()
+}
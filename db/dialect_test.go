@@ -0,0 +1,75 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRebind(t *testing.T) {
+	defer withType(Postgres)()
+
+	rebound := rebind("SELECT * FROM `pages` WHERE title = '?' AND route = ? AND status IN (?, ?)")
+	expected := "SELECT * FROM `pages` WHERE title = '?' AND route = $1 AND status IN ($2, $3)"
+	if rebound != expected {
+		t.Errorf("Expected %s, got %s", expected, rebound)
+	}
+
+	Type = SQLITE
+	if query := "SELECT * FROM pages WHERE route = ?"; rebind(query) != query {
+		t.Errorf("Only Postgres placeholders should be rebound")
+	}
+}
+
+func TestPostgresCreateStatement(t *testing.T) {
+	defer withType(Postgres)()
+
+	statement := createStatement(&AuthSessionsTable{})
+
+	for _, expected := range []string{
+		`CREATE TABLE IF NOT EXISTS "authsessions" (`,
+		`"authsessionid" SERIAL PRIMARY KEY NOT NULL UNIQUE`,
+		`"createddatetime" BIGINT NOT NULL`,
+		`"sessionuuid" TEXT NOT NULL UNIQUE`,
+		`"remember" BOOLEAN NOT NULL`,
+	} {
+		if !strings.Contains(statement, expected) {
+			t.Errorf("Create statement %s should contain %s", statement, expected)
+		}
+	}
+
+	if strings.Contains(statement, "AUTOINCREMENT") || strings.Contains(statement, "`") {
+		t.Errorf("Create statement %s uses syntax Postgres doesn't understand", statement)
+	}
+}
+
+func TestPostgresQuery(t *testing.T) {
+	defer withType(Postgres)()
+
+	query, args, err := From(&PagesTable{}).Columns("route").Where(Equal("uuid", "page"), Equal("roleprotected", false)).Limit(1).buildSelect()
+	if err != nil {
+		t.Fatalf("Unexpected error building query: %v", err)
+	}
+
+	expected := `SELECT "route" FROM "pages" WHERE "uuid" = $1 AND "roleprotected" = $2 LIMIT $3`
+	if rebind(query) != expected {
+		t.Errorf("Expected query %s, got %s", expected, rebind(query))
+	}
+
+	if len(args) != 3 {
+		t.Errorf("Expected 3 arguments, got %v", args)
+	}
+}
@@ -13,3 +13,570 @@
 // limitations under the License.
 
 package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tacusci/logging"
+)
+
+//Migration describes a single versioned change to the database schema
+type Migration struct {
+	ID   int
+	Name string
+	Up   func(tx *sql.Tx) error
+	//Down is optional, migrations without one can't be rolled back past
+	Down func(tx *sql.Tx) error
+}
+
+//migrations is the ordered registry of all schema changes, new entries must be appended with the next ID
+var migrations = []Migration{
+	{
+		ID:   1,
+		Name: "Add schema version to system info",
+		Up: func(tx *sql.Tx) error {
+			return addColumn(tx, &SystemInfoTable{}, "schemaversion", "0")
+		},
+	},
+	{
+		ID:   2,
+		Name: "Add publication status to pages",
+		Up: func(tx *sql.Tx) error {
+			//existing pages were all live, so they stay published
+			if err := addColumn(tx, &PagesTable{}, "status", fmt.Sprintf("%d", PAGE_PUBLISHED)); err != nil {
+				return err
+			}
+			if err := addColumn(tx, &PagesTable{}, "publishdatetime", "0"); err != nil {
+				return err
+			}
+			return addColumn(tx, &PagesTable{}, "unpublishdatetime", "0")
+		},
+	},
+	{
+		ID:   3,
+		Name: "Add mandatory two factor authentication to groups",
+		Up: func(tx *sql.Tx) error {
+			return addColumn(tx, &GroupTable{}, "requiretwofactor", "0")
+		},
+	},
+	{
+		ID:   4,
+		Name: "Allow several sessions per user",
+		Up: func(tx *sql.Tx) error {
+			//the unique index on user UUID can't be dropped from SQLite tables, sessions are short lived
+			//anyway so it's simplest to log everyone out and recreate the table
+			ast := &AuthSessionsTable{}
+			if _, err := tx.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", quoteIdentifier(ast.Name()))); err != nil {
+				return err
+			}
+			_, err := tx.Exec(createStatement(ast))
+			return err
+		},
+	},
+	{
+		ID:   5,
+		Name: "Add remember me to sessions",
+		Up: func(tx *sql.Tx) error {
+			return addColumn(tx, &AuthSessionsTable{}, "remember", "0")
+		},
+	},
+	{
+		ID:   6,
+		Name: "Add foreign keys to group memberships and pages",
+		Up: func(tx *sql.Tx) error {
+			gmt := &GroupMembershipTable{}
+			pt := &PagesTable{}
+
+			//memberships of users or groups which are gone are useless, so they're removed
+			_, err := From(gmt).Where(Or(
+				NotInQuery("useruuid", From(&UsersTable{}).Columns("uuid")),
+				NotInQuery("groupuuid", From(&GroupTable{}).Columns("uuid")),
+			)).Delete(tx)
+			if err != nil {
+				return err
+			}
+
+			//pages are worth keeping though, the root user takes over any without an author
+			if err := reassignOrphanedPages(tx); err != nil {
+				return err
+			}
+
+			if err := addForeignKeys(tx, gmt); err != nil {
+				return err
+			}
+			return addForeignKeys(tx, pt)
+		},
+	},
+	{
+		ID:   7,
+		Name: "Let admins manage site settings",
+		Up: func(tx *sql.Tx) error {
+			return grantAdminsPermission(tx, PERM_SETTINGS_MANAGE)
+		},
+		Down: func(tx *sql.Tx) error {
+			_, err := From(TableOf(&GroupPermission{})).Where(Equal("permission", string(PERM_SETTINGS_MANAGE))).Delete(tx)
+			return err
+		},
+	},
+	{
+		ID:   8,
+		Name: "Add default group for registrations to settings",
+		Up: func(tx *sql.Tx) error {
+			return addColumn(tx, TableOf(&Settings{}), "defaultgroup", "'Users'")
+		},
+	},
+	{
+		ID:   9,
+		Name: "Let admins edit users",
+		Up: func(tx *sql.Tx) error {
+			return grantAdminsPermission(tx, PERM_USERS_EDIT)
+		},
+		Down: func(tx *sql.Tx) error {
+			_, err := From(TableOf(&GroupPermission{})).Where(Equal("permission", string(PERM_USERS_EDIT))).Delete(tx)
+			return err
+		},
+	},
+	{
+		ID:   10,
+		Name: "Add member role for self registered users",
+		Up: func(tx *sql.Tx) error {
+			//the roles table may have only just been created on setup with the member role in it
+			count, err := From(TableOf(&UserRole{})).Where(Equal("userroleid", int(MEMBER_USER))).Count(tx)
+			if err != nil || count > 0 {
+				return err
+			}
+			return Insert(tx, &UserRole{Userroleid: int(MEMBER_USER), Rolename: "Member"})
+		},
+	},
+	{
+		ID:   11,
+		Name: "Replace hex encoded session keys",
+		Up: func(tx *sql.Tx) error {
+			//cookies signed with the old keys can't be validated by the new ones, so everyone is logged out
+			skt := SessionKeysTable{}
+			return skt.ReplaceUndecodable(tx)
+		},
+	},
+	{
+		ID:   12,
+		Name: "Store API token scopes as text",
+		Up: func(tx *sql.Tx) error {
+			//every permission joined together is longer than a VARCHAR(125)
+			return changeColumnType(tx, TableOf(&APIToken{}), "scopes")
+		},
+	},
+}
+
+//grantAdminsPermission gives the admins group a permission added after their defaults were granted on setup,
+//unless the permissions table was only just created on setup and they've already got it
+func grantAdminsPermission(tx *sql.Tx, permission Permission) error {
+	gt := GroupTable{}
+	adminGroup, err := gt.SelectByTitle(tx, "Admins")
+	if err != nil || len(adminGroup.UUID) == 0 {
+		return err
+	}
+
+	granted, err := From(TableOf(&GroupPermission{})).Where(Equal("groupuuid", adminGroup.UUID), Equal("permission", string(permission))).Count(tx)
+	if err != nil || granted > 0 {
+		return err
+	}
+
+	return Insert(tx, &GroupPermission{
+		CreatedDateTime: time.Now().Unix(),
+		GroupUUID:       adminGroup.UUID,
+		Permission:      string(permission),
+	})
+}
+
+//sortedMigrations returns the registered migrations ordered by ID, making sure that no two share an ID
+func sortedMigrations() ([]Migration, error) {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	for i := 0; i < len(sorted); i++ {
+		if sorted[i].ID <= 0 {
+			return nil, fmt.Errorf("Migration '%s' has invalid ID %d", sorted[i].Name, sorted[i].ID)
+		}
+		if i > 0 && sorted[i].ID == sorted[i-1].ID {
+			return nil, fmt.Errorf("Migrations '%s' and '%s' share ID %d", sorted[i-1].Name, sorted[i].Name, sorted[i].ID)
+		}
+		if sorted[i].Up == nil {
+			return nil, fmt.Errorf("Migration %d '%s' has no up function", sorted[i].ID, sorted[i].Name)
+		}
+	}
+
+	return sorted, nil
+}
+
+//LatestSchemaVersion gets the ID of the newest registered migration
+func LatestSchemaVersion() int {
+	latest := 0
+	for _, m := range migrations {
+		if m.ID > latest {
+			latest = m.ID
+		}
+	}
+	return latest
+}
+
+//SchemaVersion reads the currently applied schema version from the system info table
+func SchemaVersion(db *sql.DB) (int, error) {
+	//databases created before migrations existed won't have the schema version column at all
+	exists, err := columnExists(db, &SystemInfoTable{}, "schemaversion")
+	if err != nil {
+		return 0, err
+	}
+
+	if !exists {
+		logging.Debug("Database has no schema version, assuming 0")
+		return 0, nil
+	}
+
+	rows, err := From(&SystemInfoTable{}).Columns("schemaversion").Query(db)
+	if err != nil {
+		return 0, err
+	}
+
+	defer rows.Close()
+
+	version := 0
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			return 0, err
+		}
+		if v > version {
+			version = v
+		}
+	}
+
+	return version, rows.Err()
+}
+
+//Migrate applies all pending migrations
+func Migrate(db *sql.DB) error {
+	return MigrateTo(db, LatestSchemaVersion())
+}
+
+//MigrateTo applies or rolls back migrations until the schema matches the target version
+func MigrateTo(db *sql.DB, target int) error {
+	if db == nil {
+		return fmt.Errorf("Not connected to a database")
+	}
+
+	sorted, err := sortedMigrations()
+	if err != nil {
+		return err
+	}
+
+	if target < 0 || target > LatestSchemaVersion() {
+		return fmt.Errorf("Unknown schema version %d, latest is %d", target, LatestSchemaVersion())
+	}
+
+	current, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	if current == target {
+		logging.Debug(fmt.Sprintf("Database schema already at version %d", current))
+		return nil
+	}
+
+	if current < target {
+		for _, m := range sorted {
+			if m.ID <= current || m.ID > target {
+				continue
+			}
+			logging.Info(fmt.Sprintf("Applying migration %d: %s...", m.ID, m.Name))
+			if err := runMigrationStep(db, m.Up, m.ID); err != nil {
+				return fmt.Errorf("Migration %d '%s' failed -> %s", m.ID, m.Name, err.Error())
+			}
+		}
+		return nil
+	}
+
+	for i := len(sorted) - 1; i >= 0; i-- {
+		m := sorted[i]
+		if m.ID > current || m.ID <= target {
+			continue
+		}
+		if m.Down == nil {
+			return fmt.Errorf("Migration %d '%s' can't be rolled back", m.ID, m.Name)
+		}
+
+		//the version to record after rolling back is the ID of the previous migration
+		previousID := 0
+		if i > 0 {
+			previousID = sorted[i-1].ID
+		}
+
+		logging.Info(fmt.Sprintf("Rolling back migration %d: %s...", m.ID, m.Name))
+		if err := runMigrationStep(db, m.Down, previousID); err != nil {
+			return fmt.Errorf("Rolling back migration %d '%s' failed -> %s", m.ID, m.Name, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func runMigrationStep(db *sql.DB, step func(tx *sql.Tx) error, resultingVersion int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := step(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := setSchemaVersion(tx, resultingVersion); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func setSchemaVersion(tx *sql.Tx, version int) error {
+	sit := SystemInfoTable{}
+	res, err := tx.Exec(rebind(fmt.Sprintf("UPDATE %s SET schemaversion = ?", sit.Name())), version)
+	if err != nil {
+		return err
+	}
+
+	numUpdated, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if numUpdated == 0 {
+		_, err = tx.Exec(rebind(sit.buildPreparedInsertStatement(&SystemInfo{})), VERSION, version)
+	}
+
+	return err
+}
+
+//addColumn adds a column described by the table struct to an already existing table. Tables which didn't exist
+//before are created from the struct and already have the column, so it's only added if it's missing
+func addColumn(tx *sql.Tx, t Table, columnName string, defaultValue string) error {
+	for _, field := range t.buildFields() {
+		if field.Name != columnName {
+			continue
+		}
+
+		exists, err := columnExists(tx, t, columnName)
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			logging.Debug(fmt.Sprintf("Table %s already has column %s, skipping...", t.Name(), columnName))
+			return nil
+		}
+
+		var alterStatement strings.Builder
+		alterStatement.WriteString(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", quoteIdentifier(t.Name()), quoteIdentifier(field.Name), field.Type))
+		//existing rows need a value to satisfy the not null constraint
+		if field.NotNull {
+			//Postgres booleans can't default to numbers
+			if field.Type == "BOOLEAN" && defaultValue == "0" {
+				defaultValue = "FALSE"
+			} else if field.Type == "BOOLEAN" && defaultValue == "1" {
+				defaultValue = "TRUE"
+			}
+			alterStatement.WriteString(fmt.Sprintf(" NOT NULL DEFAULT %s", defaultValue))
+		}
+
+		logging.Debug(fmt.Sprintf("Running alter statement: \"%s\"", alterStatement.String()))
+		_, err = tx.Exec(alterStatement.String())
+		return err
+	}
+
+	return fmt.Errorf("Table %s has no field %s", t.Name(), columnName)
+}
+
+//changeColumnType changes an existing column to the type now declared on the table struct
+func changeColumnType(tx *sql.Tx, t Table, columnName string) error {
+	for _, field := range t.buildFields() {
+		if field.Name != columnName {
+			continue
+		}
+
+		var alterStatement string
+		switch Type {
+		case MySQL:
+			alterStatement = fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s %s", quoteIdentifier(t.Name()), quoteIdentifier(field.Name), field.Type)
+			if field.NotNull {
+				alterStatement += " NOT NULL"
+			}
+		case Postgres:
+			alterStatement = fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s", quoteIdentifier(t.Name()), quoteIdentifier(field.Name), field.Type)
+		default:
+			//SQLite doesn't enforce column types or lengths, so there's nothing to change
+			return nil
+		}
+
+		logging.Debug(fmt.Sprintf("Running alter statement: \"%s\"", alterStatement))
+		_, err := tx.Exec(alterStatement)
+		return err
+	}
+
+	return fmt.Errorf("Table %s has no field %s", t.Name(), columnName)
+}
+
+//addForeignKeys adds the foreign keys declared on the table struct to an already existing table
+func addForeignKeys(tx *sql.Tx, t Table) error {
+	//SQLite can't add constraints to existing tables, so the table is recreated from the struct instead
+	if Type == SQLITE {
+		return rebuildTable(tx, t)
+	}
+
+	for _, field := range t.buildFields() {
+		if field.ForeignKey == nil {
+			continue
+		}
+
+		alterStatement := fmt.Sprintf("ALTER TABLE %s ADD %s", quoteIdentifier(t.Name()), foreignKeyConstraint(t, field))
+		logging.Debug(fmt.Sprintf("Running alter statement: \"%s\"", alterStatement))
+		if _, err := tx.Exec(alterStatement); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//rebuildTable recreates a SQLite table to match its table struct, copying over the values of the columns both share
+func rebuildTable(tx *sql.Tx, t Table) error {
+	oldName := t.Name() + "_old"
+
+	if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s RENAME TO %s", quoteIdentifier(t.Name()), quoteIdentifier(oldName))); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", quoteIdentifier(oldName)))
+	if err != nil {
+		return err
+	}
+
+	existingColumns := map[string]bool{}
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, columnType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk); err != nil {
+			rows.Close()
+			return err
+		}
+		existingColumns[name] = true
+	}
+	rows.Close()
+
+	if _, err := tx.Exec(createStatement(t)); err != nil {
+		return err
+	}
+
+	columns := make([]string, 0)
+	for _, field := range t.buildFields() {
+		if existingColumns[field.Name] {
+			columns = append(columns, quoteIdentifier(field.Name))
+		}
+	}
+
+	copyStatement := fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s", quoteIdentifier(t.Name()), strings.Join(columns, ", "), strings.Join(columns, ", "), quoteIdentifier(oldName))
+	logging.Debug(fmt.Sprintf("Running copy statement: \"%s\"", copyStatement))
+	if _, err := tx.Exec(copyStatement); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("DROP TABLE %s", quoteIdentifier(oldName)))
+	return err
+}
+
+//reassignOrphanedPages hands the pages of authors who no longer exist over to the root user
+func reassignOrphanedPages(tx *sql.Tx) error {
+	pt := &PagesTable{}
+	ut := &UsersTable{}
+
+	numOrphaned, err := From(pt).Where(NotInQuery("authoruuid", From(ut).Columns("uuid"))).Count(tx)
+	if err != nil || numOrphaned == 0 {
+		return err
+	}
+
+	rootUser := &User{}
+	if err := Get(tx, rootUser, Equal("userroleid", int(ROOT_USER))); err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("%d pages have authors which don't exist, and there's no root user to give them to", numOrphaned)
+		}
+		return err
+	}
+
+	logging.Info(fmt.Sprintf("Giving %d pages with missing authors to root user %s", numOrphaned, rootUser.Username))
+
+	updateStatement := fmt.Sprintf("UPDATE %s SET authoruuid = ? WHERE authoruuid NOT IN (SELECT uuid FROM %s)", quoteIdentifier(pt.Name()), quoteIdentifier(ut.Name()))
+	_, err = tx.Exec(rebind(updateStatement), rootUser.UUID)
+	return err
+}
+
+//tableExists checks whether a table has already been created in the connected schema
+func tableExists(db *sql.DB, t Table) bool {
+	var query string
+	var args []interface{}
+
+	switch Type {
+	case MySQL:
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = ?"
+		args = []interface{}{SchemaName, t.Name()}
+	case SQLITE:
+		query = "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+		args = []interface{}{t.Name()}
+	case Postgres:
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = $1"
+		args = []interface{}{t.Name()}
+	default:
+		return false
+	}
+
+	var count int
+	if err := db.QueryRow(query, args...).Scan(&count); err != nil {
+		logging.Error(err.Error())
+		return false
+	}
+
+	return count > 0
+}
+
+//columnExists checks whether the table in the database has the column, which it can't if the table doesn't exist
+func columnExists(db Querier, t Table, columnName string) (bool, error) {
+	var query string
+	var args []interface{}
+
+	switch Type {
+	case MySQL:
+		query = "SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = ? AND table_name = ? AND column_name = ?"
+		args = []interface{}{SchemaName, t.Name(), columnName}
+	case SQLITE:
+		query = "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?"
+		args = []interface{}{t.Name(), columnName}
+	case Postgres:
+		query = "SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = $1 AND column_name = $2"
+		args = []interface{}{t.Name(), columnName}
+	default:
+		return false, fmt.Errorf("Unknown database type %d", Type)
+	}
+
+	var count int
+	if err := db.QueryRow(query, args...).Scan(&count); err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
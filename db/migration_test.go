@@ -0,0 +1,202 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+)
+
+//the tests run against SQLite unless BERRYCMS_TEST_DB picks another server, BERRYCMS_TEST_DSN then says where it is,
+//e.g. BERRYCMS_TEST_DB=postgres BERRYCMS_TEST_DSN="postgres://postgres@localhost?sslmode=disable"
+func init() {
+	switch os.Getenv("BERRYCMS_TEST_DB") {
+	case "mysql":
+		Connect(MySQL, os.Getenv("BERRYCMS_TEST_DSN"), "berrycmstesting")
+	case "postgres":
+		Connect(Postgres, os.Getenv("BERRYCMS_TEST_DSN"), "berrycmstesting")
+	default:
+		Connect(SQLITE, "./berrycmstesting.db", "")
+	}
+	Wipe()
+	Setup()
+}
+
+func TestFreshSchemaIsLatestVersion(t *testing.T) {
+	version, err := SchemaVersion(Conn)
+
+	if err != nil {
+		t.Errorf("Error reading schema version: %v", err)
+	}
+
+	if version != LatestSchemaVersion() {
+		t.Errorf("Freshly created schema should be at version %d, got %d", LatestSchemaVersion(), version)
+	}
+
+	if err := Migrate(Conn); err != nil {
+		t.Errorf("Migrating an up to date schema should do nothing, got error: %v", err)
+	}
+}
+
+func TestSchemaVersionReportsErrors(t *testing.T) {
+	closed, err := sql.Open(Type.DriverName(), "")
+	if err != nil {
+		t.Skipf("Unable to open a second database handle: %v", err)
+	}
+	closed.Close()
+
+	//only a database without the version column is at version 0, one that can't be read mustn't be migrated from scratch
+	if _, err := SchemaVersion(closed); err == nil {
+		t.Errorf("Reading the schema version of an unusable database should fail")
+	}
+}
+
+//baselineSchema the SQLite tables and default rows of a database created before migrations existed, at schema version 0
+var baselineSchema = []string{
+	"CREATE TABLE `systeminfo` (`version` VARCHAR(125))",
+	"CREATE TABLE `users` (`userid` INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL UNIQUE,`createddatetime` BIGINT NOT NULL,`userroleid` INTEGER NOT NULL,`uuid` VARCHAR(125) NOT NULL UNIQUE,`username` VARCHAR(125) NOT NULL UNIQUE,`authhash` VARCHAR(125) NOT NULL,`firstname` VARCHAR(125) NOT NULL,`lastname` VARCHAR(125) NOT NULL,`email` VARCHAR(125) NOT NULL UNIQUE)",
+	"CREATE TABLE `groups` (`groupid` INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL UNIQUE,`createddatetime` BIGINT NOT NULL,`uuid` VARCHAR(125) NOT NULL UNIQUE,`title` VARCHAR(125) NOT NULL UNIQUE)",
+	"CREATE TABLE `groupmemberships` (`groupmembershipid` INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL UNIQUE,`createddatetime` INT64 NOT NULL,`groupuuid` VARCHAR(125) NOT NULL,`useruuid` VARCHAR(125) NOT NULL)",
+	"CREATE TABLE `pages` (`pageid` INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL UNIQUE,`createddatetime` BIGINT NOT NULL,`uuid` VARCHAR(125) NOT NULL UNIQUE,`roleprotected` BIT(1) NOT NULL,`authoruuid` VARCHAR(125) NOT NULL,`title` VARCHAR(125) NOT NULL UNIQUE,`route` VARCHAR(125) NOT NULL UNIQUE,`content` VARCHAR(125) NOT NULL)",
+	"CREATE TABLE `authsessions` (`authsessionid` INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL UNIQUE,`createddatetime` BIGINT NOT NULL,`lastactivedatetime` BIGINT NOT NULL,`useruuid` VARCHAR(125) NOT NULL UNIQUE,`sessionuuid` VARCHAR(125) NOT NULL UNIQUE)",
+	"INSERT INTO `systeminfo` (`version`) VALUES ('v0.0.1a')",
+	"INSERT INTO `groups` (`createddatetime`, `uuid`, `title`) VALUES (0, 'baseline-admins', 'Admins'), (0, 'baseline-moderators', 'Moderators'), (0, 'baseline-users', 'Users')",
+}
+
+//upgradeFrom replaces the test database with one made by the statements, then starts it up the way the server does
+func upgradeFrom(t *testing.T, statements []string) {
+	if Type != SQLITE {
+		t.Skip("Old schemas are only kept for SQLite")
+	}
+
+	if err := Wipe(); err != nil {
+		t.Fatalf("Unable to wipe database: %v", err)
+	}
+
+	for _, statement := range statements {
+		if _, err := Conn.Exec(statement); err != nil {
+			t.Fatalf("Unable to create old schema: %v", err)
+		}
+	}
+
+	//tables which didn't exist yet are created from today's structs before migrating, so migrations have to cope with them
+	Setup()
+	if err := Migrate(Conn); err != nil {
+		t.Fatalf("Unable to migrate old database: %v", err)
+	}
+
+	version, err := SchemaVersion(Conn)
+	if err != nil || version != LatestSchemaVersion() {
+		t.Errorf("Upgraded database should be at version %d, got %d: %v", LatestSchemaVersion(), version, err)
+	}
+}
+
+func TestMigrateFromBaseline(t *testing.T) {
+	defer func() {
+		Wipe()
+		Setup()
+	}()
+
+	upgradeFrom(t, baselineSchema)
+
+	gt := GroupTable{}
+	adminGroup, _ := gt.SelectByTitle(Conn, "Admins")
+	for _, permission := range []Permission{PERM_SETTINGS_MANAGE, PERM_USERS_EDIT} {
+		granted, _ := From(TableOf(&GroupPermission{})).Where(Equal("groupuuid", adminGroup.UUID), Equal("permission", string(permission))).Count(Conn)
+		if granted != 1 {
+			t.Errorf("Admins should have been granted %s once, got %d", permission, granted)
+		}
+	}
+
+	if count, _ := From(TableOf(&UserRole{})).Where(Equal("userroleid", int(MEMBER_USER))).Count(Conn); count != 1 {
+		t.Errorf("Upgraded database should have the member role once, got %d", count)
+	}
+}
+
+//preSettingsSchema the SQLite tables and default rows of a database at schema version 5, before site settings existed
+var preSettingsSchema = []string{
+	"CREATE TABLE `systeminfo` (`version` VARCHAR(125) NOT NULL,`schemaversion` INTEGER NOT NULL)",
+	"CREATE TABLE `users` (`userid` INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL UNIQUE,`createddatetime` BIGINT NOT NULL,`userroleid` INTEGER NOT NULL,`uuid` VARCHAR(125) NOT NULL UNIQUE,`username` VARCHAR(125) NOT NULL UNIQUE,`authhash` VARCHAR(125) NOT NULL,`firstname` VARCHAR(125) NOT NULL,`lastname` VARCHAR(125) NOT NULL,`email` VARCHAR(125) NOT NULL UNIQUE)",
+	"CREATE TABLE `userroles` (`userroleid` INTEGER PRIMARY KEY NOT NULL UNIQUE,`rolename` VARCHAR(125) NOT NULL UNIQUE)",
+	"CREATE TABLE `rolepermissions` (`rolepermissionid` INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL UNIQUE,`userroleid` INTEGER NOT NULL,`permission` VARCHAR(125) NOT NULL)",
+	"CREATE TABLE `groups` (`groupid` INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL UNIQUE,`createddatetime` BIGINT NOT NULL,`uuid` VARCHAR(125) NOT NULL UNIQUE,`title` VARCHAR(125) NOT NULL UNIQUE,`requiretwofactor` BIT(1) NOT NULL)",
+	"CREATE TABLE `grouppermissions` (`grouppermissionid` INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL UNIQUE,`createddatetime` BIGINT NOT NULL,`groupuuid` VARCHAR(125) NOT NULL,`permission` VARCHAR(125) NOT NULL)",
+	"CREATE TABLE `groupmemberships` (`groupmembershipid` INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL UNIQUE,`createddatetime` INTEGER NOT NULL,`groupuuid` VARCHAR(125) NOT NULL,`useruuid` VARCHAR(125) NOT NULL)",
+	"CREATE TABLE `pages` (`pageid` INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL UNIQUE,`createddatetime` BIGINT NOT NULL,`uuid` VARCHAR(125) NOT NULL UNIQUE,`roleprotected` BIT(1) NOT NULL,`authoruuid` VARCHAR(125) NOT NULL,`title` VARCHAR(125) NOT NULL UNIQUE,`route` VARCHAR(125) NOT NULL UNIQUE,`content` VARCHAR(125) NOT NULL,`status` INTEGER NOT NULL,`publishdatetime` BIGINT NOT NULL,`unpublishdatetime` BIGINT NOT NULL)",
+	"CREATE TABLE `pagegrouppermissions` (`pagegrouppermissionid` INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL UNIQUE,`createddatetime` BIGINT NOT NULL,`pageuuid` VARCHAR(125) NOT NULL,`groupuuid` VARCHAR(125) NOT NULL,`permission` INTEGER NOT NULL)",
+	"CREATE TABLE `pagerevisions` (`pagerevisionid` INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL UNIQUE,`createddatetime` BIGINT NOT NULL,`uuid` VARCHAR(125) NOT NULL UNIQUE,`pageuuid` VARCHAR(125) NOT NULL,`authoruuid` VARCHAR(125) NOT NULL,`title` VARCHAR(125) NOT NULL,`route` VARCHAR(125) NOT NULL,`content` VARCHAR(125) NOT NULL)",
+	"CREATE TABLE `authsessions` (`authsessionid` INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL UNIQUE,`createddatetime` BIGINT NOT NULL,`lastactivedatetime` BIGINT NOT NULL,`useruuid` VARCHAR(125) NOT NULL,`sessionuuid` VARCHAR(125) NOT NULL UNIQUE,`ipaddress` VARCHAR(125) NOT NULL,`useragent` VARCHAR(125) NOT NULL,`remember` BIT(1) NOT NULL)",
+	"CREATE TABLE `usertwofactor` (`usertwofactorid` INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL UNIQUE,`createddatetime` BIGINT NOT NULL,`useruuid` VARCHAR(125) NOT NULL UNIQUE,`secret` VARCHAR(125) NOT NULL,`enabled` BIT(1) NOT NULL,`lastusedstep` INTEGER NOT NULL)",
+	"CREATE TABLE `recoverycodes` (`recoverycodeid` INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL UNIQUE,`createddatetime` BIGINT NOT NULL,`useruuid` VARCHAR(125) NOT NULL,`codehash` VARCHAR(125) NOT NULL UNIQUE)",
+	"CREATE TABLE `loginattempts` (`loginattemptid` INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL UNIQUE,`createddatetime` BIGINT NOT NULL,`username` VARCHAR(125) NOT NULL,`ipaddress` VARCHAR(125) NOT NULL)",
+	"CREATE TABLE `accountlocks` (`accountlockid` INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL UNIQUE,`createddatetime` BIGINT NOT NULL,`useruuid` VARCHAR(125) NOT NULL,`ipaddress` VARCHAR(125) NOT NULL,`lockeduntil` INTEGER NOT NULL,`cleareddatetime` INTEGER NOT NULL,`clearedbyuuid` VARCHAR(125) NOT NULL)",
+	"CREATE TABLE `apitokens` (`apitokenid` INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL UNIQUE,`createddatetime` BIGINT NOT NULL,`uuid` VARCHAR(125) NOT NULL UNIQUE,`useruuid` VARCHAR(125) NOT NULL,`title` VARCHAR(125) NOT NULL,`tokenhash` VARCHAR(125) NOT NULL UNIQUE,`scopes` VARCHAR(125) NOT NULL,`expiresdatetime` BIGINT NOT NULL,`lastuseddatetime` BIGINT NOT NULL)",
+	"CREATE TABLE `sessionkeys` (`sessionkeyid` INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL UNIQUE,`createddatetime` BIGINT NOT NULL,`hashkey` VARCHAR(125) NOT NULL,`blockkey` VARCHAR(125) NOT NULL)",
+	"INSERT INTO `systeminfo` (`version`, `schemaversion`) VALUES ('v0.0.1a', 5)",
+	"INSERT INTO `groups` (`createddatetime`, `uuid`, `title`, `requiretwofactor`) VALUES (0, 'presettings-admins', 'Admins', 0), (0, 'presettings-moderators', 'Moderators', 0), (0, 'presettings-users', 'Users', 0)",
+}
+
+func TestMigrateFromBeforeSettings(t *testing.T) {
+	defer func() {
+		Wipe()
+		Setup()
+	}()
+
+	upgradeFrom(t, preSettingsSchema)
+
+	st := SettingsTable{}
+	settings, err := st.Select(Conn)
+	if err != nil {
+		t.Fatalf("Unable to select settings: %v", err)
+	}
+
+	if settings.DefaultGroup != DefaultSettings.DefaultGroup {
+		t.Errorf("Settings created while upgrading should have the default group %s, got %s", DefaultSettings.DefaultGroup, settings.DefaultGroup)
+	}
+}
+
+func TestMigrateToUnknownVersion(t *testing.T) {
+	if err := MigrateTo(Conn, LatestSchemaVersion()+1); err == nil {
+		t.Errorf("Migrating to a version which doesn't exist should fail")
+	}
+}
+
+func TestSortedMigrationsDuplicateID(t *testing.T) {
+	existingMigrations := migrations
+	defer func() { migrations = existingMigrations }()
+
+	noop := func(tx *sql.Tx) error { return nil }
+
+	migrations = []Migration{
+		{ID: 2, Name: "second", Up: noop},
+		{ID: 1, Name: "first", Up: noop},
+	}
+
+	sorted, err := sortedMigrations()
+	if err != nil {
+		t.Fatalf("Unexpected error sorting migrations: %v", err)
+	}
+
+	if sorted[0].ID != 1 || sorted[1].ID != 2 {
+		t.Errorf("Migrations not sorted by ID")
+	}
+
+	migrations = append(migrations, Migration{ID: 2, Name: "duplicate", Up: noop})
+
+	if _, err := sortedMigrations(); err == nil {
+		t.Errorf("Migrations sharing an ID should fail to sort")
+	}
+}
@@ -17,26 +17,140 @@ package db
 import (
 	"bytes"
 	"database/sql"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"net/url"
 	"reflect"
+	"regexp"
 	"strings"
 	"time"
 
 	"github.com/gofrs/uuid"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/tacusci/berrycms/util"
 	"github.com/tacusci/logging"
 )
 
 type UsersRoleFlag int
 
 const (
-	ROOT_USER UsersRoleFlag = 2
-	MOD_USER  UsersRoleFlag = 3
-	REG_USER  UsersRoleFlag = 4
+	ROOT_USER   UsersRoleFlag = 2
+	MOD_USER    UsersRoleFlag = 3
+	REG_USER    UsersRoleFlag = 4
+	MEMBER_USER UsersRoleFlag = 5
 )
 
+//Permission named action that can be granted to user roles and groups
+type Permission string
+
+const (
+	PERM_NONE            Permission = ""
+	PERM_ADMIN_VIEW      Permission = "admin.view"
+	PERM_USERS_VIEW      Permission = "users.view"
+	PERM_USERS_CREATE    Permission = "users.create"
+	PERM_USERS_EDIT      Permission = "users.edit"
+	PERM_USERS_DELETE    Permission = "users.delete"
+	PERM_PAGES_VIEW      Permission = "pages.view"
+	PERM_PAGES_CREATE    Permission = "pages.create"
+	PERM_PAGES_EDIT      Permission = "pages.edit"
+	PERM_PAGES_DELETE    Permission = "pages.delete"
+	PERM_GROUPS_MANAGE   Permission = "groups.manage"
+	PERM_SETTINGS_MANAGE Permission = "settings.manage"
+)
+
+//AllPermissions every permission which can be granted, in the order they're listed
+var AllPermissions = []Permission{
+	PERM_ADMIN_VIEW,
+	PERM_USERS_VIEW,
+	PERM_USERS_CREATE,
+	PERM_USERS_EDIT,
+	PERM_USERS_DELETE,
+	PERM_PAGES_VIEW,
+	PERM_PAGES_CREATE,
+	PERM_PAGES_EDIT,
+	PERM_PAGES_DELETE,
+	PERM_GROUPS_MANAGE,
+	PERM_SETTINGS_MANAGE,
+}
+
+//ParsePermission checks that the name is of a known permission
+func ParsePermission(s string) (Permission, error) {
+	for _, p := range AllPermissions {
+		if string(p) == s {
+			return p, nil
+		}
+	}
+	return PERM_NONE, fmt.Errorf("Unknown permission %s", s)
+}
+
+//PageStatus whether a page is publicly reachable, or will be at some point
+type PageStatus int
+
+const (
+	PAGE_PUBLISHED PageStatus = 0
+	PAGE_DRAFT     PageStatus = 1
+	PAGE_SCHEDULED PageStatus = 2
+)
+
+func (ps PageStatus) String() string {
+	switch ps {
+	case PAGE_DRAFT:
+		return "draft"
+	case PAGE_SCHEDULED:
+		return "scheduled"
+	default:
+		return "published"
+	}
+}
+
+//PagePermission level of access a group has been granted to a page
+type PagePermission int
+
+const (
+	PAGE_NO_ACCESS PagePermission = 0
+	PAGE_READ      PagePermission = 1
+	PAGE_EDIT      PagePermission = 2
+)
+
+func (pp PagePermission) String() string {
+	switch pp {
+	case PAGE_READ:
+		return "read"
+	case PAGE_EDIT:
+		return "edit"
+	default:
+		return ""
+	}
+}
+
+//ParsePagePermission converts the name of a page permission back into its flag, blank means no access
+func ParsePagePermission(s string) (PagePermission, error) {
+	switch strings.ToLower(s) {
+	case "":
+		return PAGE_NO_ACCESS, nil
+	case "read":
+		return PAGE_READ, nil
+	case "edit":
+		return PAGE_EDIT, nil
+	}
+	return PAGE_NO_ACCESS, fmt.Errorf("Unknown page permission %s", s)
+}
+
+//ParsePageStatus converts the name of a page status back into its flag
+func ParsePageStatus(s string) (PageStatus, error) {
+	switch strings.ToLower(s) {
+	case "published":
+		return PAGE_PUBLISHED, nil
+	case "draft":
+		return PAGE_DRAFT, nil
+	case "scheduled":
+		return PAGE_SCHEDULED, nil
+	}
+	return PAGE_DRAFT, fmt.Errorf("Unknown page status %s", s)
+}
+
 //Field interface to describe a table field and all of its attributes
 type Field struct {
 	fieldTag      reflect.StructTag
@@ -45,15 +159,78 @@ type Field struct {
 	PrimaryKey    bool
 	UniqueIndex   bool
 	IsDateTime    bool
+	IsText        bool
 	NotNull       bool
+	ForeignKey    *ForeignKey
 	Name          string
 	Type          string
 	Value         interface{}
 }
 
+//ForeignKey the table column a field refers to and what happens to the row when the referenced one is deleted
+type ForeignKey struct {
+	Table    string
+	Column   string
+	OnDelete string
+}
+
+//foreignKeyActions ON DELETE behaviours which can be given in a field's tag
+var foreignKeyActions = []string{"CASCADE", "SET NULL", "RESTRICT", "NO ACTION"}
+
+//parseForeignKey reads a foreign key declared as FK(table.column,ACTION) out of the tag, the action defaults to RESTRICT
+func parseForeignKey(fieldTagString string) (*ForeignKey, error) {
+	start := strings.Index(fieldTagString, "FK(")
+	if start == -1 {
+		return nil, nil
+	}
+
+	end := strings.Index(fieldTagString[start:], ")")
+	if end == -1 {
+		return nil, fmt.Errorf("Foreign key in tag '%s' is missing its closing bracket", fieldTagString)
+	}
+
+	parts := strings.Split(fieldTagString[start+len("FK("):start+end], ",")
+	if len(parts) > 2 {
+		return nil, fmt.Errorf("Foreign key in tag '%s' has too many parts", fieldTagString)
+	}
+
+	reference := strings.Split(strings.TrimSpace(parts[0]), ".")
+	if len(reference) != 2 || len(reference[0]) == 0 || len(reference[1]) == 0 {
+		return nil, fmt.Errorf("Foreign key in tag '%s' must refer to a table.column", fieldTagString)
+	}
+
+	fk := &ForeignKey{Table: reference[0], Column: reference[1], OnDelete: "RESTRICT"}
+
+	if len(parts) == 2 {
+		fk.OnDelete = ""
+		action := strings.ToUpper(strings.TrimSpace(parts[1]))
+		for _, a := range foreignKeyActions {
+			if a == action {
+				fk.OnDelete = a
+			}
+		}
+		if fk.OnDelete == "" {
+			return nil, fmt.Errorf("Foreign key in tag '%s' has unknown on delete action %s", fieldTagString, parts[1])
+		}
+	}
+
+	return fk, nil
+}
+
 func (f *Field) parseFlagTags() {
 	fieldTagString := f.fieldTag.Get("tbl")
 
+	fk, err := parseForeignKey(fieldTagString)
+	if err != nil {
+		logging.ErrorAndExit(err.Error())
+	}
+	f.ForeignKey = fk
+
+	//the referenced table and column names mustn't be mistaken for flags
+	if fk != nil {
+		fieldTagString = fieldTagString[:strings.Index(fieldTagString, "FK(")]
+	}
+
 	if strings.Contains(fieldTagString, "PK") {
 		f.PrimaryKey = true
 	}
@@ -73,29 +250,41 @@ func (f *Field) parseFlagTags() {
 	if strings.Contains(fieldTagString, "DT") {
 		f.IsDateTime = true
 	}
+
+	if strings.Contains(fieldTagString, "TX") {
+		f.IsText = true
+	}
 }
 
 func (f *Field) translateTypes() {
 	switch f.Type {
 	case "string":
-		f.Type = "VARCHAR(125)"
+		if Type == Postgres || f.IsText {
+			//Postgres enforces VARCHAR lengths, which page content easily goes past
+			f.Type = "TEXT"
+		} else {
+			f.Type = "VARCHAR(125)"
+		}
 	case "bool":
-		//f.Type = "BOOLEAN"
-		f.Type = "BIT(1)"
+		if Type == Postgres {
+			f.Type = "BOOLEAN"
+		} else {
+			f.Type = "BIT(1)"
+		}
 	case "int":
 		if Type == MySQL {
 			f.Type = "INT"
-		} else if Type == SQLITE {
+		} else if Type == SQLITE || Type == Postgres {
 			f.Type = "INTEGER"
 		}
 	case "uint32":
 		if Type == MySQL {
 			f.Type = "INT"
-		} else if Type == SQLITE {
+		} else if Type == SQLITE || Type == Postgres {
 			f.Type = "INTEGER"
 		}
-	case "uint64":
-		if Type == MySQL {
+	case "int64", "uint64":
+		if Type == MySQL || Type == Postgres {
 			f.Type = "BIGINT"
 		} else if Type == SQLITE {
 			f.Type = "INTEGER"
@@ -106,6 +295,15 @@ func (f *Field) translateTypes() {
 		f.Type = "BIGINT"
 	}
 
+	//Postgres has no auto increment attribute, serial columns take their values from a sequence instead
+	if f.AutoIncrement && Type == Postgres {
+		if f.Type == "BIGINT" {
+			f.Type = "BIGSERIAL"
+		} else {
+			f.Type = "SERIAL"
+		}
+	}
+
 	f.Type = strings.ToUpper(f.Type)
 }
 
@@ -155,28 +353,18 @@ func (ut *UsersTable) Name() string { return "users" }
 
 //RootUserExists checks if at least one root user exists
 func (ut *UsersTable) RootUserExists() bool {
-	rows, err := ut.Select(Conn, "userid", fmt.Sprintf("userroleid = %d", ROOT_USER))
+	count, err := From(ut).Where(Equal("userroleid", int(ROOT_USER))).Count(Conn)
 
 	if err != nil {
 		logging.Error(err.Error())
 		return false
 	}
 
-	defer rows.Close()
-
-	var i = 0
-	for rows.Next() {
-		i++
-		if i > 0 {
-			break
-		}
-	}
-
-	return i > 0
+	return count > 0
 }
 
 //InsertMultiple takes a slice of user structs and passes them all to 'Insert'
-func (ut *UsersTable) InsertMultiple(db *sql.DB, us []*User) error {
+func (ut *UsersTable) InsertMultiple(db Querier, us []*User) error {
 	if len(us) == 0 {
 		return errors.New("At least one user must be in list")
 	}
@@ -218,13 +406,13 @@ func (ut *UsersTable) InsertMultiple(db *sql.DB, us []*User) error {
 		valuesToInsert = append(valuesToInsert, u.Email)
 	}
 	logging.Debug(fmt.Sprintf("Running insert statement %s", insertStatement))
-	_, err := db.Exec(insertStatement, valuesToInsert...)
+	_, err := db.Exec(rebind(insertStatement), valuesToInsert...)
 
 	return err
 }
 
 //Insert adds user struct to users table, it also sets default values
-func (ut *UsersTable) Insert(db *sql.DB, u *User) error {
+func (ut *UsersTable) Insert(db Querier, u *User) error {
 	//TODO: change this to simply call validate()
 	if u.UUID != "" {
 		return fmt.Errorf("User to insert already has UUID %s", u.UUID)
@@ -245,10 +433,7 @@ func (ut *UsersTable) Insert(db *sql.DB, u *User) error {
 		if u.UserroleId == 0 {
 			u.UserroleId = 3
 		}
-		insertStatement := ut.buildPreparedInsertStatement(u)
-		logging.Debug(fmt.Sprintf("Running insert statement %s", insertStatement))
-		_, err = db.Exec(insertStatement, u.CreatedDateTime, u.UserroleId, u.UUID, u.Username, u.AuthHash, u.FirstName, u.LastName, u.Email)
-		if err != nil {
+		if err := Insert(db, u); err != nil {
 			return err
 		}
 	}
@@ -256,89 +441,145 @@ func (ut *UsersTable) Insert(db *sql.DB, u *User) error {
 	return nil
 }
 
-//Select returns table rows from a select using the passed where condition
-func (ut *UsersTable) Select(db *sql.DB, whatToSelect string, whereClause string) (*sql.Rows, error) {
-	if len(whereClause) > 0 {
-		return db.Query(fmt.Sprintf("SELECT %s FROM %s WHERE %s", whatToSelect, ut.Name(), whereClause))
-	} else {
-		return db.Query(fmt.Sprintf("SELECT %s FROM %s", whatToSelect, ut.Name()))
+func (ut *UsersTable) SelectRootUser(db Querier) (*User, error) {
+	u := &User{}
+	if err := Get(db, u, Equal("userroleid", int(ROOT_USER))); err != nil && err != sql.ErrNoRows {
+		return nil, err
 	}
+
+	return u, nil
 }
 
-func (ut *UsersTable) SelectRootUser(db *sql.DB) (*User, error) {
+func (ut *UsersTable) SelectByUsername(db Querier, username string) (*User, error) {
 	u := &User{}
-	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE userroleid = %d", ut.Name(), int(ROOT_USER)))
-
-	if err != nil {
+	if err := Get(db, u, Equal("username", username)); err != nil && err != sql.ErrNoRows {
 		return nil, err
 	}
 
-	defer rows.Close()
+	return u, nil
+}
 
-	for rows.Next() {
-		err = rows.Scan(&u.UserId, &u.CreatedDateTime, &u.UserroleId, &u.UUID, &u.Username, &u.AuthHash, &u.FirstName, &u.LastName, &u.Email)
-		if err != nil {
-			return nil, err
-		}
+func (ut *UsersTable) SelectByEmail(db Querier, email string) (*User, error) {
+	u := &User{}
+	if err := Get(db, u, Equal("email", email)); err != nil && err != sql.ErrNoRows {
+		return nil, err
 	}
 
 	return u, nil
 }
 
-func (ut *UsersTable) SelectByUsername(db *sql.DB, username string) (*User, error) {
+func (ut *UsersTable) SelectByUUID(db Querier, uuid string) (*User, error) {
 	u := &User{}
-	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE username = '%s'", ut.Name(), username))
+	if err := Get(db, u, Equal("uuid", uuid)); err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+func (ut *UsersTable) DeleteByUUID(db Querier, uuid string) (int64, error) {
+	return From(ut).Where(Equal("uuid", uuid)).Delete(db)
+}
+
+//Update saves changes to the user's details, refusing a username or email address somebody else already has
+func (ut *UsersTable) Update(db Querier, u *User) error {
+	if len(u.UUID) == 0 {
+		return errors.New("User to update has no UUID")
+	}
 
+	if err := u.Validate(); err != nil {
+		return err
+	}
+
+	existing, err := ut.SelectByUsername(db, u.Username)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	defer rows.Close()
+	if len(existing.UUID) > 0 && existing.UUID != u.UUID {
+		return fmt.Errorf("Username %s is already taken", u.Username)
+	}
 
-	for rows.Next() {
-		err = rows.Scan(&u.UserId, &u.CreatedDateTime, &u.UserroleId, &u.UUID, &u.Username, &u.AuthHash, &u.FirstName, &u.LastName, &u.Email)
-		if err != nil {
-			return nil, err
-		}
+	existing, err = ut.SelectByEmail(db, u.Email)
+	if err != nil {
+		return err
 	}
 
-	return u, nil
+	if len(existing.UUID) > 0 && existing.UUID != u.UUID {
+		return fmt.Errorf("Email address %s is already in use", u.Email)
+	}
+
+	return Update(db, u)
 }
 
-func (ut *UsersTable) SelectByUUID(db *sql.DB, uuid string) (*User, error) {
-	u := &User{}
-	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE uuid = '%s'", ut.Name(), uuid))
+//ResetPassword sets the user's new password hash, then unlocks their account and signs them out everywhere,
+//so that anybody who'd got into the account can't stay in it. Their other password resets can't be used after this
+func (ut *UsersTable) ResetPassword(db Querier, u *User, authHash string, clearedByUUID string, now int64) error {
+	u.AuthHash = authHash
+	if err := Update(db, u); err != nil {
+		return err
+	}
 
-	if err != nil {
-		return nil, err
+	alt := AccountLocksTable{}
+	if _, err := alt.Clear(db, u.UUID, clearedByUUID, now); err != nil {
+		return err
 	}
 
-	defer rows.Close()
+	lat := LoginAttemptsTable{}
+	if _, err := lat.DeleteByUsername(db, u.Username); err != nil {
+		return err
+	}
 
-	for rows.Next() {
-		err = rows.Scan(&u.UserId, &u.CreatedDateTime, &u.UserroleId, &u.UUID, &u.Username, &u.AuthHash, &u.FirstName, &u.LastName, &u.Email)
-		if err != nil {
-			return nil, err
-		}
+	st := AuthSessionsTable{}
+	if _, err := st.DeleteByUserUUID(db, u.UUID); err != nil {
+		return err
 	}
 
-	return u, nil
+	prst := PasswordResetsTable{}
+	_, err := prst.DeleteByUserUUID(db, u.UUID)
+	return err
 }
 
-func (ut *UsersTable) DeleteByUUID(db *sql.DB, uuid string) (int64, error) {
-	res, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE uuid = ?", ut.Name()), uuid)
+//DeleteWithDependents removes the user along with their sessions, group memberships, tokens, two factor setup, locks and password resets
+func (ut *UsersTable) DeleteWithDependents(db Querier, u *User) error {
+	st := AuthSessionsTable{}
+	if _, err := st.DeleteByUserUUID(db, u.UUID); err != nil {
+		return err
+	}
 
-	if err != nil {
-		return 0, err
+	if _, err := ut.DeleteByUUID(db, u.UUID); err != nil {
+		return err
+	}
+
+	gmt := GroupMembershipTable{}
+	//will delete user from all groups, maybe this should be a different function?
+	if _, err := gmt.DeleteUserFromGroup(db, u, &Group{UUID: "*"}); err != nil {
+		return err
 	}
 
-	numDeleted, err := res.RowsAffected()
+	att := APITokensTable{}
+	if _, err := att.DeleteByUserUUID(db, u.UUID); err != nil {
+		return err
+	}
 
-	if err != nil {
-		return 0, err
+	utft := UserTwoFactorTable{}
+	if _, err := utft.DeleteByUserUUID(db, u.UUID); err != nil {
+		return err
+	}
+
+	rct := RecoveryCodesTable{}
+	if _, err := rct.DeleteByUserUUID(db, u.UUID); err != nil {
+		return err
+	}
+
+	alt := AccountLocksTable{}
+	if _, err := alt.DeleteByUserUUID(db, u.UUID); err != nil {
+		return err
 	}
 
-	return numDeleted, nil
+	prst := PasswordResetsTable{}
+	_, err := prst.DeleteByUserUUID(db, u.UUID)
+	return err
 }
 
 //BuildFields takes the table struct and maps all of the struct fields to their own struct
@@ -354,15 +595,152 @@ func (ut *UsersTable) buildPreparedInsertStatement(m Model) string {
 	return buildPreparedInsertStatementFromTable(ut, m)
 }
 
+//HasPermission checks whether the user has been granted the permission through either their role or any of their groups, root users have every permission
+func (ut *UsersTable) HasPermission(db Querier, u *User, permission Permission) (bool, error) {
+	if u == nil || len(u.UUID) == 0 {
+		return false, nil
+	}
+
+	if UsersRoleFlag(u.UserroleId) == ROOT_USER || permission == PERM_NONE {
+		return true, nil
+	}
+
+	rpt := RolePermissionsTable{}
+	rolePermissions, err := rpt.SelectByRoleID(db, u.UserroleId)
+	if err != nil {
+		return false, err
+	}
+
+	for _, p := range rolePermissions {
+		if p == permission {
+			return true, nil
+		}
+	}
+
+	gmt := GroupMembershipTable{}
+	groupUUIDs, err := gmt.SelectGroupUUIDsByUserUUID(db, u.UUID)
+	if err != nil {
+		return false, err
+	}
+
+	gpt := GroupPermissionsTable{}
+	for _, groupUUID := range groupUUIDs {
+		groupPermissions, err := gpt.SelectByGroupUUID(db, groupUUID)
+		if err != nil {
+			return false, err
+		}
+		for _, p := range groupPermissions {
+			if p == permission {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+//TwoFactorRequired checks whether the user is a member of any group which makes two factor authentication mandatory
+func (ut *UsersTable) TwoFactorRequired(db Querier, u *User) (bool, error) {
+	memberships := From(&GroupMembershipTable{}).Columns("groupuuid").Where(Equal("useruuid", u.UUID))
+	count, err := From(&GroupTable{}).Where(InQuery("uuid", memberships), Equal("requiretwofactor", true)).Count(db)
+
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
 // ******** End UserTable ********
 
+// ******** Start User Roles Table ********
+
+type UserRolesTable struct{}
+
+//Init initialise table to include a row for each of the user role flags
+func (ur *UserRole) Init(db *sql.DB) {
+	urt := UserRolesTable{}
+	roles := []UserRole{
+		{Userroleid: int(ROOT_USER), Rolename: "Root"},
+		{Userroleid: int(MOD_USER), Rolename: "Moderator"},
+		{Userroleid: int(REG_USER), Rolename: "User"},
+		{Userroleid: int(MEMBER_USER), Rolename: "Member"},
+	}
+
+	for i := range roles {
+		if err := urt.Insert(db, &roles[i]); err != nil {
+			logging.Error(err.Error())
+		}
+	}
+}
+
+func (urt *UserRolesTable) Insert(db Querier, ur *UserRole) error {
+	return Insert(db, ur)
+}
+
+// ******** End User Roles Table ********
+
+// ******** Start Role Permissions Table ********
+
+type RolePermissionsTable struct{}
+
+//Init initialise table to grant the default permissions of each role, root users don't need any as they have them all
+//and members only get what their groups give them
+func (rp *RolePermission) Init(db *sql.DB) {
+	rpt := RolePermissionsTable{}
+	defaultRolePermissions := map[UsersRoleFlag][]Permission{
+		MOD_USER: {PERM_ADMIN_VIEW, PERM_USERS_VIEW, PERM_PAGES_VIEW, PERM_PAGES_CREATE, PERM_PAGES_EDIT, PERM_PAGES_DELETE},
+		REG_USER: {PERM_ADMIN_VIEW, PERM_PAGES_VIEW, PERM_PAGES_CREATE, PERM_PAGES_EDIT},
+	}
+
+	for role, permissions := range defaultRolePermissions {
+		for _, permission := range permissions {
+			err := rpt.Insert(db, &RolePermission{
+				UserroleId: int(role),
+				Permission: string(permission),
+			})
+			if err != nil {
+				logging.Error(err.Error())
+			}
+		}
+	}
+}
+
+func (rpt *RolePermissionsTable) Insert(db Querier, rp *RolePermission) error {
+	return Insert(db, rp)
+}
+
+func (rpt *RolePermissionsTable) SelectByRoleID(db Querier, userRoleID int) ([]Permission, error) {
+	rows, err := From(TableOf(&RolePermission{})).Columns("permission").Where(Equal("userroleid", userRoleID)).Query(db)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	permissions := make([]Permission, 0)
+	for rows.Next() {
+		var permission string
+		if err := rows.Scan(&permission); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, Permission(permission))
+	}
+
+	return permissions, nil
+}
+
+// ******** End Role Permissions Table ********
+
 // ******** Start GroupTable ********
 
 type GroupTable struct {
-	Groupid         int    `tbl:"PKNNAIUI"`
-	CreatedDateTime int64  `tbl:"NNDT"`
-	UUID            string `tbl:"NNUI"`
-	Title           string `tbl:"NNUI"`
+	Groupid          int    `tbl:"PKNNAIUI"`
+	CreatedDateTime  int64  `tbl:"NNDT"`
+	UUID             string `tbl:"NNUI"`
+	Title            string `tbl:"NNUI"`
+	Requiretwofactor bool   `tbl:"NN"`
 }
 
 func (gt *GroupTable) Init(db *sql.DB) {
@@ -389,7 +767,7 @@ func (gt *GroupTable) Name() string {
 	return "groups"
 }
 
-func (gt *GroupTable) Insert(db *sql.DB, g *Group) error {
+func (gt *GroupTable) Insert(db Querier, g *Group) error {
 	//TODO: change this to simply call validate()
 	if g.UUID != "" {
 		return fmt.Errorf("Page to insert already has UUID %s", g.UUID)
@@ -401,8 +779,7 @@ func (gt *GroupTable) Insert(db *sql.DB, g *Group) error {
 			return err
 		}
 		g.UUID = newUUID.String()
-		insertStatement := gt.buildPreparedInsertStatement(g)
-		_, err = db.Exec(insertStatement, g.CreatedDateTime, g.UUID, g.Title)
+		err = Insert(db, g)
 		if err != nil {
 			return err
 		}
@@ -410,86 +787,53 @@ func (gt *GroupTable) Insert(db *sql.DB, g *Group) error {
 	return nil
 }
 
-func (gt *GroupTable) Update(db *sql.DB, g *Group) error {
+func (gt *GroupTable) Update(db Querier, g *Group) error {
 	if g.Validate() {
-		updateStatement := fmt.Sprintf("UPDATE %s SET createddatetime = ?, uuid = ?, title = ? WHERE uuid = ?", gt.Name())
-		_, err := db.Exec(updateStatement, g.CreatedDateTime, g.Title, g.UUID)
+		updateStatement := fmt.Sprintf("UPDATE %s SET createddatetime = ?, uuid = ?, title = ?, requiretwofactor = ? WHERE uuid = ?", gt.Name())
+		_, err := db.Exec(rebind(updateStatement), g.CreatedDateTime, g.UUID, g.Title, g.RequireTwoFactor, g.UUID)
 		if err != nil {
 			return err
 		}
 		return nil
 	}
-	return errors.New("Group to insert already has UUID")
-}
-
-func (gt *GroupTable) Select(db *sql.DB, whatToSelect string, whereClause string) (*sql.Rows, error) {
-	if len(whereClause) > 0 {
-		return db.Query(fmt.Sprintf("SELECT %s FROM %s WHERE %s", whatToSelect, gt.Name(), whereClause))
-	}
-	return db.Query(fmt.Sprintf("SELECT %s FROM %s", whatToSelect, gt.Name()))
+	return errors.New("Group to update has no UUID")
 }
 
-func (gt *GroupTable) SelectByTitle(db *sql.DB, groupTitle string) (*Group, error) {
+func (gt *GroupTable) SelectByTitle(db Querier, groupTitle string) (*Group, error) {
 	g := &Group{}
-	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE title = '%s'", gt.Name(), groupTitle))
-
-	if err != nil {
+	if err := Get(db, g, Equal("title", groupTitle)); err != nil && err != sql.ErrNoRows {
 		return nil, err
 	}
-
-	defer rows.Close()
-
-	for rows.Next() {
-		err = rows.Scan(&g.Groupid, &g.CreatedDateTime, &g.UUID, &g.Title)
-		if err != nil {
-			return nil, err
-		}
-	}
 	return g, nil
 }
 
-func (gt *GroupTable) SelectByUUID(db *sql.DB, groupUUID string) (*Group, error) {
+func (gt *GroupTable) SelectByUUID(db Querier, groupUUID string) (*Group, error) {
 
 	g := &Group{}
-	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE uuid = '%s'", gt.Name(), groupUUID))
-
-	if err != nil {
+	if err := Get(db, g, Equal("uuid", groupUUID)); err != nil && err != sql.ErrNoRows {
 		return nil, err
 	}
-
-	defer rows.Close()
-
-	for rows.Next() {
-		err = rows.Scan(&g.Groupid, &g.CreatedDateTime, &g.UUID, &g.Title)
-		if err != nil {
-			return nil, err
-		}
-	}
 	return g, nil
 }
 
-func (gt *GroupTable) DeleteByUUID(db *sql.DB, groupUUID string) (int64, error) {
+func (gt *GroupTable) DeleteByUUID(db Querier, groupUUID string) (int64, error) {
 
 	gmt := GroupMembershipTable{}
-	numDeleted, err := gmt.DeleteAllUsersFromGroup(db, &Group{UUID: groupUUID})
-
-	if err != nil {
-		logging.Error(fmt.Sprintf("Error removing user memberships from group of UUID %s -> %s", groupUUID, err.Error()))
+	if _, err := gmt.DeleteAllUsersFromGroup(db, &Group{UUID: groupUUID}); err != nil {
+		return 0, fmt.Errorf("Error removing user memberships from group of UUID %s -> %s", groupUUID, err.Error())
 	}
 
-	res, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE uuid = ?", gt.Name()), groupUUID)
-
-	if err != nil {
-		return 0, err
+	gpt := GroupPermissionsTable{}
+	if _, err := gpt.DeleteByGroupUUID(db, groupUUID); err != nil {
+		return 0, fmt.Errorf("Error removing permissions from group of UUID %s -> %s", groupUUID, err.Error())
 	}
 
-	numDeleted, err = res.RowsAffected()
-
-	if err != nil {
-		return 0, err
+	pgpt := PageGroupPermissionsTable{}
+	if _, err := pgpt.DeleteByGroupUUID(db, groupUUID); err != nil {
+		return 0, fmt.Errorf("Error removing page permissions from group of UUID %s -> %s", groupUUID, err.Error())
 	}
 
-	return numDeleted, nil
+	return From(gt).Where(Equal("uuid", groupUUID)).Delete(db)
 }
 
 func (gt *GroupTable) buildFields() []Field {
@@ -506,32 +850,113 @@ func (gt *GroupTable) buildPreparedInsertStatement(m Model) string {
 
 // ******** End Group Table ********
 
-// ******** Start Group Membership Table ********
+// ******** Start Group Permissions Table ********
 
-type GroupMembershipTable struct {
-	GroupMembershipid int    `tbl:"PKNNAIUI"`
-	CreatedDateTime   int64  `tbl:"NN"`
-	GroupUUID         string `tbl:"NN"`
-	UserUUID          string `tbl:"NN"`
-}
+type GroupPermissionsTable struct{}
 
-//Init initialise table to include default memeberships
-func (gmt *GroupMembershipTable) Init(db *sql.DB) {}
+//Init initialise table to grant the default admins group every permission
+func (gp *GroupPermission) Init(db *sql.DB) {
+	gpt := GroupPermissionsTable{}
+	gt := GroupTable{}
+	adminGroup, err := gt.SelectByTitle(db, "Admins")
+
+	if err != nil || len(adminGroup.UUID) == 0 {
+		logging.Error("Unable to find admins group to grant default permissions to")
+		return
+	}
+
+	for _, permission := range AllPermissions {
+		err := gpt.Insert(db, &GroupPermission{
+			CreatedDateTime: time.Now().Unix(),
+			GroupUUID:       adminGroup.UUID,
+			Permission:      string(permission),
+		})
+		if err != nil {
+			logging.Error(err.Error())
+		}
+	}
+}
+
+func (gpt *GroupPermissionsTable) Insert(db Querier, gp *GroupPermission) error {
+	if _, err := ParsePermission(gp.Permission); err != nil {
+		return err
+	}
+
+	return Insert(db, gp)
+}
+
+func (gpt *GroupPermissionsTable) SelectByGroupUUID(db Querier, groupUUID string) ([]Permission, error) {
+	rows, err := From(TableOf(&GroupPermission{})).Columns("permission").Where(Equal("groupuuid", groupUUID)).Query(db)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	permissions := make([]Permission, 0)
+	for rows.Next() {
+		var permission string
+		if err := rows.Scan(&permission); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, Permission(permission))
+	}
+
+	return permissions, nil
+}
+
+//ReplaceForGroup swaps all of the permissions granted to a group with the given set
+func (gpt *GroupPermissionsTable) ReplaceForGroup(db Querier, groupUUID string, permissions []Permission) error {
+	if _, err := gpt.DeleteByGroupUUID(db, groupUUID); err != nil {
+		return err
+	}
+
+	for _, permission := range permissions {
+		err := gpt.Insert(db, &GroupPermission{
+			CreatedDateTime: time.Now().Unix(),
+			GroupUUID:       groupUUID,
+			Permission:      string(permission),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (gpt *GroupPermissionsTable) DeleteByGroupUUID(db Querier, groupUUID string) (int64, error) {
+	return From(TableOf(&GroupPermission{})).Where(Equal("groupuuid", groupUUID)).Delete(db)
+}
+
+// ******** End Group Permissions Table ********
+
+// ******** Start Group Membership Table ********
+
+type GroupMembershipTable struct {
+	GroupMembershipid int    `tbl:"PKNNAIUI"`
+	CreatedDateTime   int64  `tbl:"NN"`
+	GroupUUID         string `tbl:"NNFK(groups.uuid,CASCADE)"`
+	UserUUID          string `tbl:"NNFK(users.uuid,CASCADE)"`
+}
+
+//Init initialise table to include default memeberships
+func (gmt *GroupMembershipTable) Init(db *sql.DB) {}
 
 func (gmt *GroupMembershipTable) Name() string {
 	return "groupmemberships"
 }
 
-func (gmt *GroupMembershipTable) Insert(db *sql.DB, gm *GroupMembership) error {
-	insertStatement := gmt.buildPreparedInsertStatement(gm)
-	_, err := db.Exec(insertStatement, gm.CreatedDateTime, gm.GroupUUID, gm.UserUUID)
+func (gmt *GroupMembershipTable) Insert(db Querier, gm *GroupMembership) error {
+	err := Insert(db, gm)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (gmt *GroupMembershipTable) AddUserToGroup(db *sql.DB, u *User, groupTitle string) error {
+func (gmt *GroupMembershipTable) AddUserToGroup(db Querier, u *User, groupTitle string) error {
 	gt := GroupTable{}
 	group, err := gt.SelectByTitle(db, groupTitle)
 
@@ -553,55 +978,51 @@ func (gmt *GroupMembershipTable) AddUserToGroup(db *sql.DB, u *User, groupTitle
 	return nil
 }
 
-func (gmt *GroupMembershipTable) DeleteAllUsersFromGroup(db *sql.DB, g *Group) (int64, error) {
-	var res sql.Result
-	var err error
-
+func (gmt *GroupMembershipTable) DeleteAllUsersFromGroup(db Querier, g *Group) (int64, error) {
 	//if group UUID is a wildcard instead just delete all group memberships (in this case, deletes all users from all groups!)
 	if g.UUID == "*" {
-		res, err = db.Exec(fmt.Sprintf("DELETE FROM %s", gmt.Name()))
-	} else {
-		res, err = db.Exec(fmt.Sprintf("DELETE FROM %s WHERE groupuuid = ?", gmt.Name()), g.UUID)
-	}
-
-	numDeleted, err := res.RowsAffected()
-
-	if err != nil {
-		return 0, err
+		//the query builder won't delete without conditions, there's nothing here to bind anyway
+		res, err := db.Exec(fmt.Sprintf("DELETE FROM %s", gmt.Name()))
+		if err != nil {
+			return 0, err
+		}
+		return res.RowsAffected()
 	}
 
-	return numDeleted, nil
+	return From(gmt).Where(Equal("groupuuid", g.UUID)).Delete(db)
 }
 
-func (gmt *GroupMembershipTable) DeleteUserFromGroup(db *sql.DB, u *User, g *Group) (int64, error) {
-	var res sql.Result
-	var err error
+func (gmt *GroupMembershipTable) DeleteUserFromGroup(db Querier, u *User, g *Group) (int64, error) {
+	query := From(gmt).Where(Equal("useruuid", u.UUID))
 
 	//if group UUID is a wildcard instead just delete all group memberships
-	if g.UUID == "*" {
-		res, err = db.Exec(fmt.Sprintf("DELETE FROM %s WHERE useruuid = ?", gmt.Name()), u.UUID)
-	} else {
-		res, err = db.Exec(fmt.Sprintf("DELETE FROM %s WHERE useruuid = ? AND groupuuid = ?", gmt.Name()), u.UUID, g.UUID)
+	if g.UUID != "*" {
+		query.Where(Equal("groupuuid", g.UUID))
 	}
 
-	if err != nil {
-		return 0, err
-	}
+	return query.Delete(db)
+}
 
-	numDeleted, err := res.RowsAffected()
+//SelectGroupUUIDsByUserUUID gets the UUIDs of every group the user is a member of
+func (gmt *GroupMembershipTable) SelectGroupUUIDsByUserUUID(db Querier, userUUID string) ([]string, error) {
+	rows, err := From(gmt).Columns("groupuuid").Where(Equal("useruuid", userUUID)).Query(db)
 
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	return numDeleted, nil
-}
+	defer rows.Close()
 
-func (gmt *GroupMembershipTable) Select(db *sql.DB, whatToSelect string, whereClause string) (*sql.Rows, error) {
-	if len(whereClause) > 0 {
-		return db.Query(fmt.Sprintf("SELECT %s FROM %s WHERE %s", whatToSelect, gmt.Name(), whereClause))
+	groupUUIDs := make([]string, 0)
+	for rows.Next() {
+		var groupUUID string
+		if err := rows.Scan(&groupUUID); err != nil {
+			return nil, err
+		}
+		groupUUIDs = append(groupUUIDs, groupUUID)
 	}
-	return db.Query(fmt.Sprintf("SELECT %s FROM %s", whatToSelect, gmt.Name()))
+
+	return groupUUIDs, nil
 }
 
 func (gmt *GroupMembershipTable) buildFields() []Field {
@@ -618,15 +1039,19 @@ func (gmt *GroupMembershipTable) buildPreparedInsertStatement(m Model) string {
 
 // ******** Start Pages Table ********
 
+//PagesTable pages refer to their author, who can't be deleted while they still have pages
 type PagesTable struct {
-	Pageid          int    `tbl:"PKNNAIUI"`
-	CreatedDateTime int64  `tbl:"NNDT"`
-	UUID            string `tbl:"NNUI"`
-	Roleprotected   bool   `tbl:"NN"`
-	AuthorUUID      string `tbl:"NN"`
-	Title           string `tbl:"NNUI"`
-	Route           string `tbl:"NNUI"`
-	Content         string `tbl:"NN"`
+	Pageid            int    `tbl:"PKNNAIUI"`
+	CreatedDateTime   int64  `tbl:"NNDT"`
+	UUID              string `tbl:"NNUI"`
+	Roleprotected     bool   `tbl:"NN"`
+	AuthorUUID        string `tbl:"NNFK(users.uuid,RESTRICT)"`
+	Title             string `tbl:"NNUI"`
+	Route             string `tbl:"NNUI"`
+	Content           string `tbl:"NN"`
+	Status            int    `tbl:"NN"`
+	Publishdatetime   int64  `tbl:"NNDT"`
+	Unpublishdatetime int64  `tbl:"NNDT"`
 }
 
 func (pt *PagesTable) Init(db *sql.DB) {}
@@ -635,7 +1060,7 @@ func (pt *PagesTable) Name() string {
 	return "pages"
 }
 
-func (pt *PagesTable) Insert(db *sql.DB, p *Page) error {
+func (pt *PagesTable) Insert(db Querier, p *Page) error {
 	//TODO: change this to simply call validate()
 	if p.UUID != "" {
 		return fmt.Errorf("Page to insert already has UUID %s", p.UUID)
@@ -647,8 +1072,7 @@ func (pt *PagesTable) Insert(db *sql.DB, p *Page) error {
 			return err
 		}
 		p.UUID = newUUID.String()
-		insertStatement := pt.buildPreparedInsertStatement(p)
-		_, err = db.Exec(insertStatement, p.CreatedDateTime, p.UUID, p.Roleprotected, p.AuthorUUID, p.Title, p.Route, p.Content)
+		err = Insert(db, p)
 		if err != nil {
 			return err
 		}
@@ -656,204 +1080,930 @@ func (pt *PagesTable) Insert(db *sql.DB, p *Page) error {
 	return nil
 }
 
-func (pt *PagesTable) Update(db *sql.DB, p *Page) error {
-	updateStatement := fmt.Sprintf("UPDATE %s SET createddatetime = ?, uuid = ?, roleprotected = ?, authoruuid = ?, title = ?, route = ?, content = ? WHERE uuid = ?", pt.Name())
-	_, err := db.Exec(updateStatement, p.CreatedDateTime, p.UUID, p.Roleprotected, p.AuthorUUID, p.Title, p.Route, p.Content, p.UUID)
+func (pt *PagesTable) Update(db Querier, p *Page) error {
+	updateStatement := fmt.Sprintf("UPDATE %s SET createddatetime = ?, uuid = ?, roleprotected = ?, authoruuid = ?, title = ?, route = ?, content = ?, status = ?, publishdatetime = ?, unpublishdatetime = ? WHERE uuid = ?", pt.Name())
+	_, err := db.Exec(rebind(updateStatement), p.CreatedDateTime, p.UUID, p.Roleprotected, p.AuthorUUID, p.Title, p.Route, p.Content, p.Status, p.PublishDateTime, p.UnpublishDateTime, p.UUID)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (pt *PagesTable) Select(db *sql.DB, whatToSelect string, whereClause string) (*sql.Rows, error) {
-	if len(whereClause) > 0 {
-		return db.Query(fmt.Sprintf("SELECT %s FROM %s WHERE %s", whatToSelect, pt.Name(), whereClause))
+func (pt *PagesTable) SelectByRoute(db Querier, route string) (*Page, error) {
+	p := &Page{}
+	if err := Get(db, p, Equal("route", route)); err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	//page not found, therefore don't return blank page struct
+	if p.UUID == "" {
+		return nil, fmt.Errorf("Page not found in table %s", pt.Name())
 	}
-	return db.Query(fmt.Sprintf("SELECT %s FROM %s", whatToSelect, pt.Name()))
+
+	return p, nil
 }
 
-//TODO: Should really consider changing this to call the existing select func
-func (pt *PagesTable) SelectByRoute(db *sql.DB, route string) (*Page, error) {
+func (pt *PagesTable) SelectByUUID(db Querier, uuid string) (*Page, error) {
 	p := &Page{}
+	err := Get(db, p, Equal("uuid", uuid))
+	if err != nil {
+		return nil, err
+	}
+	//page not found, therefore don't return blank page struct
+	if p.UUID == "" {
+		return nil, fmt.Errorf("Page not found in table %s", pt.Name())
+	}
+	return p, nil
+}
 
-	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE route = '%s'", pt.Name(), route))
+//PublishScheduled marks scheduled pages whose publish time has passed as published
+func (pt *PagesTable) PublishScheduled(db Querier, now int64) (int64, error) {
+	res, err := db.Exec(rebind(fmt.Sprintf("UPDATE %s SET status = ? WHERE status = ? AND publishdatetime <= ?", pt.Name())), PAGE_PUBLISHED, PAGE_SCHEDULED, now)
 
 	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+//UnpublishExpired moves pages whose unpublish time has passed back into drafts
+func (pt *PagesTable) UnpublishExpired(db Querier, now int64) (int64, error) {
+	res, err := db.Exec(rebind(fmt.Sprintf("UPDATE %s SET status = ? WHERE status != ? AND unpublishdatetime > 0 AND unpublishdatetime <= ?", pt.Name())), PAGE_DRAFT, PAGE_DRAFT, now)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func (pt *PagesTable) DeleteByUUID(db Querier, uuid string) (int64, error) {
+	return From(pt).Where(Equal("uuid", uuid)).Delete(db)
+}
+
+func (pt *PagesTable) buildFields() []Field {
+	return buildFieldsFromTable(pt)
+}
+
+func (pt *PagesTable) buildInsertStatement(m Model) string {
+	return buildInsertStatementFromTable(pt, m)
+}
+
+func (pt *PagesTable) buildPreparedInsertStatement(m Model) string {
+	return buildPreparedInsertStatementFromTable(pt, m)
+}
+
+// ******** End Pages Table ********
+
+// ******** Start Page Group Permissions Table ********
+
+type PageGroupPermissionsTable struct{}
+
+func (pgpt *PageGroupPermissionsTable) Insert(db Querier, pgp *PageGroupPermission) error {
+	if len(pgp.PageUUID) == 0 || len(pgp.GroupUUID) == 0 {
+		return errors.New("Page group permission needs both a page UUID and a group UUID")
+	}
+
+	err := Insert(db, pgp)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pgpt *PageGroupPermissionsTable) SelectByPageUUID(db Querier, pageUUID string) ([]PageGroupPermission, error) {
+	permissions := make([]PageGroupPermission, 0)
+	if err := Find(db, From(TableOf(&PageGroupPermission{})).Where(Equal("pageuuid", pageUUID)), &permissions); err != nil {
 		return nil, err
 	}
 
-	defer rows.Close()
+	return permissions, nil
+}
 
-	for rows.Next() {
-		err = rows.Scan(&p.PageId, &p.CreatedDateTime, &p.UUID, &p.Roleprotected, &p.AuthorUUID, &p.Title, &p.Route, &p.Content)
+//IsRestricted checks whether any groups have been attached to a page
+func (pgpt *PageGroupPermissionsTable) IsRestricted(db Querier, pageUUID string) (bool, error) {
+	permissions, err := pgpt.SelectByPageUUID(db, pageUUID)
+	if err != nil {
+		return true, err
+	}
+	return len(permissions) > 0, nil
+}
+
+//UserHasPermission checks whether the user belongs to a group granted the permission on the page, the user is nil for anonymous visitors.
+//Pages without any groups attached aren't restricted, and the root user always has access.
+func (pgpt *PageGroupPermissionsTable) UserHasPermission(db Querier, u *User, pageUUID string, permission PagePermission) (bool, error) {
+	permissions, err := pgpt.SelectByPageUUID(db, pageUUID)
+	if err != nil {
+		return false, err
+	}
+
+	grantedGroups := make(map[string]bool)
+	for _, pgp := range permissions {
+		//edit permission implies being able to read
+		if PagePermission(pgp.Permission) >= permission {
+			grantedGroups[pgp.GroupUUID] = true
+		}
+	}
+
+	//pages without any groups attached are open to everyone
+	if len(permissions) == 0 {
+		return true, nil
+	}
+
+	//with no edit groups, editing falls back to the groups that can read the page
+	if permission == PAGE_EDIT && len(grantedGroups) == 0 {
+		for _, pgp := range permissions {
+			grantedGroups[pgp.GroupUUID] = true
+		}
+	}
+
+	if u == nil || len(u.UUID) == 0 {
+		return false, nil
+	}
+
+	if UsersRoleFlag(u.UserroleId) == ROOT_USER {
+		return true, nil
+	}
+
+	gmt := GroupMembershipTable{}
+	groupUUIDs, err := gmt.SelectGroupUUIDsByUserUUID(db, u.UUID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, groupUUID := range groupUUIDs {
+		if grantedGroups[groupUUID] {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+//ReplaceForPage swaps all of the group permissions of a page with the given set
+func (pgpt *PageGroupPermissionsTable) ReplaceForPage(db Querier, pageUUID string, permissions []PageGroupPermission) error {
+	if _, err := pgpt.DeleteByPageUUID(db, pageUUID); err != nil {
+		return err
+	}
+
+	for i := range permissions {
+		permissions[i].PageUUID = pageUUID
+		if err := pgpt.Insert(db, &permissions[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (pgpt *PageGroupPermissionsTable) DeleteByPageUUID(db Querier, pageUUID string) (int64, error) {
+	return From(TableOf(&PageGroupPermission{})).Where(Equal("pageuuid", pageUUID)).Delete(db)
+}
+
+func (pgpt *PageGroupPermissionsTable) DeleteByGroupUUID(db Querier, groupUUID string) (int64, error) {
+	return From(TableOf(&PageGroupPermission{})).Where(Equal("groupuuid", groupUUID)).Delete(db)
+}
+
+// ******** End Page Group Permissions Table ********
+
+// ******** Start Page Revisions Table ********
+
+type PageRevisionsTable struct{}
+
+func (prt *PageRevisionsTable) Insert(db Querier, pr *PageRevision) error {
+	if pr.UUID != "" {
+		return fmt.Errorf("Page revision to insert already has UUID %s", pr.UUID)
+	}
+
+	if len(pr.PageUUID) == 0 {
+		return errors.New("Page revision is missing its page UUID")
+	}
+
+	newUUID, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+	pr.UUID = newUUID.String()
+	err = Insert(db, pr)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+//InsertFromPage records the current state of the given page as a new revision
+func (prt *PageRevisionsTable) InsertFromPage(db Querier, p *Page, authorUUID string) error {
+	return prt.Insert(db, &PageRevision{
+		CreatedDateTime: time.Now().Unix(),
+		PageUUID:        p.UUID,
+		AuthorUUID:      authorUUID,
+		Title:           p.Title,
+		Route:           p.Route,
+		Content:         p.Content,
+	})
+}
+
+func (prt *PageRevisionsTable) SelectByUUID(db Querier, uuid string) (*PageRevision, error) {
+	pr := &PageRevision{}
+	err := Get(db, pr, Equal("uuid", uuid))
+	if err != nil {
+		return nil, err
+	}
+	return pr, nil
+}
+
+//SelectByPageUUID gets every revision of a page, newest first
+func (prt *PageRevisionsTable) SelectByPageUUID(db Querier, pageUUID string) ([]PageRevision, error) {
+	revisions := make([]PageRevision, 0)
+	if err := Find(db, From(TableOf(&PageRevision{})).Where(Equal("pageuuid", pageUUID)).OrderBy("createddatetime", Descending).OrderBy("pagerevisionid", Descending), &revisions); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+func (prt *PageRevisionsTable) DeleteByPageUUID(db Querier, pageUUID string) (int64, error) {
+	return From(TableOf(&PageRevision{})).Where(Equal("pageuuid", pageUUID)).Delete(db)
+}
+
+// ******** End Page Revisions Table ********
+
+// ******** Start Auth Table ********
+
+type AuthSessionsTable struct {
+	Authsessionid      int    `tbl:"PKNNAIUI"`
+	CreatedDateTime    int64  `tbl:"NNDT"`
+	LastActiveDateTime int64  `tbl:"NNDT"`
+	UserUUID           string `tbl:"NN"`
+	SessionUUID        string `tbl:"NNUI"`
+	IPAddress          string `tbl:"NN"`
+	UserAgent          string `tbl:"NN"`
+	Remember           bool   `tbl:"NN"`
+}
+
+func (ast *AuthSessionsTable) Init(db *sql.DB) {}
+
+func (ast *AuthSessionsTable) Name() string { return "authsessions" }
+
+func (ast *AuthSessionsTable) Insert(db Querier, as *AuthSession) error {
+	if as.Validate() {
+		err := Insert(db, as)
 		if err != nil {
-			return nil, err
+			return err
 		}
+		return nil
 	}
+	return errors.New("AuthSession doesn't have a user UUID and/or a session UUID")
+}
 
-	//page not found, therefore don't return blank page struct
-	if p.UUID == "" {
-		return nil, fmt.Errorf("Page not found in table %s", pt.Name())
+//Update - Takes auth session to update existing session entry of the same session UUID
+func (ast *AuthSessionsTable) Update(db Querier, as *AuthSession) error {
+	if as.Validate() {
+		updateStatement := fmt.Sprintf("UPDATE %s SET createddatetime = ?, lastactivedatetime = ?, ipaddress = ?, useragent = ? WHERE sessionuuid = ?", ast.Name())
+		_, err := db.Exec(rebind(updateStatement), as.CreatedDateTime, as.LastActiveDateTime, as.IPAddress, as.UserAgent, as.SessionUUID)
+		if err != nil {
+			return err
+		}
+		return nil
+	}
+	return errors.New("AuthSession doesn't have a user UUID and/or a session UUID")
+}
+
+func (ast *AuthSessionsTable) SelectBySessionUUID(db Querier, sessionUUID string) (*AuthSession, error) {
+	as := &AuthSession{}
+	err := Get(db, as, Equal("sessionuuid", sessionUUID))
+	if err != nil {
+		return nil, err
+	}
+	return as, nil
+}
+
+//SelectByUserUUID gets all of the user's sessions, most recently active first
+func (ast *AuthSessionsTable) SelectByUserUUID(db Querier, userUUID string) ([]AuthSession, error) {
+	authSessions := []AuthSession{}
+	if err := Find(db, From(ast).Where(Equal("useruuid", userUUID)).OrderBy("lastactivedatetime", Descending), &authSessions); err != nil {
+		return nil, err
+	}
+
+	return authSessions, nil
+}
+
+func (ast *AuthSessionsTable) DeleteBySessionUUID(db Querier, sessionUUID string) error {
+	if len(sessionUUID) > 0 {
+		_, err := From(ast).Where(Equal("sessionuuid", sessionUUID)).Delete(db)
+		if err != nil {
+			return err
+		}
+		return nil
+	}
+	return errors.New("Session UUID to delete by is blank")
+}
+
+//DeleteExpired removes sessions which have been idle or alive for too long, remembered sessions never go idle
+//and are only limited by their own lifetime
+func (ast *AuthSessionsTable) DeleteExpired(db Querier, now int64, idleTimeout int64, maxAge int64, rememberMaxAge int64) (int64, error) {
+	return From(ast).Where(Or(
+		And(Equal("remember", false), Or(AtMost("lastactivedatetime", now-idleTimeout), AtMost("createddatetime", now-maxAge))),
+		And(Equal("remember", true), AtMost("createddatetime", now-rememberMaxAge)),
+	)).Delete(db)
+}
+
+//DeleteByID revokes a single session, as long as it belongs to the given user
+func (ast *AuthSessionsTable) DeleteByID(db Querier, authSessionID int, userUUID string) (int64, error) {
+	return From(ast).Where(Equal("authsessionid", authSessionID), Equal("useruuid", userUUID)).Delete(db)
+}
+
+//DeleteByUserUUID revokes every one of the user's sessions
+func (ast *AuthSessionsTable) DeleteByUserUUID(db Querier, userUUID string) (int64, error) {
+	return From(ast).Where(Equal("useruuid", userUUID)).Delete(db)
+}
+
+//BuildFields takes the table struct and maps all of the struct fields to their own struct
+func (ast *AuthSessionsTable) buildFields() []Field {
+	return buildFieldsFromTable(ast)
+}
+
+func (ast *AuthSessionsTable) buildInsertStatement(m Model) string {
+	return buildInsertStatementFromTable(ast, m)
+}
+
+func (ast *AuthSessionsTable) buildPreparedInsertStatement(m Model) string {
+	return buildPreparedInsertStatementFromTable(ast, m)
+}
+
+// ******** End Auth Table ********
+
+// ******** Start User Two Factor Table ********
+
+type UserTwoFactorTable struct{}
+
+func (utft *UserTwoFactorTable) Insert(db Querier, utf *UserTwoFactor) error {
+	if len(utf.UserUUID) == 0 || len(utf.Secret) == 0 {
+		return errors.New("Two factor entry needs both a user UUID and a secret")
+	}
+
+	return Insert(db, utf)
+}
+
+func (utft *UserTwoFactorTable) Update(db Querier, utf *UserTwoFactor) error {
+	updateStatement := fmt.Sprintf("UPDATE %s SET secret = ?, enabled = ?, lastusedstep = ? WHERE useruuid = ?", TableOf(&UserTwoFactor{}).Name())
+	_, err := db.Exec(rebind(updateStatement), utf.Secret, utf.Enabled, utf.LastUsedStep, utf.UserUUID)
+	return err
+}
+
+//Replace saves the two factor entry as the user's only one, overwriting any existing entry
+func (utft *UserTwoFactorTable) Replace(db Querier, utf *UserTwoFactor) error {
+	return Upsert(db, utf, "useruuid")
+}
+
+//SelectByUserUUID gets the two factor entry of the user, nil if they've never started enrolling
+func (utft *UserTwoFactorTable) SelectByUserUUID(db Querier, userUUID string) (*UserTwoFactor, error) {
+	utf := &UserTwoFactor{}
+	err := Get(db, utf, Equal("useruuid", userUUID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return utf, nil
+}
+
+//IsEnabled checks whether the user has finished enrolling in two factor authentication
+func (utft *UserTwoFactorTable) IsEnabled(db Querier, userUUID string) (bool, error) {
+	utf, err := utft.SelectByUserUUID(db, userUUID)
+	if err != nil {
+		return false, err
+	}
+	return utf != nil && utf.Enabled, nil
+}
+
+func (utft *UserTwoFactorTable) DeleteByUserUUID(db Querier, userUUID string) (int64, error) {
+	return From(TableOf(&UserTwoFactor{})).Where(Equal("useruuid", userUUID)).Delete(db)
+}
+
+// ******** End User Two Factor Table ********
+
+// ******** Start Recovery Codes Table ********
+
+type RecoveryCodesTable struct{}
+
+//ReplaceForUser throws away any of the user's existing recovery codes and stores the hashes of the new ones
+func (rct *RecoveryCodesTable) ReplaceForUser(db Querier, userUUID string, codeHashes []string) error {
+	if _, err := rct.DeleteByUserUUID(db, userUUID); err != nil {
+		return err
+	}
+
+	for _, codeHash := range codeHashes {
+		rc := &RecoveryCode{
+			CreatedDateTime: time.Now().Unix(),
+			UserUUID:        userUUID,
+			CodeHash:        codeHash,
+		}
+		if err := Insert(db, rc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//Use removes the matching recovery code of the user, reporting whether there was one to use
+func (rct *RecoveryCodesTable) Use(db Querier, userUUID string, codeHash string) (bool, error) {
+	numDeleted, err := From(TableOf(&RecoveryCode{})).Where(Equal("useruuid", userUUID), Equal("codehash", codeHash)).Delete(db)
+	if err != nil {
+		return false, err
+	}
+
+	return numDeleted > 0, nil
+}
+
+func (rct *RecoveryCodesTable) CountByUserUUID(db Querier, userUUID string) (int, error) {
+	return From(TableOf(&RecoveryCode{})).Where(Equal("useruuid", userUUID)).Count(db)
+}
+
+func (rct *RecoveryCodesTable) DeleteByUserUUID(db Querier, userUUID string) (int64, error) {
+	return From(TableOf(&RecoveryCode{})).Where(Equal("useruuid", userUUID)).Delete(db)
+}
+
+// ******** End Recovery Codes Table ********
+
+// ******** Start Login Attempts Table ********
+
+type LoginAttemptsTable struct{}
+
+//Insert records a failed login attempt
+func (lat *LoginAttemptsTable) Insert(db Querier, la *LoginAttempt) error {
+	return Insert(db, la)
+}
+
+//FailuresByUsernameSince counts the failed attempts to log in as the username since the given time, and when the latest was
+func (lat *LoginAttemptsTable) FailuresByUsernameSince(db Querier, username string, since int64) (int, int64, error) {
+	return lat.failuresSince(db, "username", username, since)
+}
+
+//FailuresByIPAddressSince counts the failed attempts to log in from the IP address since the given time, and when the latest was
+func (lat *LoginAttemptsTable) FailuresByIPAddressSince(db Querier, ipAddress string, since int64) (int, int64, error) {
+	return lat.failuresSince(db, "ipaddress", ipAddress, since)
+}
+
+func (lat *LoginAttemptsTable) failuresSince(db Querier, column string, value string, since int64) (int, int64, error) {
+	count, err := From(TableOf(&LoginAttempt{})).Where(Equal(column, value), AtLeast("createddatetime", since)).Count(db)
+	if err != nil {
+		return 0, 0, err
+	}
+	latest, err := From(TableOf(&LoginAttempt{})).Where(Equal(column, value), AtLeast("createddatetime", since)).Max(db, "createddatetime")
+	if err != nil {
+		return 0, 0, err
+	}
+	return count, latest, nil
+}
+
+func (lat *LoginAttemptsTable) DeleteByUsername(db Querier, username string) (int64, error) {
+	return From(TableOf(&LoginAttempt{})).Where(Equal("username", username)).Delete(db)
+}
+
+//DeleteOlderThan removes attempts which are too old to count towards any throttling
+func (lat *LoginAttemptsTable) DeleteOlderThan(db Querier, before int64) (int64, error) {
+	return From(TableOf(&LoginAttempt{})).Where(LessThan("createddatetime", before)).Delete(db)
+}
+
+// ******** End Login Attempts Table ********
+
+// ******** Start Account Locks Table ********
+
+type AccountLocksTable struct{}
+
+//Insert records a lockout event
+func (alt *AccountLocksTable) Insert(db Querier, al *AccountLock) error {
+	if len(al.UserUUID) == 0 {
+		return errors.New("Account lock needs a user UUID")
+	}
+
+	return Insert(db, al)
+}
+
+//SelectActive gets every lock which hasn't expired or been cleared at the given time
+func (alt *AccountLocksTable) SelectActive(db Querier, now int64) ([]AccountLock, error) {
+	locks := []AccountLock{}
+	if err := Find(db, From(TableOf(&AccountLock{})).Where(GreaterThan("lockeduntil", now), Equal("cleareddatetime", 0)), &locks); err != nil {
+		return nil, err
+	}
+
+	return locks, nil
+}
+
+//ActiveLockUntil gets when the user's account stops being locked, 0 if it isn't locked at the given time
+func (alt *AccountLocksTable) ActiveLockUntil(db Querier, userUUID string, now int64) (int64, error) {
+	return From(TableOf(&AccountLock{})).Where(Equal("useruuid", userUUID), GreaterThan("lockeduntil", now), Equal("cleareddatetime", 0)).Max(db, "lockeduntil")
+}
+
+//CountSince counts how many times the user's account has been locked since the given time
+func (alt *AccountLocksTable) CountSince(db Querier, userUUID string, since int64) (int, error) {
+	return From(TableOf(&AccountLock{})).Where(Equal("useruuid", userUUID), AtLeast("createddatetime", since)).Count(db)
+}
+
+//Clear marks the user's active locks as cleared, the lock events themselves are kept
+func (alt *AccountLocksTable) Clear(db Querier, userUUID string, clearedByUUID string, now int64) (int64, error) {
+	res, err := db.Exec(rebind(fmt.Sprintf("UPDATE %s SET cleareddatetime = ?, clearedbyuuid = ? WHERE useruuid = ? AND lockeduntil > ? AND cleareddatetime = 0", TableOf(&AccountLock{}).Name())), now, clearedByUUID, userUUID, now)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func (alt *AccountLocksTable) DeleteByUserUUID(db Querier, userUUID string) (int64, error) {
+	return From(TableOf(&AccountLock{})).Where(Equal("useruuid", userUUID)).Delete(db)
+}
+
+// ******** End Account Locks Table ********
+
+// ******** Start API Tokens Table ********
+
+type APITokensTable struct{}
+
+//Insert adds token to table, only the hash of the token is ever stored
+func (att *APITokensTable) Insert(db Querier, at *APIToken) error {
+	if at.UUID != "" {
+		return fmt.Errorf("API token to insert already has UUID %s", at.UUID)
+	}
+
+	if len(at.UserUUID) == 0 || len(at.TokenHash) == 0 {
+		return errors.New("API token needs both a user UUID and a token hash")
+	}
+
+	newUUID, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+	at.UUID = newUUID.String()
+
+	err = Insert(db, at)
+	return err
+}
+
+func (att *APITokensTable) SelectByTokenHash(db Querier, tokenHash string) (*APIToken, error) {
+	at := &APIToken{}
+	err := Get(db, at, Equal("tokenhash", tokenHash))
+	if err != nil {
+		return nil, err
+	}
+	return at, nil
+}
+
+func (att *APITokensTable) SelectByUserUUID(db Querier, userUUID string) ([]APIToken, error) {
+	tokens := make([]APIToken, 0)
+	if err := Find(db, From(TableOf(&APIToken{})).Where(Equal("useruuid", userUUID)).OrderBy("createddatetime", Descending), &tokens); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+//UpdateLastUsed records that the token has just been used to authenticate
+func (att *APITokensTable) UpdateLastUsed(db Querier, at *APIToken, now int64) error {
+	at.LastUsedDateTime = now
+	_, err := db.Exec(rebind(fmt.Sprintf("UPDATE %s SET lastuseddatetime = ? WHERE uuid = ?", TableOf(&APIToken{}).Name())), now, at.UUID)
+	return err
+}
+
+//DeleteByUUID revokes a token, it has to belong to the given user so that users can't revoke each other's tokens
+func (att *APITokensTable) DeleteByUUID(db Querier, tokenUUID string, userUUID string) (int64, error) {
+	return From(TableOf(&APIToken{})).Where(Equal("uuid", tokenUUID), Equal("useruuid", userUUID)).Delete(db)
+}
+
+func (att *APITokensTable) DeleteByUserUUID(db Querier, userUUID string) (int64, error) {
+	return From(TableOf(&APIToken{})).Where(Equal("useruuid", userUUID)).Delete(db)
+}
+
+//DeleteExpired removes all tokens which have gone past their expiry time
+func (att *APITokensTable) DeleteExpired(db Querier, now int64) (int64, error) {
+	return From(TableOf(&APIToken{})).Where(GreaterThan("expiresdatetime", 0), AtMost("expiresdatetime", now)).Delete(db)
+}
+
+// ******** End API Tokens Table ********
+
+// ******** Start Password Resets Table ********
+
+//PasswordResetsTable single use tokens emailed to users who've forgotten their password, only the hash of each is stored
+type PasswordResetsTable struct{}
+
+//Insert adds the reset to the table, only the hash of the token is ever stored
+func (prst *PasswordResetsTable) Insert(db Querier, pr *PasswordReset) error {
+	if len(pr.UserUUID) == 0 || len(pr.TokenHash) == 0 {
+		return errors.New("Password reset needs both a user UUID and a token hash")
+	}
+
+	return Insert(db, pr)
+}
+
+func (prst *PasswordResetsTable) SelectByTokenHash(db Querier, tokenHash string) (*PasswordReset, error) {
+	pr := &PasswordReset{}
+	if err := Get(db, pr, Equal("tokenhash", tokenHash)); err != nil {
+		return nil, err
+	}
+	return pr, nil
+}
+
+//CountSince counts how many resets have been requested for the user since the given time
+func (prst *PasswordResetsTable) CountSince(db Querier, userUUID string, since int64) (int, error) {
+	return From(TableOf(&PasswordReset{})).Where(Equal("useruuid", userUUID), AtLeast("createddatetime", since)).Count(db)
+}
+
+//Use marks the reset as used, returning false if it had already been used or has expired so each can only be used once
+func (prst *PasswordResetsTable) Use(db Querier, pr *PasswordReset, now int64) (bool, error) {
+	res, err := db.Exec(rebind(fmt.Sprintf("UPDATE %s SET useddatetime = ? WHERE passwordresetid = ? AND useddatetime = 0 AND expiresdatetime > ?", TableOf(&PasswordReset{}).Name())), now, pr.Passwordresetid, now)
+	if err != nil {
+		return false, err
+	}
+
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	pr.UsedDateTime = now
+	return updated == 1, nil
+}
+
+func (prst *PasswordResetsTable) DeleteByUserUUID(db Querier, userUUID string) (int64, error) {
+	return From(TableOf(&PasswordReset{})).Where(Equal("useruuid", userUUID)).Delete(db)
+}
+
+//DeleteExpired removes all resets which have gone past their expiry time, used ones can't be used again either way
+func (prst *PasswordResetsTable) DeleteExpired(db Querier, now int64) (int64, error) {
+	return From(TableOf(&PasswordReset{})).Where(AtMost("expiresdatetime", now)).Delete(db)
+}
+
+// ******** End Password Resets Table ********
+
+// ******** Start Registrations Table ********
+
+//RegistrationsTable accounts visitors have signed up for, which become users once their email address is verified and an admin approves them
+type RegistrationsTable struct{}
+
+//Insert adds the registration to the table, only the hash of the verification token is ever stored
+func (rt *RegistrationsTable) Insert(db Querier, reg *Registration) error {
+	if len(reg.Username) == 0 || len(reg.Email) == 0 || len(reg.TokenHash) == 0 {
+		return errors.New("Registration needs a username, email address and token hash")
+	}
+	return Insert(db, reg)
+}
+
+//SelectByID gets the registration, an empty one if it doesn't exist
+func (rt *RegistrationsTable) SelectByID(db Querier, registrationID int) (*Registration, error) {
+	reg := &Registration{}
+	if err := Get(db, reg, Equal("registrationid", registrationID)); err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return reg, nil
+}
+
+//SelectVerified gets the registrations waiting for an admin to approve or reject them, oldest first
+func (rt *RegistrationsTable) SelectVerified(db Querier) ([]Registration, error) {
+	registrations := make([]Registration, 0)
+	if err := Find(db, From(TableOf(&Registration{})).Where(GreaterThan("verifieddatetime", 0)).OrderBy("createddatetime", Ascending), &registrations); err != nil {
+		return nil, err
 	}
+	return registrations, nil
+}
 
-	return p, nil
+//Taken checks whether there's already a registration for the username or email address
+func (rt *RegistrationsTable) Taken(db Querier, username string, email string) (bool, error) {
+	count, err := From(TableOf(&Registration{})).Where(Or(Equal("username", username), Equal("email", email))).Count(db)
+	return count > 0, err
 }
 
-func (pt *PagesTable) SelectByUUID(db *sql.DB, uuid string) (*Page, error) {
-	p := &Page{}
-	row := db.QueryRow(fmt.Sprintf("SELECT * FROM %s WHERE uuid = '%s'", pt.Name(), uuid))
-	err := row.Scan(&p.PageId, &p.CreatedDateTime, &p.UUID, &p.Roleprotected, &p.AuthorUUID, &p.Title, &p.Route, &p.Content)
+//Verify marks the registration with the token's email address as verified, returning false if there isn't an unexpired
+//and unverified one so each link only works once
+func (rt *RegistrationsTable) Verify(db Querier, tokenHash string, now int64) (bool, error) {
+	res, err := db.Exec(rebind(fmt.Sprintf("UPDATE %s SET verifieddatetime = ? WHERE tokenhash = ? AND verifieddatetime = 0 AND expiresdatetime > ?", TableOf(&Registration{}).Name())), now, tokenHash, now)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
-	//page not found, therefore don't return blank page struct
-	if p.UUID == "" {
-		return nil, fmt.Errorf("Page not found in table %s", pt.Name())
+
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return false, err
 	}
-	return p, nil
+
+	return updated == 1, nil
 }
 
-func (pt *PagesTable) DeleteByUUID(db *sql.DB, uuid string) (int64, error) {
-	res, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE uuid = ?", pt.Name()), uuid)
+//Approve creates the user the registration is for in the group and removes the registration
+func (rt *RegistrationsTable) Approve(db Querier, reg *Registration, groupTitle string, now int64) (*User, error) {
+	if reg.VerifiedDateTime == 0 {
+		return nil, fmt.Errorf("Registration of %s hasn't had its email address verified", reg.Username)
+	}
 
+	gt := GroupTable{}
+	group, err := gt.SelectByTitle(db, groupTitle)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	numDeleted, err := res.RowsAffected()
+	if len(group.UUID) == 0 {
+		return nil, fmt.Errorf("Group %s to add new users to doesn't exist", groupTitle)
+	}
 
-	if err != nil {
-		return 0, err
+	ut := UsersTable{}
+	u := &User{
+		CreatedDateTime: now,
+		UserroleId:      int(MEMBER_USER),
+		Username:        reg.Username,
+		AuthHash:        reg.AuthHash,
+		FirstName:       reg.FirstName,
+		LastName:        reg.LastName,
+		Email:           reg.Email,
+	}
+	if err := ut.Insert(db, u); err != nil {
+		return nil, err
 	}
 
-	return numDeleted, nil
-}
+	gmt := GroupMembershipTable{}
+	if err := gmt.Insert(db, &GroupMembership{CreatedDateTime: now, GroupUUID: group.UUID, UserUUID: u.UUID}); err != nil {
+		return nil, err
+	}
 
-func (pt *PagesTable) buildFields() []Field {
-	return buildFieldsFromTable(pt)
+	if _, err := rt.DeleteByID(db, reg.Registrationid); err != nil {
+		return nil, err
+	}
+
+	return u, nil
 }
 
-func (pt *PagesTable) buildInsertStatement(m Model) string {
-	return buildInsertStatementFromTable(pt, m)
+func (rt *RegistrationsTable) DeleteByID(db Querier, registrationID int) (int64, error) {
+	return From(TableOf(&Registration{})).Where(Equal("registrationid", registrationID)).Delete(db)
 }
 
-func (pt *PagesTable) buildPreparedInsertStatement(m Model) string {
-	return buildPreparedInsertStatementFromTable(pt, m)
+//DeleteExpired removes registrations which weren't verified in time, verified ones are kept until an admin deals with them
+func (rt *RegistrationsTable) DeleteExpired(db Querier, now int64) (int64, error) {
+	return From(TableOf(&Registration{})).Where(Equal("verifieddatetime", 0), AtMost("expiresdatetime", now)).Delete(db)
 }
 
-// ******** End Pages Table ********
+// ******** End Registrations Table ********
 
-// ******** Start Auth Table ********
+// ******** Start Session Keys Table ********
 
-type AuthSessionsTable struct {
-	Authsessionid      int    `tbl:"PKNNAIUI"`
-	CreatedDateTime    int64  `tbl:"NNDT"`
-	LastActiveDateTime int64  `tbl:"NNDT"`
-	UserUUID           string `tbl:"NNUI"`
-	SessionUUID        string `tbl:"NNUI"`
-}
+//sessionKeysKept how many of the newest session keys are kept, the older ones still validate cookies issued before a rotation
+const sessionKeysKept = 2
 
-func (ast *AuthSessionsTable) Init(db *sql.DB) {}
+const (
+	sessionHashKeyLength  = 64
+	sessionBlockKeyLength = 32
+)
 
-func (ast *AuthSessionsTable) Name() string { return "authsessions" }
+type SessionKeysTable struct{}
 
-func (ast *AuthSessionsTable) Insert(db *sql.DB, as *AuthSession) error {
-	if as.Validate() {
-		insertStatement := ast.buildPreparedInsertStatement(as)
-		_, err := db.Exec(insertStatement, as.CreatedDateTime, as.LastActiveDateTime, as.UserUUID, as.SessionUUID)
-		if err != nil {
-			return err
-		}
-		return nil
+//Init generates the installation's first session keys
+func (sk *SessionKey) Init(db *sql.DB) {
+	skt := SessionKeysTable{}
+	if err := skt.Rotate(db); err != nil {
+		logging.ErrorAndExit(fmt.Sprintf("Issue creating session keys: %s", err.Error()))
 	}
-	return errors.New("AuthSession doesn't have a user UUID and/or a session UUID")
 }
 
-//Update - Takes auth session to update existing user session entry session UUID
-func (ast *AuthSessionsTable) Update(db *sql.DB, as *AuthSession) error {
-	if as.Validate() {
-		updateStatement := fmt.Sprintf("UPDATE %s SET createddatetime = ?, lastactivedatetime = ?, sessionuuid = ? WHERE useruuid = ?", ast.Name())
-		_, err := db.Exec(updateStatement, as.CreatedDateTime, as.LastActiveDateTime, as.SessionUUID, as.UserUUID)
-		if err != nil {
-			return err
-		}
-		return nil
-	}
-	return errors.New("AuthSession doesn't have a user UUID and/or a session UUID")
+func (skt *SessionKeysTable) Insert(db Querier, sk *SessionKey) error {
+	return Insert(db, sk)
 }
 
-func (ast *AuthSessionsTable) Select(db *sql.DB, whatToSelect string, whereClause string) (*sql.Rows, error) {
-	if len(whereClause) > 0 {
-		return db.Query(fmt.Sprintf("SELECT %s FROM %s WHERE %s", whatToSelect, ast.Name(), whereClause))
+//SelectAll gets the stored session keys, newest first
+func (skt *SessionKeysTable) SelectAll(db Querier) ([]SessionKey, error) {
+	keys := []SessionKey{}
+	if err := Find(db, From(TableOf(&SessionKey{})).OrderBy("sessionkeyid", Descending), &keys); err != nil {
+		return nil, err
 	}
-	return db.Query(fmt.Sprintf("SELECT %s FROM %s", whatToSelect, ast.Name()))
+
+	return keys, nil
 }
 
-func (ast *AuthSessionsTable) SelectBySessionUUID(db *sql.DB, sessionUUID string) (*AuthSession, error) {
-	as := &AuthSession{}
-	row := db.QueryRow(fmt.Sprintf("SELECT * FROM %s WHERE sessionuuid = '%s'", ast.Name(), sessionUUID))
-	err := row.Scan(&as.Authsessionid, &as.CreatedDateTime, &as.LastActiveDateTime, &as.UserUUID, &as.SessionUUID)
+//Rotate generates new keys to sign and encrypt cookies with, and removes the keys too old to be kept
+func (skt *SessionKeysTable) Rotate(db Querier) error {
+	hashKey, err := util.GenerateKey(sessionHashKeyLength)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return as, nil
-}
 
-func (ast *AuthSessionsTable) SelectByUserUUID(db *sql.DB, userUUID string) (*AuthSession, error) {
-	as := &AuthSession{}
-	row := db.QueryRow(fmt.Sprintf("SELECT * FROM %s WHERE useruuid = '%s'", ast.Name(), userUUID))
-	err := row.Scan(&as.Authsessionid, &as.CreatedDateTime, &as.LastActiveDateTime, &as.UserUUID, &as.SessionUUID)
+	blockKey, err := util.GenerateKey(sessionBlockKeyLength)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return as, nil
-}
 
-func (ast *AuthSessionsTable) Delete(db *sql.DB, whereClause string) error {
-	if len(whereClause) > 0 {
-		_, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s", ast.Name(), whereClause))
-		if err != nil {
+	err = skt.Insert(db, &SessionKey{
+		CreatedDateTime: time.Now().Unix(),
+		HashKey:         base64.StdEncoding.EncodeToString(hashKey),
+		BlockKey:        base64.StdEncoding.EncodeToString(blockKey),
+	})
+	if err != nil {
+		return err
+	}
+
+	keys, err := skt.SelectAll(db)
+	if err != nil {
+		return err
+	}
+
+	for i := sessionKeysKept; i < len(keys); i++ {
+		if _, err := From(TableOf(&SessionKey{})).Where(Equal("sessionkeyid", keys[i].Sessionkeyid)).Delete(db); err != nil {
 			return err
 		}
-		return nil
 	}
-	return errors.New("Where to delete clause is blank")
+
+	return nil
 }
 
-func (ast *AuthSessionsTable) DeleteBySessionUUID(db *sql.DB, sessionUUID string) error {
-	if len(sessionUUID) > 0 {
-		_, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE sessionuuid = ?", ast.Name()), sessionUUID)
-		if err != nil {
+//ReplaceUndecodable removes keys which don't decode to the right lengths, such as the hex encoded ones stored by
+//older versions, and generates new keys if none are left
+func (skt *SessionKeysTable) ReplaceUndecodable(db Querier) error {
+	keys, err := skt.SelectAll(db)
+	if err != nil {
+		return err
+	}
+
+	removed := 0
+	for _, key := range keys {
+		if _, _, err := key.Decode(); err == nil {
+			continue
+		}
+		if _, err := From(TableOf(&SessionKey{})).Where(Equal("sessionkeyid", key.Sessionkeyid)).Delete(db); err != nil {
 			return err
 		}
-		return nil
+		removed++
 	}
-	return errors.New("Session UUID to delete by is blank")
+
+	if removed > 0 && removed == len(keys) {
+		return skt.Rotate(db)
+	}
+
+	return nil
 }
 
-//BuildFields takes the table struct and maps all of the struct fields to their own struct
-func (ast *AuthSessionsTable) buildFields() []Field {
-	return buildFieldsFromTable(ast)
+// ******** End Session Keys Table ********
+
+// ******** Start Settings Table ********
+
+//SettingsTable site wide settings which can be changed while the server is running, there's only ever one row
+type SettingsTable struct{}
+
+//Init stores the default settings
+func (s *Settings) Init(db *sql.DB) {
+	settings := DefaultSettings
+	if err := Insert(db, &settings); err != nil {
+		logging.ErrorAndExit(fmt.Sprintf("Issue creating default settings: %s", err.Error()))
+	}
 }
 
-func (ast *AuthSessionsTable) buildInsertStatement(m Model) string {
-	return buildInsertStatementFromTable(ast, m)
+//Select gets the stored settings, or the defaults if there aren't any
+func (st *SettingsTable) Select(db Querier) (*Settings, error) {
+	settings := &Settings{}
+	err := Get(db, settings)
+	if err == sql.ErrNoRows {
+		defaults := DefaultSettings
+		return &defaults, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return settings, nil
 }
 
-func (ast *AuthSessionsTable) buildPreparedInsertStatement(m Model) string {
-	return buildPreparedInsertStatementFromTable(ast, m)
+//Save stores the settings in place of the existing ones
+func (st *SettingsTable) Save(db Querier, s *Settings) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	existing, err := st.Select(db)
+	if err != nil {
+		return err
+	}
+
+	//the defaults returned when nothing's been stored yet have no ID
+	if existing.Settingid == 0 {
+		s.Settingid = 0
+		return Insert(db, s)
+	}
+
+	s.Settingid = existing.Settingid
+	return Update(db, s)
 }
 
-// ******** End Auth Table ********
+// ******** End Settings Table ********
 
 // ******** Start SystemInfo Table ********
 
 type SystemInfoTable struct {
-	Version string `tbl:NN`
+	Version       string `tbl:"NN"`
+	Schemaversion int    `tbl:"NN"`
 }
 
 func (sit *SystemInfoTable) Init(db *sql.DB) {
-	err := sit.Insert(db, &SystemInfo{Version: VERSION})
+	//freshly created tables already match the latest schema so there's nothing to migrate
+	err := sit.Insert(db, &SystemInfo{Version: VERSION, SchemaVersion: LatestSchemaVersion()})
 	if err != nil {
 		logging.ErrorAndExit(fmt.Sprintf("Issue creating version string record: %s", err.Error()))
 	}
@@ -861,18 +2011,17 @@ func (sit *SystemInfoTable) Init(db *sql.DB) {
 
 func (sit *SystemInfoTable) Name() string { return "systeminfo" }
 
-func (sit *SystemInfoTable) Insert(db *sql.DB, systemInfo *SystemInfo) error {
-	insertStatement := sit.buildPreparedInsertStatement(systemInfo)
-	_, err := db.Exec(insertStatement, systemInfo.Version)
+func (sit *SystemInfoTable) Insert(db Querier, systemInfo *SystemInfo) error {
+	err := Insert(db, systemInfo)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (sit *SystemInfoTable) Update(db *sql.DB, as *SystemInfo) error {
-	updateStatement := fmt.Sprintf("UPDATE %s SET version = ?", sit.Name())
-	_, err := db.Exec(updateStatement, sit.Version)
+func (sit *SystemInfoTable) Update(db Querier, si *SystemInfo) error {
+	updateStatement := fmt.Sprintf("UPDATE %s SET version = ?, schemaversion = ?", sit.Name())
+	_, err := db.Exec(rebind(updateStatement), si.Version, si.SchemaVersion)
 	if err != nil {
 		return err
 	}
@@ -908,7 +2057,6 @@ func (sit *SystemInfoTable) buildPreparedInsertStatement(m Model) string {
 //Model describes the structure of a model
 type Model interface {
 	TableName() string
-	BuildFields() []Field
 }
 
 //User describes the content of a user, it should match the columns present in the users table
@@ -918,7 +2066,7 @@ type User struct {
 	UserroleId      int    `json:"userroleid"`
 	UUID            string `json:"UUID"`
 	Username        string `json:"username"`
-	AuthHash        string `json:"authhash"`
+	AuthHash        string `json:"-"`
 	FirstName       string `json:"firstname"`
 	LastName        string `json:"lastname"`
 	Email           string `json:"email"`
@@ -947,11 +2095,6 @@ func (u *User) TableName() string {
 	return "users"
 }
 
-//BuildFields generates a list of fields generated from the fields of the user struct
-func (u *User) BuildFields() []Field {
-	return buildFieldsFromModel(u)
-}
-
 //Validate makes sure that required fields have not been left blank
 func (u *User) Validate() error {
 	if u.Username == "" {
@@ -964,20 +2107,17 @@ func (u *User) Validate() error {
 }
 
 type Group struct {
-	Groupid         int    `tbl:"AI" json:"groupid"`
-	CreatedDateTime int64  `json:"createddatetime"`
-	UUID            string `json:"UUID"`
-	Title           string `json:"title"`
+	Groupid          int    `tbl:"AI" json:"groupid"`
+	CreatedDateTime  int64  `json:"createddatetime"`
+	UUID             string `json:"UUID"`
+	Title            string `json:"title"`
+	RequireTwoFactor bool   `json:"requiretwofactor"`
 }
 
 func (g *Group) TableName() string {
 	return "groups"
 }
 
-func (g *Group) BuildFields() []Field {
-	return buildFieldsFromModel(g)
-}
-
 func (g *Group) Validate() bool {
 	return len(g.UUID) > 0
 }
@@ -993,14 +2133,10 @@ func (gm *GroupMembership) TableName() string {
 	return "groupmemberships"
 }
 
-func (gm *GroupMembership) BuildFields() []Field {
-	return buildFieldsFromModel(gm)
-}
-
 //UserRole describes the content of a userrole entry, it should match the columns present in the userrole table
 type UserRole struct {
-	Userroleid int `tbl:"AI"`
-	Rolename   string
+	Userroleid int    `tbl:"PKNNUI"`
+	Rolename   string `tbl:"NNUI"`
 }
 
 //TableName gets the name of the userrole table
@@ -1008,28 +2144,90 @@ func (ur *UserRole) TableName() string {
 	return "userroles"
 }
 
-//BuildFields generates a list of fields generated from the fields of the userrole struct
-func (ur *UserRole) BuildFields() []Field {
-	return buildFieldsFromModel(ur)
+//RolePermission grants every user of a role a permission
+type RolePermission struct {
+	Rolepermissionid int    `tbl:"PKNNAIUI" json:"rolepermissionid"`
+	UserroleId       int    `tbl:"NN" json:"userroleid"`
+	Permission       string `tbl:"NN" json:"permission"`
+}
+
+func (rp *RolePermission) TableName() string {
+	return "rolepermissions"
+}
+
+//GroupPermission grants every member of a group a permission
+type GroupPermission struct {
+	Grouppermissionid int    `tbl:"PKNNAIUI" json:"grouppermissionid"`
+	CreatedDateTime   int64  `tbl:"NNDT" json:"createddatetime"`
+	GroupUUID         string `tbl:"NN" json:"groupUUID"`
+	Permission        string `tbl:"NN" json:"permission"`
+}
+
+func (gp *GroupPermission) TableName() string {
+	return "grouppermissions"
 }
 
 type Page struct {
-	PageId          int    `tbl:"AI" json:"pageid"`
-	CreatedDateTime int64  `json:"createddatetime"`
-	UUID            string `json:"UUID"`
-	Roleprotected   bool   `json:"roleprotected"`
-	AuthorUUID      string `json:"authoruuid"`
-	Title           string `json:"title"`
-	Route           string `json:"route"`
-	Content         string `json:"content"`
+	PageId            int        `tbl:"AI" json:"pageid"`
+	CreatedDateTime   int64      `json:"createddatetime"`
+	UUID              string     `json:"UUID"`
+	Roleprotected     bool       `json:"roleprotected"`
+	AuthorUUID        string     `json:"authoruuid"`
+	Title             string     `json:"title"`
+	Route             string     `json:"route"`
+	Content           string     `json:"content"`
+	Status            PageStatus `json:"status"`
+	PublishDateTime   int64      `json:"publishdatetime"`
+	UnpublishDateTime int64      `json:"unpublishdatetime"`
+}
+
+//IsLive checks whether the page should be publicly reachable at the given unix time
+func (p *Page) IsLive(now int64) bool {
+	if p.UnpublishDateTime > 0 && p.UnpublishDateTime <= now {
+		return false
+	}
+
+	switch p.Status {
+	case PAGE_PUBLISHED:
+		return true
+	case PAGE_SCHEDULED:
+		return p.PublishDateTime <= now
+	}
+
+	return false
 }
 
 func (p *Page) TableName() string {
 	return "pages"
 }
 
-func (p *Page) BuildFields() []Field {
-	return buildFieldsFromModel(p)
+//PageGroupPermission grants the members of a group read or edit access to a page
+type PageGroupPermission struct {
+	Pagegrouppermissionid int    `tbl:"PKNNAIUI" json:"pagegrouppermissionid"`
+	CreatedDateTime       int64  `tbl:"NNDT" json:"createddatetime"`
+	PageUUID              string `tbl:"NN" json:"pageUUID"`
+	GroupUUID             string `tbl:"NN" json:"groupUUID"`
+	Permission            int    `tbl:"NN" json:"permission"`
+}
+
+func (pgp *PageGroupPermission) TableName() string {
+	return "pagegrouppermissions"
+}
+
+//PageRevision describes a saved copy of a page's content at the time it was edited
+type PageRevision struct {
+	Pagerevisionid  int    `tbl:"PKNNAIUI" json:"pagerevisionid"`
+	CreatedDateTime int64  `tbl:"NNDT" json:"createddatetime"`
+	UUID            string `tbl:"NNUI" json:"UUID"`
+	PageUUID        string `tbl:"NN" json:"pageUUID"`
+	AuthorUUID      string `tbl:"NN" json:"authoruuid"`
+	Title           string `tbl:"NN" json:"title"`
+	Route           string `tbl:"NN" json:"route"`
+	Content         string `tbl:"NN" json:"content"`
+}
+
+func (pr *PageRevision) TableName() string {
+	return "pagerevisions"
 }
 
 type AuthSession struct {
@@ -1037,33 +2235,280 @@ type AuthSession struct {
 	CreatedDateTime    int64  `json:"createddatetime"`
 	LastActiveDateTime int64  `json:"lastactivedatetime"`
 	UserUUID           string `json:"userUUID"`
-	SessionUUID        string `json:"sessionUUID"`
+	SessionUUID        string `json:"-"`
+	IPAddress          string `json:"ipaddress"`
+	UserAgent          string `json:"useragent"`
+	Remember           bool   `json:"remember"`
 }
 
 func (as *AuthSession) TableName() string {
 	return "authsessions"
 }
 
-func (as *AuthSession) BuildFields() []Field {
-	return buildFieldsFromModel(as)
-}
-
 func (as *AuthSession) Validate() bool {
 	return len(as.UserUUID) > 0 && len(as.SessionUUID) > 0
 }
 
+//IsExpired checks whether the session has been idle or alive for too long at the given time, matching DeleteExpired
+func (as *AuthSession) IsExpired(now int64, idleTimeout int64, maxAge int64, rememberMaxAge int64) bool {
+	if as.Remember {
+		return as.CreatedDateTime+rememberMaxAge <= now
+	}
+	return as.LastActiveDateTime+idleTimeout <= now || as.CreatedDateTime+maxAge <= now
+}
+
+//UserTwoFactor a user's TOTP secret, it's only used to log in once enrolment has been confirmed with a valid code
+type UserTwoFactor struct {
+	Usertwofactorid int    `tbl:"PKNNAIUI" json:"usertwofactorid"`
+	CreatedDateTime int64  `tbl:"NNDT" json:"createddatetime"`
+	UserUUID        string `tbl:"NNUI" json:"useruuid"`
+	Secret          string `tbl:"NN" json:"-"`
+	Enabled         bool   `tbl:"NN" json:"enabled"`
+	LastUsedStep    int64  `tbl:"NN" json:"-"`
+}
+
+func (utf *UserTwoFactor) TableName() string {
+	return "usertwofactor"
+}
+
+//RecoveryCode hash of a single use code which can be used instead of a TOTP code
+type RecoveryCode struct {
+	Recoverycodeid  int    `tbl:"PKNNAIUI" json:"recoverycodeid"`
+	CreatedDateTime int64  `tbl:"NNDT" json:"createddatetime"`
+	UserUUID        string `tbl:"NN" json:"useruuid"`
+	CodeHash        string `tbl:"NNUI" json:"-"`
+}
+
+func (rc *RecoveryCode) TableName() string {
+	return "recoverycodes"
+}
+
+//LoginAttempt a failed attempt to log in
+type LoginAttempt struct {
+	Loginattemptid  int    `tbl:"PKNNAIUI" json:"loginattemptid"`
+	CreatedDateTime int64  `tbl:"NNDT" json:"createddatetime"`
+	Username        string `tbl:"NN" json:"username"`
+	IPAddress       string `tbl:"NN" json:"ipaddress"`
+}
+
+func (la *LoginAttempt) TableName() string {
+	return "loginattempts"
+}
+
+//AccountLock a lockout of a user's account after too many failed login attempts
+type AccountLock struct {
+	Accountlockid   int    `tbl:"PKNNAIUI" json:"accountlockid"`
+	CreatedDateTime int64  `tbl:"NNDT" json:"createddatetime"`
+	UserUUID        string `tbl:"NN" json:"useruuid"`
+	IPAddress       string `tbl:"NN" json:"ipaddress"`
+	LockedUntil     int64  `tbl:"NN" json:"lockeduntil"`
+	ClearedDateTime int64  `tbl:"NN" json:"cleareddatetime"`
+	ClearedByUUID   string `tbl:"NN" json:"clearedbyuuid"`
+}
+
+func (al *AccountLock) TableName() string {
+	return "accountlocks"
+}
+
+//SessionKey base64 encoded pair of keys cookies are signed and encrypted with
+type SessionKey struct {
+	Sessionkeyid    int    `tbl:"PKNNAIUI" json:"sessionkeyid"`
+	CreatedDateTime int64  `tbl:"NNDT" json:"createddatetime"`
+	HashKey         string `tbl:"NN" json:"-"`
+	BlockKey        string `tbl:"NN" json:"-"`
+}
+
+func (sk *SessionKey) TableName() string {
+	return "sessionkeys"
+}
+
+//Decode gets the raw hash and block keys, making sure they're the lengths cookies are signed and encrypted with
+func (sk *SessionKey) Decode() ([]byte, []byte, error) {
+	hashKey, err := base64.StdEncoding.DecodeString(sk.HashKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(hashKey) != sessionHashKeyLength {
+		return nil, nil, fmt.Errorf("Session hash key %d is %d bytes long instead of %d", sk.Sessionkeyid, len(hashKey), sessionHashKeyLength)
+	}
+
+	blockKey, err := base64.StdEncoding.DecodeString(sk.BlockKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(blockKey) != sessionBlockKeyLength {
+		return nil, nil, fmt.Errorf("Session block key %d is %d bytes long instead of %d", sk.Sessionkeyid, len(blockKey), sessionBlockKeyLength)
+	}
+
+	return hashKey, blockKey, nil
+}
+
+//APIToken personal token a user can authenticate API requests with, limited to the permissions in its scopes
+type APIToken struct {
+	Apitokenid       int    `tbl:"PKNNAIUI" json:"apitokenid"`
+	CreatedDateTime  int64  `tbl:"NNDT" json:"createddatetime"`
+	UUID             string `tbl:"NNUI" json:"UUID"`
+	UserUUID         string `tbl:"NN" json:"useruuid"`
+	Title            string `tbl:"NN" json:"title"`
+	TokenHash        string `tbl:"NNUI" json:"-"`
+	Scopes           string `tbl:"NNTX" json:"scopes"`
+	ExpiresDateTime  int64  `tbl:"NNDT" json:"expiresdatetime"`
+	LastUsedDateTime int64  `tbl:"NNDT" json:"lastuseddatetime"`
+}
+
+func (at *APIToken) TableName() string {
+	return "apitokens"
+}
+
+//ScopeList splits the stored comma separated scopes into permissions
+func (at *APIToken) ScopeList() []Permission {
+	scopes := make([]Permission, 0)
+	for _, scope := range strings.Split(at.Scopes, ",") {
+		if len(scope) > 0 {
+			scopes = append(scopes, Permission(scope))
+		}
+	}
+	return scopes
+}
+
+type PasswordReset struct {
+	Passwordresetid int    `tbl:"PKNNAIUI" json:"passwordresetid"`
+	CreatedDateTime int64  `tbl:"NNDT" json:"createddatetime"`
+	UserUUID        string `tbl:"NNFK(users.uuid,CASCADE)" json:"useruuid"`
+	TokenHash       string `tbl:"NNUI" json:"-"`
+	ExpiresDateTime int64  `tbl:"NNDT" json:"expiresdatetime"`
+	UsedDateTime    int64  `tbl:"NNDT" json:"useddatetime"`
+}
+
+func (pr *PasswordReset) TableName() string {
+	return "passwordresets"
+}
+
+//IsUsable checks that the reset hasn't been used or expired
+func (pr *PasswordReset) IsUsable(now int64) bool {
+	return pr.UsedDateTime == 0 && pr.ExpiresDateTime > now
+}
+
+type Registration struct {
+	Registrationid   int    `tbl:"PKNNAIUI" json:"registrationid"`
+	CreatedDateTime  int64  `tbl:"NNDT" json:"createddatetime"`
+	Username         string `tbl:"NNUI" json:"username"`
+	Email            string `tbl:"NNUI" json:"email"`
+	FirstName        string `tbl:"NN" json:"firstname"`
+	LastName         string `tbl:"NN" json:"lastname"`
+	AuthHash         string `tbl:"NN" json:"-"`
+	TokenHash        string `tbl:"NNUI" json:"-"`
+	ExpiresDateTime  int64  `tbl:"NNDT" json:"expiresdatetime"`
+	VerifiedDateTime int64  `tbl:"NNDT" json:"verifieddatetime"`
+}
+
+func (reg *Registration) TableName() string {
+	return "registrations"
+}
+
+//SetScopes stores the permissions as a comma separated list
+func (at *APIToken) SetScopes(scopes []Permission) {
+	scopeNames := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scopeNames = append(scopeNames, string(scope))
+	}
+	at.Scopes = strings.Join(scopeNames, ",")
+}
+
+//HasScope checks whether the token is allowed to be used for the permission
+func (at *APIToken) HasScope(permission Permission) bool {
+	if permission == PERM_NONE {
+		return true
+	}
+	for _, scope := range at.ScopeList() {
+		if scope == permission {
+			return true
+		}
+	}
+	return false
+}
+
+//IsExpired checks whether the token's expiry time has passed, tokens without one never expire
+func (at *APIToken) IsExpired(now int64) bool {
+	return at.ExpiresDateTime > 0 && at.ExpiresDateTime <= now
+}
+
+//themeNameRegex theme names are used as stylesheet file names, so they can't refer to anything outside the CSS directory
+var themeNameRegex = regexp.MustCompile("^[A-Za-z0-9_-]+$")
+
+//Settings site wide settings, session timeouts are in seconds
+type Settings struct {
+	Settingid        int    `tbl:"PKNNAIUI" json:"settingid"`
+	SiteTitle        string `tbl:"NN" json:"sitetitle"`
+	BaseURL          string `tbl:"NN" json:"baseurl"`
+	DefaultTheme     string `tbl:"NN" json:"defaulttheme"`
+	RobotsEnabled    bool   `tbl:"NN" json:"robotsenabled"`
+	SitemapEnabled   bool   `tbl:"NN" json:"sitemapenabled"`
+	SessionIdle      int64  `tbl:"NN" json:"sessionidle"`
+	SessionMaxAge    int64  `tbl:"NN" json:"sessionmaxage"`
+	RememberMaxAge   int64  `tbl:"NN" json:"remembermaxage"`
+	RegistrationOpen bool   `tbl:"NN" json:"registrationopen"`
+	//DefaultGroup title of the group approved registrations are put in
+	DefaultGroup string `tbl:"NN" json:"defaultgroup"`
+}
+
+//DefaultSettings settings a new site starts off with
+var DefaultSettings = Settings{
+	SiteTitle:      "Berry CMS",
+	DefaultTheme:   "berry-default",
+	RobotsEnabled:  true,
+	SitemapEnabled: true,
+	SessionIdle:    int64((time.Minute * 20).Seconds()),
+	SessionMaxAge:  int64((time.Hour * 12).Seconds()),
+	RememberMaxAge: int64((time.Hour * 24 * 30).Seconds()),
+	DefaultGroup:   "Users",
+}
+
+func (s *Settings) TableName() string {
+	return "settings"
+}
+
+//Validate makes sure that the settings won't break the site
+func (s *Settings) Validate() error {
+	if len(strings.TrimSpace(s.SiteTitle)) == 0 {
+		return fmt.Errorf("Site title can't be blank")
+	}
+
+	if len(s.BaseURL) > 0 {
+		u, err := url.Parse(s.BaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+			return fmt.Errorf("Base URL %s must be a full http or https address", s.BaseURL)
+		}
+	}
+
+	if !themeNameRegex.MatchString(s.DefaultTheme) {
+		return fmt.Errorf("Theme name %s can only contain letters, numbers, dashes and underscores", s.DefaultTheme)
+	}
+
+	if s.SessionIdle <= 0 || s.SessionMaxAge <= 0 || s.RememberMaxAge <= 0 {
+		return fmt.Errorf("Session timeouts must all be greater than zero")
+	}
+
+	if s.SessionIdle > s.SessionMaxAge {
+		return fmt.Errorf("Session idle timeout can't be longer than the maximum session age")
+	}
+
+	if len(strings.TrimSpace(s.DefaultGroup)) == 0 {
+		return fmt.Errorf("Default group for new registrations can't be blank")
+	}
+
+	return nil
+}
+
 type SystemInfo struct {
-	Version string `json:"version"`
+	Version       string `json:"version"`
+	SchemaVersion int    `json:"schemaversion"`
 }
 
 func (si *SystemInfo) TableName() string {
 	return "systeminfo"
 }
 
-func (si *SystemInfo) BuildFields() []Field {
-	return buildFieldsFromModel(si)
-}
-
 // ****************************************** END MODELS ******************************************
 
 func buildInsertStatementFromTable(t Table, m Model) string {
@@ -1084,7 +2529,7 @@ func buildInsertStatementFromTable(t Table, m Model) string {
 	}
 	insertStatementBuilder.WriteString(") VALUES (")
 
-	modelFields := m.BuildFields()
+	modelFields := buildFieldsFromModel(m)
 	modelFieldsCount := len(modelFields)
 
 	for i := 0; i < modelFieldsCount; i++ {
@@ -1131,7 +2576,7 @@ func buildValuesList(m Model) string {
 	var insertStatementBuilder bytes.Buffer
 	insertStatementBuilder.WriteString("(")
 
-	modelFields := m.BuildFields()
+	modelFields := buildFieldsFromModel(m)
 	modelFieldsCount := len(modelFields)
 
 	for i := 0; i < modelFieldsCount; i++ {
@@ -1182,9 +2627,12 @@ func buildFieldsFromModel(m Model) []Field {
 
 //using reflection to map the model struct to a create statement
 func buildFieldsFromTable(t Table) []Field {
-	fields := make([]Field, 0)
+	return buildFieldsFromStruct(reflect.ValueOf(t).Elem())
+}
 
-	tableStructValue := reflect.ValueOf(t).Elem()
+//buildFieldsFromStruct maps each field of the struct to a column named after it in lower case
+func buildFieldsFromStruct(tableStructValue reflect.Value) []Field {
+	fields := make([]Field, 0)
 	tableStructType := tableStructValue.Type()
 
 	for i := 0; i < tableStructValue.NumField(); i++ {
@@ -1206,7 +2654,7 @@ func buildFieldsFromTable(t Table) []Field {
 func createStatement(t Table) string {
 	//using 'strings' buffer struct as more efficient than concatination
 	var stringBulder bytes.Buffer
-	stringBulder.WriteString(fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s` (", t.Name()))
+	stringBulder.WriteString(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (", quoteIdentifier(t.Name())))
 
 	//generate field struct instances from table
 	tableFields := t.buildFields()
@@ -1221,7 +2669,7 @@ func createStatement(t Table) string {
 	for j := 0; j < tableFieldsCount; j++ {
 		field := tableFields[j]
 		//add SQL field name and type to create statement
-		stringBulder.WriteString(fmt.Sprintf("`%s` %s", field.Name, field.Type))
+		stringBulder.WriteString(fmt.Sprintf("%s %s", quoteIdentifier(field.Name), field.Type))
 		if field.PrimaryKey {
 			//TODO: Change this check structure to care about PK > 1 for any DB type...
 			if Type == MySQL {
@@ -1229,7 +2677,7 @@ func createStatement(t Table) string {
 				if pkFieldCount > 1 {
 					logging.ErrorAndExit(fmt.Sprintf("Error creating %s table: More than one PK field found...", t.Name()))
 				}
-			} else if Type == SQLITE {
+			} else if Type == SQLITE || Type == Postgres {
 				stringBulder.WriteString(" PRIMARY KEY")
 			}
 			pkField = field
@@ -1249,7 +2697,7 @@ func createStatement(t Table) string {
 			if Type == MySQL {
 				uniqueIndexFields = append(uniqueIndexFields, field)
 				uniqueIndexFieldsCount++
-			} else if Type == SQLITE {
+			} else if Type == SQLITE || Type == Postgres {
 				stringBulder.WriteString(" UNIQUE")
 			}
 		}
@@ -1274,6 +2722,22 @@ func createStatement(t Table) string {
 		}
 	}
 
+	for _, field := range tableFields {
+		if field.ForeignKey != nil {
+			stringBulder.WriteString(fmt.Sprintf(", %s", foreignKeyConstraint(t, field)))
+		}
+	}
+
 	stringBulder.WriteString(");")
 	return stringBulder.String()
 }
+
+//foreignKeyConstraint the named table constraint enforcing the field's foreign key, named so that it can be found again to drop
+func foreignKeyConstraint(t Table, field Field) string {
+	return fmt.Sprintf("CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s) ON DELETE %s",
+		quoteIdentifier(fmt.Sprintf("fk_%s_%s", t.Name(), field.Name)),
+		quoteIdentifier(field.Name),
+		quoteIdentifier(field.ForeignKey.Table),
+		quoteIdentifier(field.ForeignKey.Column),
+		field.ForeignKey.OnDelete)
+}
@@ -0,0 +1,673 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPageGroupPermissions(t *testing.T) {
+	gt := GroupTable{}
+	group, err := gt.SelectByTitle(Conn, "Moderators")
+	if err != nil || len(group.UUID) == 0 {
+		t.Fatalf("Unable to find default moderators group: %v", err)
+	}
+
+	pageUUID := "page-group-permissions-test"
+	pgpt := PageGroupPermissionsTable{}
+	defer pgpt.DeleteByPageUUID(Conn, pageUUID)
+
+	if canRead, _ := pgpt.UserHasPermission(Conn, nil, pageUUID, PAGE_READ); !canRead {
+		t.Errorf("Page without any groups attached should be readable by anonymous visitors")
+	}
+
+	err = pgpt.ReplaceForPage(Conn, pageUUID, []PageGroupPermission{
+		{CreatedDateTime: time.Now().Unix(), GroupUUID: group.UUID, Permission: int(PAGE_READ)},
+	})
+	if err != nil {
+		t.Fatalf("Unable to attach group to page: %v", err)
+	}
+
+	if canRead, _ := pgpt.UserHasPermission(Conn, nil, pageUUID, PAGE_READ); canRead {
+		t.Errorf("Page restricted to a group should not be readable by anonymous visitors")
+	}
+
+	nonMember := &User{UUID: "not-a-group-member", UserroleId: int(REG_USER)}
+	if canRead, _ := pgpt.UserHasPermission(Conn, nonMember, pageUUID, PAGE_READ); canRead {
+		t.Errorf("Page restricted to a group should not be readable by users outside of it")
+	}
+
+	rootUser := &User{UUID: "root-user", UserroleId: int(ROOT_USER)}
+	if canRead, _ := pgpt.UserHasPermission(Conn, rootUser, pageUUID, PAGE_READ); !canRead {
+		t.Errorf("Root user should always be able to read restricted pages")
+	}
+}
+
+func TestPageGroupPermissionsEditReadRestricted(t *testing.T) {
+	gt := GroupTable{}
+	group, err := gt.SelectByTitle(Conn, "Moderators")
+	if err != nil || len(group.UUID) == 0 {
+		t.Fatalf("Unable to find default moderators group: %v", err)
+	}
+
+	pageUUID := "page-group-permissions-edit-test"
+	pgpt := PageGroupPermissionsTable{}
+	defer pgpt.DeleteByPageUUID(Conn, pageUUID)
+
+	err = pgpt.ReplaceForPage(Conn, pageUUID, []PageGroupPermission{
+		{CreatedDateTime: time.Now().Unix(), GroupUUID: group.UUID, Permission: int(PAGE_READ)},
+	})
+	if err != nil {
+		t.Fatalf("Unable to attach group to page: %v", err)
+	}
+
+	if canEdit, _ := pgpt.UserHasPermission(Conn, nil, pageUUID, PAGE_EDIT); canEdit {
+		t.Errorf("Read restricted page should not be editable by anonymous visitors")
+	}
+
+	nonMember := &User{UUID: "not-a-group-member", UserroleId: int(REG_USER)}
+	if canEdit, _ := pgpt.UserHasPermission(Conn, nonMember, pageUUID, PAGE_EDIT); canEdit {
+		t.Errorf("Read restricted page should not be editable by users outside of its groups")
+	}
+
+	ut := UsersTable{}
+	member := &User{
+		CreatedDateTime: time.Now().Unix(),
+		UserroleId:      int(REG_USER),
+		Username:        "pagegroupmember",
+		AuthHash:        "pagegroupmemberhash",
+		FirstName:       "Page",
+		LastName:        "Member",
+		Email:           "pagegroupmember@local.com",
+	}
+	if err := ut.Insert(Conn, member); err != nil {
+		t.Fatalf("Unable to insert user: %v", err)
+	}
+	defer ut.DeleteByUUID(Conn, member.UUID)
+
+	gmt := GroupMembershipTable{}
+	if err := gmt.Insert(Conn, &GroupMembership{CreatedDateTime: time.Now().Unix(), GroupUUID: group.UUID, UserUUID: member.UUID}); err != nil {
+		t.Fatalf("Unable to add user to group: %v", err)
+	}
+	defer gmt.DeleteUserFromGroup(Conn, member, group)
+
+	if canEdit, _ := pgpt.UserHasPermission(Conn, member, pageUUID, PAGE_EDIT); !canEdit {
+		t.Errorf("Members of a group that can read the page should be able to edit it when no group has edit rights")
+	}
+}
+
+func TestUserRolePermissions(t *testing.T) {
+	ut := UsersTable{}
+
+	regularUser := &User{UUID: "regular-user", UserroleId: int(REG_USER)}
+	if canEdit, _ := ut.HasPermission(Conn, regularUser, PERM_PAGES_EDIT); !canEdit {
+		t.Errorf("Regular users should be able to edit pages by default")
+	}
+
+	if canDelete, _ := ut.HasPermission(Conn, regularUser, PERM_USERS_DELETE); canDelete {
+		t.Errorf("Regular users should not be able to delete users by default")
+	}
+
+	rootUser := &User{UUID: "root-user", UserroleId: int(ROOT_USER)}
+	if canDelete, _ := ut.HasPermission(Conn, rootUser, PERM_USERS_DELETE); !canDelete {
+		t.Errorf("Root user should have every permission")
+	}
+}
+
+func TestAPITokenScopes(t *testing.T) {
+	at := &APIToken{ExpiresDateTime: 100}
+	at.SetScopes([]Permission{PERM_PAGES_VIEW, PERM_PAGES_EDIT})
+
+	if !at.HasScope(PERM_PAGES_EDIT) {
+		t.Errorf("Token should have scope %s, scopes: %s", PERM_PAGES_EDIT, at.Scopes)
+	}
+
+	if at.HasScope(PERM_USERS_DELETE) {
+		t.Errorf("Token should not have scope %s, scopes: %s", PERM_USERS_DELETE, at.Scopes)
+	}
+
+	if at.IsExpired(99) || !at.IsExpired(100) {
+		t.Errorf("Token should expire exactly at its expiry time")
+	}
+}
+
+func TestAPITokenEveryScope(t *testing.T) {
+	for _, field := range TableOf(&APIToken{}).buildFields() {
+		if field.Name == "scopes" && field.Type != "TEXT" {
+			t.Errorf("Scopes should be stored as text, every permission is too long for %s", field.Type)
+		}
+	}
+
+	ut := UsersTable{}
+	u := &User{
+		CreatedDateTime: time.Now().Unix(),
+		UserroleId:      int(REG_USER),
+		Username:        "everyscope",
+		AuthHash:        "everyscopehash",
+		FirstName:       "Every",
+		LastName:        "Scope",
+		Email:           "everyscope@local.com",
+	}
+	if err := ut.Insert(Conn, u); err != nil {
+		t.Fatalf("Unable to insert user: %v", err)
+	}
+	defer ut.DeleteByUUID(Conn, u.UUID)
+
+	att := APITokensTable{}
+	at := &APIToken{CreatedDateTime: time.Now().Unix(), UserUUID: u.UUID, Title: "Every scope", TokenHash: "every-scope-token", ExpiresDateTime: time.Now().Unix() + 3600}
+	at.SetScopes(AllPermissions)
+	if err := att.Insert(Conn, at); err != nil {
+		t.Fatalf("Unable to insert token with every scope: %v", err)
+	}
+	defer att.DeleteByUserUUID(Conn, u.UUID)
+
+	stored, err := att.SelectByTokenHash(Conn, at.TokenHash)
+	if err != nil {
+		t.Fatalf("Unable to load token: %v", err)
+	}
+
+	for _, permission := range AllPermissions {
+		if !stored.HasScope(permission) {
+			t.Errorf("Stored token should have scope %s, scopes: %s", permission, stored.Scopes)
+		}
+	}
+}
+
+func TestRecoveryCodesSingleUse(t *testing.T) {
+	userUUID := "recovery-codes-test"
+	rct := RecoveryCodesTable{}
+	defer rct.DeleteByUserUUID(Conn, userUUID)
+
+	if err := rct.ReplaceForUser(Conn, userUUID, []string{"first", "second"}); err != nil {
+		t.Fatalf("Unable to store recovery codes: %v", err)
+	}
+
+	if used, _ := rct.Use(Conn, userUUID, "first"); !used {
+		t.Errorf("Unused recovery code should be accepted")
+	}
+
+	if used, _ := rct.Use(Conn, userUUID, "first"); used {
+		t.Errorf("Recovery code should not be accepted twice")
+	}
+
+	if count, _ := rct.CountByUserUUID(Conn, userUUID); count != 1 {
+		t.Errorf("Expected 1 remaining recovery code, got %d", count)
+	}
+}
+
+func TestAccountLocks(t *testing.T) {
+	userUUID := "account-locks-test"
+	alt := AccountLocksTable{}
+	defer alt.DeleteByUserUUID(Conn, userUUID)
+
+	now := time.Now().Unix()
+	if err := alt.Insert(Conn, &AccountLock{CreatedDateTime: now, UserUUID: userUUID, LockedUntil: now + 60}); err != nil {
+		t.Fatalf("Unable to lock account: %v", err)
+	}
+
+	if lockedUntil, _ := alt.ActiveLockUntil(Conn, userUUID, now); lockedUntil != now+60 {
+		t.Errorf("Account should be locked until %d, got %d", now+60, lockedUntil)
+	}
+
+	if lockedUntil, _ := alt.ActiveLockUntil(Conn, userUUID, now+60); lockedUntil != 0 {
+		t.Errorf("Account lock should have run out")
+	}
+
+	if _, err := alt.Clear(Conn, userUUID, "root-user", now); err != nil {
+		t.Fatalf("Unable to clear account lock: %v", err)
+	}
+
+	if lockedUntil, _ := alt.ActiveLockUntil(Conn, userUUID, now); lockedUntil != 0 {
+		t.Errorf("Cleared account lock should no longer be active")
+	}
+
+	if count, _ := alt.CountSince(Conn, userUUID, now); count != 1 {
+		t.Errorf("Cleared lock event should still be recorded, got %d", count)
+	}
+}
+
+func TestSessionKeysRotate(t *testing.T) {
+	skt := SessionKeysTable{}
+	before, err := skt.SelectAll(Conn)
+	if err != nil || len(before) == 0 {
+		t.Fatalf("Session keys should be generated on setup: %v", err)
+	}
+
+	for i := 0; i < sessionKeysKept+1; i++ {
+		if err := skt.Rotate(Conn); err != nil {
+			t.Fatalf("Unable to rotate session keys: %v", err)
+		}
+	}
+
+	after, _ := skt.SelectAll(Conn)
+	if len(after) != sessionKeysKept {
+		t.Errorf("Expected %d session keys to be kept, got %d", sessionKeysKept, len(after))
+	}
+
+	if after[0].HashKey == before[0].HashKey {
+		t.Errorf("Rotating should sign with a new key")
+	}
+
+	if _, _, err := after[0].Decode(); err != nil {
+		t.Errorf("Rotated session keys should decode: %v", err)
+	}
+}
+
+func TestSessionKeysReplaceUndecodable(t *testing.T) {
+	skt := SessionKeysTable{}
+	keys, _ := skt.SelectAll(Conn)
+	for _, key := range keys {
+		From(TableOf(&SessionKey{})).Where(Equal("sessionkeyid", key.Sessionkeyid)).Delete(Conn)
+	}
+
+	//keys used to be hex encoded, which is still valid base64 but decodes to the wrong lengths
+	err := skt.Insert(Conn, &SessionKey{CreatedDateTime: time.Now().Unix(), HashKey: strings.Repeat("ab", 64), BlockKey: strings.Repeat("cd", 32)})
+	if err != nil {
+		t.Fatalf("Unable to insert hex encoded session key: %v", err)
+	}
+
+	if err := skt.ReplaceUndecodable(Conn); err != nil {
+		t.Fatalf("Unable to replace undecodable session keys: %v", err)
+	}
+
+	keys, _ = skt.SelectAll(Conn)
+	if len(keys) != 1 {
+		t.Fatalf("Hex encoded session key should be replaced by a single new one, got %d", len(keys))
+	}
+
+	if _, _, err := keys[0].Decode(); err != nil {
+		t.Errorf("Replacement session key should decode: %v", err)
+	}
+}
+
+func TestAuthSessionsPerUser(t *testing.T) {
+	userUUID := "auth-sessions-test"
+	ast := AuthSessionsTable{}
+	defer ast.DeleteByUserUUID(Conn, userUUID)
+
+	for _, sessionUUID := range []string{"first-session", "second-session"} {
+		err := ast.Insert(Conn, &AuthSession{CreatedDateTime: time.Now().Unix(), LastActiveDateTime: time.Now().Unix(), UserUUID: userUUID, SessionUUID: sessionUUID})
+		if err != nil {
+			t.Fatalf("Unable to create session %s: %v", sessionUUID, err)
+		}
+	}
+
+	authSessions, _ := ast.SelectByUserUUID(Conn, userUUID)
+	if len(authSessions) != 2 {
+		t.Fatalf("Expected user to have 2 concurrent sessions, got %d", len(authSessions))
+	}
+
+	if numDeleted, _ := ast.DeleteByID(Conn, authSessions[0].Authsessionid, "another-user"); numDeleted != 0 {
+		t.Errorf("Session should not be revoked on behalf of a different user")
+	}
+
+	if numDeleted, _ := ast.DeleteByID(Conn, authSessions[0].Authsessionid, userUUID); numDeleted != 1 {
+		t.Errorf("Expected 1 session to be revoked, got %d", numDeleted)
+	}
+}
+
+func TestAuthSessionExpiry(t *testing.T) {
+	as := &AuthSession{CreatedDateTime: 0, LastActiveDateTime: 100}
+
+	if as.IsExpired(119, 20, 1000, 5000) {
+		t.Errorf("Session should not expire before its idle timeout")
+	}
+
+	if !as.IsExpired(120, 20, 1000, 5000) {
+		t.Errorf("Session should expire once idle for too long")
+	}
+
+	as.LastActiveDateTime = 1000
+	if !as.IsExpired(1000, 20, 1000, 5000) {
+		t.Errorf("Active session should still expire at its maximum age")
+	}
+
+	as.Remember = true
+	if as.IsExpired(4999, 20, 1000, 5000) || !as.IsExpired(5000, 20, 1000, 5000) {
+		t.Errorf("Remembered session should only expire at its own maximum age")
+	}
+}
+
+func TestParseForeignKey(t *testing.T) {
+	fk, err := parseForeignKey("NNFK(users.uuid,cascade)")
+	if err != nil {
+		t.Fatalf("Unable to parse foreign key: %v", err)
+	}
+
+	if *fk != (ForeignKey{Table: "users", Column: "uuid", OnDelete: "CASCADE"}) {
+		t.Errorf("Parsed foreign key %v doesn't match the tag", *fk)
+	}
+
+	if fk, _ := parseForeignKey("NNFK(users.uuid)"); fk == nil || fk.OnDelete != "RESTRICT" {
+		t.Errorf("Foreign key without an action should restrict deletes, got %v", fk)
+	}
+
+	if fk, _ := parseForeignKey("NNUI"); fk != nil {
+		t.Errorf("Tag without a foreign key shouldn't produce one, got %v", fk)
+	}
+
+	for _, tag := range []string{"FK(users.uuid", "FK(users,CASCADE)", "FK(users.uuid,EXPLODE)", "FK(users.uuid,CASCADE,RESTRICT)"} {
+		if _, err := parseForeignKey(tag); err == nil {
+			t.Errorf("Malformed foreign key tag %s should fail to parse", tag)
+		}
+	}
+}
+
+func TestForeignKeyCreateStatement(t *testing.T) {
+	for _, dbType := range []DBType{MySQL, SQLITE} {
+		restore := withType(dbType)
+
+		statement := createStatement(&GroupMembershipTable{})
+		for _, expected := range []string{
+			fmt.Sprintf("CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s) ON DELETE CASCADE", quoteIdentifier("fk_groupmemberships_groupuuid"), quoteIdentifier("groupuuid"), quoteIdentifier("groups"), quoteIdentifier("uuid")),
+			fmt.Sprintf("CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s) ON DELETE CASCADE", quoteIdentifier("fk_groupmemberships_useruuid"), quoteIdentifier("useruuid"), quoteIdentifier("users"), quoteIdentifier("uuid")),
+		} {
+			if !strings.Contains(statement, expected) {
+				t.Errorf("Create statement %s should contain %s", statement, expected)
+			}
+		}
+
+		if field := (&GroupMembershipTable{}).buildFields()[2]; field.UniqueIndex || !field.NotNull {
+			t.Errorf("Referenced column names in the tag shouldn't be read as flags, got %v", field)
+		}
+
+		restore()
+	}
+}
+
+func TestForeignKeysOnDelete(t *testing.T) {
+	ut := UsersTable{}
+	u := &User{
+		CreatedDateTime: time.Now().Unix(),
+		Username:        "foreignkeys",
+		AuthHash:        "hash",
+		FirstName:       "Foreign",
+		LastName:        "Keys",
+		Email:           "foreignkeys@local.com",
+	}
+	if err := ut.Insert(Conn, u); err != nil {
+		t.Fatalf("Unable to insert user: %v", err)
+	}
+	defer ut.DeleteByUUID(Conn, u.UUID)
+
+	gmt := GroupMembershipTable{}
+	if err := gmt.AddUserToGroup(Conn, u, "Users"); err != nil {
+		t.Fatalf("Unable to add user to group: %v", err)
+	}
+
+	pt := PagesTable{}
+	p := &Page{CreatedDateTime: time.Now().Unix(), AuthorUUID: u.UUID, Title: "Foreign Keys", Route: "/foreignkeys", Content: "[]"}
+	if err := pt.Insert(Conn, p); err != nil {
+		t.Fatalf("Unable to insert page: %v", err)
+	}
+
+	if _, err := ut.DeleteByUUID(Conn, u.UUID); err == nil {
+		t.Errorf("Deleting the author of a page should be refused")
+	}
+
+	if _, err := pt.DeleteByUUID(Conn, p.UUID); err != nil {
+		t.Fatalf("Unable to delete page: %v", err)
+	}
+
+	if _, err := ut.DeleteByUUID(Conn, u.UUID); err != nil {
+		t.Fatalf("Unable to delete user: %v", err)
+	}
+
+	if count, err := From(&gmt).Where(Equal("useruuid", u.UUID)).Count(Conn); err != nil || count != 0 {
+		t.Errorf("Deleting a user should delete their group memberships, %d left: %v", count, err)
+	}
+
+	orphan := &Page{CreatedDateTime: time.Now().Unix(), AuthorUUID: "no-such-author", Title: "Orphan", Route: "/orphan", Content: "[]"}
+	if err := pt.Insert(Conn, orphan); err == nil {
+		pt.DeleteByUUID(Conn, orphan.UUID)
+		t.Errorf("Pages shouldn't be saved with authors who don't exist")
+	}
+}
+
+func TestSettingsValidate(t *testing.T) {
+	settings := DefaultSettings
+	if err := settings.Validate(); err != nil {
+		t.Fatalf("Default settings should be valid: %v", err)
+	}
+
+	for _, change := range []func(s *Settings){
+		func(s *Settings) { s.SiteTitle = "  " },
+		func(s *Settings) { s.BaseURL = "example.com" },
+		func(s *Settings) { s.BaseURL = "ftp://example.com" },
+		func(s *Settings) { s.DefaultTheme = "../admin" },
+		func(s *Settings) { s.SessionIdle = 0 },
+		func(s *Settings) { s.SessionIdle = s.SessionMaxAge + 1 },
+		func(s *Settings) { s.DefaultGroup = "" },
+	} {
+		invalid := DefaultSettings
+		change(&invalid)
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("Settings %v should be invalid", invalid)
+		}
+	}
+}
+
+func TestSettingsSave(t *testing.T) {
+	st := SettingsTable{}
+	original, err := st.Select(Conn)
+	if err != nil {
+		t.Fatalf("Unable to select settings: %v", err)
+	}
+	defer st.Save(Conn, original)
+
+	changed := *original
+	changed.SiteTitle = "Changed Title"
+	changed.BaseURL = "https://example.com"
+	changed.RegistrationOpen = true
+	if err := st.Save(Conn, &changed); err != nil {
+		t.Fatalf("Unable to save settings: %v", err)
+	}
+
+	saved, err := st.Select(Conn)
+	if err != nil {
+		t.Fatalf("Unable to select settings: %v", err)
+	}
+
+	if *saved != changed {
+		t.Errorf("Saved settings %v don't match %v", *saved, changed)
+	}
+
+	invalid := changed
+	invalid.SiteTitle = ""
+	if err := st.Save(Conn, &invalid); err == nil {
+		t.Errorf("Saving invalid settings should fail")
+	}
+}
+
+func TestPasswordResetSingleUse(t *testing.T) {
+	ut := UsersTable{}
+	u := &User{
+		CreatedDateTime: time.Now().Unix(),
+		Username:        "passwordreset",
+		AuthHash:        "hash",
+		FirstName:       "Password",
+		LastName:        "Reset",
+		Email:           "passwordreset@local.com",
+	}
+	if err := ut.Insert(Conn, u); err != nil {
+		t.Fatalf("Unable to insert user: %v", err)
+	}
+	defer ut.DeleteByUUID(Conn, u.UUID)
+
+	now := time.Now().Unix()
+	prst := PasswordResetsTable{}
+	for _, tokenHash := range []string{"first-reset", "expired-reset"} {
+		expires := now + 3600
+		if tokenHash == "expired-reset" {
+			expires = now
+		}
+		if err := prst.Insert(Conn, &PasswordReset{CreatedDateTime: now, UserUUID: u.UUID, TokenHash: tokenHash, ExpiresDateTime: expires}); err != nil {
+			t.Fatalf("Unable to insert password reset: %v", err)
+		}
+	}
+
+	if count, err := prst.CountSince(Conn, u.UUID, now); err != nil || count != 2 {
+		t.Errorf("Expected 2 password resets to have been sent, got %d: %v", count, err)
+	}
+
+	expired, err := prst.SelectByTokenHash(Conn, "expired-reset")
+	if err != nil {
+		t.Fatalf("Unable to select password reset: %v", err)
+	}
+
+	if used, _ := prst.Use(Conn, expired, now); used {
+		t.Errorf("Expired password reset shouldn't be usable")
+	}
+
+	pr, err := prst.SelectByTokenHash(Conn, "first-reset")
+	if err != nil {
+		t.Fatalf("Unable to select password reset: %v", err)
+	}
+
+	if used, err := prst.Use(Conn, pr, now); err != nil || !used {
+		t.Fatalf("Password reset should be usable once: %v", err)
+	}
+
+	if used, _ := prst.Use(Conn, pr, now); used {
+		t.Errorf("Password reset shouldn't be usable a second time")
+	}
+
+	if err := ut.ResetPassword(Conn, u, "newhash", u.UUID, now); err != nil {
+		t.Fatalf("Unable to reset password: %v", err)
+	}
+
+	if count, _ := From(TableOf(&PasswordReset{})).Where(Equal("useruuid", u.UUID)).Count(Conn); count != 0 {
+		t.Errorf("Resetting the password should delete the user's other password resets, %d left", count)
+	}
+}
+
+func TestRegistrationVerifyAndApprove(t *testing.T) {
+	now := time.Now().Unix()
+	rt := RegistrationsTable{}
+	reg := &Registration{
+		CreatedDateTime: now,
+		Username:        "registration",
+		Email:           "registration@local.com",
+		FirstName:       "Self",
+		LastName:        "Registered",
+		AuthHash:        "hash",
+		TokenHash:       "registration-token",
+		ExpiresDateTime: now + 3600,
+	}
+	if err := rt.Insert(Conn, reg); err != nil {
+		t.Fatalf("Unable to insert registration: %v", err)
+	}
+	defer rt.DeleteByID(Conn, reg.Registrationid)
+
+	if taken, _ := rt.Taken(Conn, "someoneelse", reg.Email); !taken {
+		t.Errorf("Email address of a pending registration should be taken")
+	}
+
+	if _, err := rt.Approve(Conn, reg, "Users", now); err == nil {
+		t.Errorf("Registration shouldn't be approved before its email address is verified")
+	}
+
+	if verified, err := rt.Verify(Conn, reg.TokenHash, now); err != nil || !verified {
+		t.Fatalf("Registration should be verified by its token: %v", err)
+	}
+
+	if verified, _ := rt.Verify(Conn, reg.TokenHash, now); verified {
+		t.Errorf("Verification link shouldn't work a second time")
+	}
+
+	if _, err := rt.DeleteExpired(Conn, now+7200); err != nil {
+		t.Fatalf("Unable to delete expired registrations: %v", err)
+	}
+
+	registrations, err := rt.SelectVerified(Conn)
+	if err != nil || len(registrations) != 1 {
+		t.Fatalf("Verified registration should be kept past its link's expiry, got %d: %v", len(registrations), err)
+	}
+
+	u, err := rt.Approve(Conn, &registrations[0], "Users", now)
+	if err != nil {
+		t.Fatalf("Unable to approve registration: %v", err)
+	}
+	ut := UsersTable{}
+	defer ut.DeleteWithDependents(Conn, u)
+
+	if u.AuthHash != reg.AuthHash || u.UserroleId != int(MEMBER_USER) {
+		t.Errorf("Approved user should have the registered password and the member role")
+	}
+
+	if canEdit, _ := ut.HasPermission(Conn, u, PERM_PAGES_EDIT); canEdit {
+		t.Errorf("Self registered users should not be able to edit pages")
+	}
+
+	gt := GroupTable{}
+	group, _ := gt.SelectByTitle(Conn, "Users")
+	if count, _ := From(&GroupMembershipTable{}).Where(Equal("useruuid", u.UUID), Equal("groupuuid", group.UUID)).Count(Conn); count != 1 {
+		t.Errorf("Approved user should be in the default group")
+	}
+
+	if count, _ := From(TableOf(&Registration{})).Count(Conn); count != 0 {
+		t.Errorf("Approved registration should be removed, %d left", count)
+	}
+}
+
+func TestUsersUpdate(t *testing.T) {
+	ut := UsersTable{}
+	users := []*User{}
+	for _, username := range []string{"updateone", "updatetwo"} {
+		u := &User{
+			CreatedDateTime: time.Now().Unix(),
+			Username:        username,
+			AuthHash:        "hash",
+			FirstName:       "Update",
+			LastName:        "Test",
+			Email:           username + "@local.com",
+		}
+		if err := ut.Insert(Conn, u); err != nil {
+			t.Fatalf("Unable to insert user: %v", err)
+		}
+		defer ut.DeleteByUUID(Conn, u.UUID)
+		users = append(users, u)
+	}
+
+	u, err := ut.SelectByUUID(Conn, users[0].UUID)
+	if err != nil {
+		t.Fatalf("Unable to select user: %v", err)
+	}
+
+	u.FirstName = "Updated"
+	u.Email = "updated@local.com"
+	if err := ut.Update(Conn, u); err != nil {
+		t.Fatalf("Unable to update user: %v", err)
+	}
+
+	updated, _ := ut.SelectByUUID(Conn, u.UUID)
+	if updated.FirstName != "Updated" || updated.Email != "updated@local.com" || updated.Username != "updateone" {
+		t.Errorf("Updated user %v doesn't have the new details", updated)
+	}
+
+	u.Username = users[1].Username
+	if err := ut.Update(Conn, u); err == nil || !strings.Contains(err.Error(), "Username") {
+		t.Errorf("Taking another user's username should be refused, got: %v", err)
+	}
+
+	u.Username = "updateone"
+	u.Email = users[1].Email
+	if err := ut.Update(Conn, u); err == nil || !strings.Contains(err.Error(), "Email") {
+		t.Errorf("Taking another user's email address should be refused, got: %v", err)
+	}
+}
@@ -0,0 +1,366 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+//SortOrder direction query results are ordered in
+type SortOrder int
+
+const (
+	Ascending SortOrder = iota
+	Descending
+)
+
+//Condition a single where clause condition, or a group of them, which only ever refers to values as bound arguments
+type Condition struct {
+	column   string
+	operator string
+	values   []interface{}
+	subquery *Query
+	group    []Condition
+	joiner   string
+}
+
+//Equal matches rows where the column equals the value
+func Equal(column string, value interface{}) Condition {
+	return Condition{column: column, operator: "=", values: []interface{}{value}}
+}
+
+//NotEqual matches rows where the column doesn't equal the value
+func NotEqual(column string, value interface{}) Condition {
+	return Condition{column: column, operator: "<>", values: []interface{}{value}}
+}
+
+//LessThan matches rows where the column is less than the value
+func LessThan(column string, value interface{}) Condition {
+	return Condition{column: column, operator: "<", values: []interface{}{value}}
+}
+
+//AtMost matches rows where the column is less than or equal to the value
+func AtMost(column string, value interface{}) Condition {
+	return Condition{column: column, operator: "<=", values: []interface{}{value}}
+}
+
+//GreaterThan matches rows where the column is greater than the value
+func GreaterThan(column string, value interface{}) Condition {
+	return Condition{column: column, operator: ">", values: []interface{}{value}}
+}
+
+//AtLeast matches rows where the column is greater than or equal to the value
+func AtLeast(column string, value interface{}) Condition {
+	return Condition{column: column, operator: ">=", values: []interface{}{value}}
+}
+
+//In matches rows where the column equals any of the values
+func In(column string, values ...interface{}) Condition {
+	return Condition{column: column, operator: "IN", values: values}
+}
+
+//InQuery matches rows where the column is in the results of the subquery
+func InQuery(column string, subquery *Query) Condition {
+	return Condition{column: column, operator: "IN", subquery: subquery}
+}
+
+//NotInQuery matches rows where the column isn't in the results of the subquery
+func NotInQuery(column string, subquery *Query) Condition {
+	return Condition{column: column, operator: "NOT IN", subquery: subquery}
+}
+
+//And matches rows which match all of the conditions
+func And(conditions ...Condition) Condition {
+	return Condition{group: conditions, joiner: " AND "}
+}
+
+//Or matches rows which match any of the conditions
+func Or(conditions ...Condition) Condition {
+	return Condition{group: conditions, joiner: " OR "}
+}
+
+func (c Condition) build(q *Query) (string, []interface{}, error) {
+	if c.joiner != "" {
+		if len(c.group) == 0 {
+			return "", nil, errors.New("Condition group is empty")
+		}
+
+		parts := make([]string, 0, len(c.group))
+		args := []interface{}{}
+		for _, condition := range c.group {
+			part, conditionArgs, err := condition.build(q)
+			if err != nil {
+				return "", nil, err
+			}
+			parts = append(parts, part)
+			args = append(args, conditionArgs...)
+		}
+		return "(" + strings.Join(parts, c.joiner) + ")", args, nil
+	}
+
+	column, err := q.column(c.column)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if c.subquery != nil {
+		subquerySQL, args, err := c.subquery.buildSelect()
+		if err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("%s %s (%s)", column, c.operator, subquerySQL), args, nil
+	}
+
+	if c.operator == "IN" {
+		//nothing can be in an empty list, but not every database accepts "IN ()"
+		if len(c.values) == 0 {
+			return "1 = 0", nil, nil
+		}
+		return fmt.Sprintf("%s IN (%s)", column, strings.TrimSuffix(strings.Repeat("?, ", len(c.values)), ", ")), c.values, nil
+	}
+
+	return fmt.Sprintf("%s %s ?", column, c.operator), c.values, nil
+}
+
+//Query builds select, count and delete statements against a single table, column names are checked against
+//the table's fields and values are always bound as arguments, never formatted into the SQL itself
+type Query struct {
+	table      Table
+	fields     map[string]bool
+	columns    []string
+	conditions []Condition
+	orderBy    []string
+	limit      int
+	offset     int
+	err        error
+}
+
+//From starts a query against the table
+func From(t Table) *Query {
+	fields := map[string]bool{}
+	for _, field := range t.buildFields() {
+		fields[field.Name] = true
+	}
+	return &Query{table: t, fields: fields}
+}
+
+//Columns sets which columns are selected, all of them are if this isn't called
+func (q *Query) Columns(columns ...string) *Query {
+	for _, column := range columns {
+		quoted, err := q.column(column)
+		if err != nil {
+			q.err = err
+			return q
+		}
+		q.columns = append(q.columns, quoted)
+	}
+	return q
+}
+
+//Where adds conditions which all have to match, calling it again adds more
+func (q *Query) Where(conditions ...Condition) *Query {
+	q.conditions = append(q.conditions, conditions...)
+	return q
+}
+
+//OrderBy adds a column to sort results by, earlier calls take precedence
+func (q *Query) OrderBy(column string, order SortOrder) *Query {
+	quoted, err := q.column(column)
+	if err != nil {
+		q.err = err
+		return q
+	}
+	if order == Descending {
+		quoted += " DESC"
+	} else {
+		quoted += " ASC"
+	}
+	q.orderBy = append(q.orderBy, quoted)
+	return q
+}
+
+//Limit caps the number of results, 0 means no limit
+func (q *Query) Limit(limit int) *Query {
+	q.limit = limit
+	return q
+}
+
+//Offset skips the first results, it's only applied along with a limit
+func (q *Query) Offset(offset int) *Query {
+	q.offset = offset
+	return q
+}
+
+//Query runs the select statement
+func (q *Query) Query(db Querier) (*sql.Rows, error) {
+	query, args, err := q.buildSelect()
+	if err != nil {
+		return nil, err
+	}
+	return db.Query(rebind(query), args...)
+}
+
+//QueryRow runs the select statement expecting a single row, build errors are returned when scanning it
+func (q *Query) QueryRow(db Querier) *Row {
+	query, args, err := q.buildSelect()
+	if err != nil {
+		return &Row{err: err}
+	}
+	return &Row{row: db.QueryRow(rebind(query), args...)}
+}
+
+//Count counts the rows matching the conditions
+func (q *Query) Count(db Querier) (int, error) {
+	count := 0
+	err := q.aggregate(db, "COUNT(*)", &count)
+	return count, err
+}
+
+//Max gets the largest value of the integer column across the rows matching the conditions, 0 if there aren't any
+func (q *Query) Max(db Querier, column string) (int64, error) {
+	quoted, err := q.column(column)
+	if err != nil {
+		return 0, err
+	}
+
+	var max sql.NullInt64
+	err = q.aggregate(db, fmt.Sprintf("MAX(%s)", quoted), &max)
+	return max.Int64, err
+}
+
+func (q *Query) aggregate(db Querier, expression string, dest interface{}) error {
+	if q.err != nil {
+		return q.err
+	}
+
+	var query bytes.Buffer
+	query.WriteString(fmt.Sprintf("SELECT %s FROM %s", expression, quoteIdentifier(q.table.Name())))
+
+	args, err := q.writeWhere(&query)
+	if err != nil {
+		return err
+	}
+
+	return db.QueryRow(rebind(query.String()), args...).Scan(dest)
+}
+
+//Delete removes the rows matching the conditions, refusing to run without any so a table can't be emptied by mistake
+func (q *Query) Delete(db Querier) (int64, error) {
+	if q.err != nil {
+		return 0, q.err
+	}
+
+	if len(q.conditions) == 0 {
+		return 0, fmt.Errorf("Refusing to delete from %s without any conditions", q.table.Name())
+	}
+
+	var query bytes.Buffer
+	query.WriteString(fmt.Sprintf("DELETE FROM %s", quoteIdentifier(q.table.Name())))
+
+	args, err := q.writeWhere(&query)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := db.Exec(rebind(query.String()), args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func (q *Query) buildSelect() (string, []interface{}, error) {
+	if q.err != nil {
+		return "", nil, q.err
+	}
+
+	columns := "*"
+	if len(q.columns) > 0 {
+		columns = strings.Join(q.columns, ", ")
+	}
+
+	var query bytes.Buffer
+	query.WriteString(fmt.Sprintf("SELECT %s FROM %s", columns, quoteIdentifier(q.table.Name())))
+
+	args, err := q.writeWhere(&query)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(q.orderBy) > 0 {
+		query.WriteString(" ORDER BY " + strings.Join(q.orderBy, ", "))
+	}
+
+	if q.limit > 0 {
+		query.WriteString(" LIMIT ?")
+		args = append(args, q.limit)
+		if q.offset > 0 {
+			query.WriteString(" OFFSET ?")
+			args = append(args, q.offset)
+		}
+	}
+
+	return query.String(), args, nil
+}
+
+func (q *Query) writeWhere(query *bytes.Buffer) ([]interface{}, error) {
+	if len(q.conditions) == 0 {
+		return nil, nil
+	}
+
+	parts := make([]string, 0, len(q.conditions))
+	args := []interface{}{}
+	for _, condition := range q.conditions {
+		part, conditionArgs, err := condition.build(q)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+		args = append(args, conditionArgs...)
+	}
+
+	query.WriteString(" WHERE " + strings.Join(parts, " AND "))
+	return args, nil
+}
+
+//column checks that the column belongs to the table and quotes it
+func (q *Query) column(column string) (string, error) {
+	if column == "*" {
+		return column, nil
+	}
+	if !q.fields[column] {
+		return "", fmt.Errorf("Table %s has no column %s", q.table.Name(), column)
+	}
+	return quoteIdentifier(column), nil
+}
+
+//Row wraps a single result row so that errors building the query surface when it's scanned
+type Row struct {
+	row *sql.Row
+	err error
+}
+
+//Scan copies the row's columns into dest, returning sql.ErrNoRows if there wasn't a matching row
+func (qr *Row) Scan(dest ...interface{}) error {
+	if qr.err != nil {
+		return qr.err
+	}
+	return qr.row.Scan(dest...)
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQueryBindsValues(t *testing.T) {
+	defer withType(SQLITE)()
+
+	username := "admin' OR '1'='1"
+	query, args, err := From(&UsersTable{}).Where(Equal("username", username)).buildSelect()
+
+	if err != nil {
+		t.Fatalf("Unexpected error building query: %v", err)
+	}
+
+	expected := "SELECT * FROM `users` WHERE `username` = ?"
+	if query != expected {
+		t.Errorf("Expected query %s, got %s", expected, query)
+	}
+
+	if !reflect.DeepEqual(args, []interface{}{username}) {
+		t.Errorf("Username should be bound as the only argument, got %v", args)
+	}
+}
+
+func TestQueryUnknownColumn(t *testing.T) {
+	if _, _, err := From(&UsersTable{}).Where(Equal("username = '' OR 1 = 1 --", "")).buildSelect(); err == nil {
+		t.Errorf("Conditions on columns the table doesn't have should fail to build")
+	}
+
+	if _, _, err := From(&UsersTable{}).Columns("authhash", "password").buildSelect(); err == nil {
+		t.Errorf("Selecting columns the table doesn't have should fail to build")
+	}
+
+	if _, _, err := From(&UsersTable{}).OrderBy("userid; DROP TABLE users", Ascending).buildSelect(); err == nil {
+		t.Errorf("Ordering by columns the table doesn't have should fail to build")
+	}
+}
+
+func TestQueryOrderLimitOffset(t *testing.T) {
+	defer withType(SQLITE)()
+
+	query, args, err := From(TableOf(&PageRevision{})).
+		Columns("uuid", "title").
+		Where(Equal("pageuuid", "page"), AtLeast("createddatetime", int64(100))).
+		OrderBy("createddatetime", Descending).
+		OrderBy("pagerevisionid", Ascending).
+		Limit(10).
+		Offset(20).
+		buildSelect()
+
+	if err != nil {
+		t.Fatalf("Unexpected error building query: %v", err)
+	}
+
+	expected := "SELECT `uuid`, `title` FROM `pagerevisions` WHERE `pageuuid` = ? AND `createddatetime` >= ? ORDER BY `createddatetime` DESC, `pagerevisionid` ASC LIMIT ? OFFSET ?"
+	if query != expected {
+		t.Errorf("Expected query %s, got %s", expected, query)
+	}
+
+	if !reflect.DeepEqual(args, []interface{}{"page", int64(100), 10, 20}) {
+		t.Errorf("Unexpected query arguments %v", args)
+	}
+
+	//an offset without a limit isn't valid SQL everywhere, so it's left out
+	query, _, _ = From(TableOf(&PageRevision{})).Offset(20).buildSelect()
+	if query != "SELECT * FROM `pagerevisions`" {
+		t.Errorf("Offset without a limit should be ignored, got %s", query)
+	}
+}
+
+func TestQueryGroupedConditions(t *testing.T) {
+	defer withType(SQLITE)()
+
+	restricted := From(TableOf(&PageGroupPermission{})).Columns("pageuuid").Where(Equal("permission", int(PAGE_READ)))
+	query, args, err := From(&PagesTable{}).
+		Columns("route").
+		Where(Or(Equal("roleprotected", true), InQuery("uuid", restricted)), In("status", PAGE_PUBLISHED, PAGE_SCHEDULED)).
+		buildSelect()
+
+	if err != nil {
+		t.Fatalf("Unexpected error building query: %v", err)
+	}
+
+	expected := "SELECT `route` FROM `pages` WHERE (`roleprotected` = ? OR `uuid` IN (SELECT `pageuuid` FROM `pagegrouppermissions` WHERE `permission` = ?)) AND `status` IN (?, ?)"
+	if query != expected {
+		t.Errorf("Expected query %s, got %s", expected, query)
+	}
+
+	if !reflect.DeepEqual(args, []interface{}{true, int(PAGE_READ), PAGE_PUBLISHED, PAGE_SCHEDULED}) {
+		t.Errorf("Arguments should be in the order they appear in the query, got %v", args)
+	}
+
+	query, args, _ = From(&PagesTable{}).Where(In("uuid")).buildSelect()
+	if query != "SELECT * FROM `pages` WHERE 1 = 0" || len(args) != 0 {
+		t.Errorf("Matching against an empty list should match nothing, got %s %v", query, args)
+	}
+}
+
+func TestQueryRefusesUnconditionalDelete(t *testing.T) {
+	if _, err := From(&PagesTable{}).Delete(Conn); err == nil {
+		t.Errorf("Deleting without any conditions should be refused")
+	}
+}
+
+//withType builds statements for the given database type, the returned func restores the connected one
+func withType(dbType DBType) func() {
+	connectedType := Type
+	Type = dbType
+	return func() { Type = connectedType }
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWithTransactionRollsBack(t *testing.T) {
+	gt := &GroupTable{}
+	g := &Group{CreatedDateTime: time.Now().Unix(), Title: "Rolled Back"}
+	defer From(gt).Where(Equal("title", g.Title)).Delete(Conn)
+
+	failure := errors.New("step failed")
+	err := WithTransaction(Conn, func(tx *sql.Tx) error {
+		if err := gt.Insert(tx, g); err != nil {
+			return err
+		}
+		return failure
+	})
+
+	if err != failure {
+		t.Errorf("Expected the step's error to be returned, got %v", err)
+	}
+
+	if count, err := From(gt).Where(Equal("title", g.Title)).Count(Conn); err != nil || count != 0 {
+		t.Errorf("Group inserted within a failed transaction should not exist, found %d: %v", count, err)
+	}
+}
+
+func TestWithTransactionCommits(t *testing.T) {
+	gt := &GroupTable{}
+	g := &Group{CreatedDateTime: time.Now().Unix(), Title: "Committed"}
+	defer From(gt).Where(Equal("title", g.Title)).Delete(Conn)
+
+	err := WithTransaction(Conn, func(tx *sql.Tx) error {
+		return gt.Insert(tx, g)
+	})
+
+	if err != nil {
+		t.Fatalf("Unable to run transaction: %v", err)
+	}
+
+	if count, err := From(gt).Where(Equal("title", g.Title)).Count(Conn); err != nil || count != 1 {
+		t.Errorf("Expected the committed group to exist, found %d: %v", count, err)
+	}
+}
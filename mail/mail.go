@@ -0,0 +1,181 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+//Transports mail can be delivered with
+const (
+	TransportNone     = "none"
+	TransportSMTP     = "smtp"
+	TransportSendmail = "sendmail"
+	TransportFile     = "file"
+)
+
+//Message a plain text email
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Body    string
+}
+
+//Sender delivers messages, each transport has its own implementation
+type Sender interface {
+	Send(msg Message) error
+}
+
+//Settings which transport mail is delivered with and the details it needs
+type Settings struct {
+	Transport string
+	From      string
+	//SMTPAddress host:port of the SMTP server
+	SMTPAddress  string
+	SMTPUsername string
+	SMTPPassword string
+	//SendmailPath location of the sendmail binary
+	SendmailPath string
+	//Dir where the file transport drops messages
+	Dir string
+}
+
+//DefaultSettings mail isn't sent until a transport is configured
+var DefaultSettings = Settings{
+	Transport:    TransportNone,
+	From:         "berrycms@localhost",
+	SMTPAddress:  "localhost:25",
+	SendmailPath: "/usr/sbin/sendmail",
+	Dir:          "mail",
+}
+
+var (
+	settings        = DefaultSettings
+	sender          Sender
+	errMailDisabled = errors.New("No mail transport has been configured")
+)
+
+//Validate checks that the settings make sense
+func (s Settings) Validate() error {
+	if _, err := mail.ParseAddress(s.From); err != nil {
+		return fmt.Errorf("Mail from address %s is invalid", s.From)
+	}
+
+	switch s.Transport {
+	case TransportNone:
+	case TransportSMTP:
+		if len(s.SMTPAddress) == 0 {
+			return errors.New("SMTP server address can't be blank")
+		}
+	case TransportSendmail:
+		if len(s.SendmailPath) == 0 {
+			return errors.New("Sendmail path can't be blank")
+		}
+	case TransportFile:
+		if len(s.Dir) == 0 {
+			return errors.New("Mail directory can't be blank")
+		}
+	default:
+		return fmt.Errorf("Unknown mail transport %s, transports are none, smtp, sendmail and file", s.Transport)
+	}
+
+	return nil
+}
+
+//Configure checks that the settings make sense before sending mail with them
+func Configure(s Settings) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	settings = s
+	switch s.Transport {
+	case TransportSMTP:
+		sender = &SMTPSender{Address: s.SMTPAddress, Username: s.SMTPUsername, Password: s.SMTPPassword}
+	case TransportSendmail:
+		sender = &SendmailSender{Path: s.SendmailPath}
+	case TransportFile:
+		sender = &FileSender{Dir: s.Dir}
+	default:
+		sender = nil
+	}
+	return nil
+}
+
+//Enabled whether there's a transport to send mail with
+func Enabled() bool {
+	return sender != nil
+}
+
+//Send delivers the message with the configured transport, from the configured address if it doesn't have one
+func Send(msg Message) error {
+	if sender == nil {
+		return errMailDisabled
+	}
+
+	if len(msg.From) == 0 {
+		msg.From = settings.From
+	}
+	return sender.Send(msg)
+}
+
+//Bytes formats the message for delivery, the headers are checked so that nothing can be smuggled into them
+func (msg Message) Bytes() ([]byte, error) {
+	for _, header := range []string{msg.From, msg.To, msg.Subject} {
+		if strings.ContainsAny(header, "\r\n") {
+			return nil, errors.New("Mail headers can't contain line breaks")
+		}
+	}
+
+	if _, err := mail.ParseAddress(msg.To); err != nil {
+		return nil, fmt.Errorf("Mail to address %s is invalid", msg.To)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", msg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	qp := quotedprintable.NewWriter(&b)
+	if _, err := qp.Write([]byte(strings.Replace(msg.Body, "\n", "\r\n", -1))); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+//envelopeAddress the bare address to give the mail server, without any display name
+func envelopeAddress(address string) (string, error) {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return "", err
+	}
+	return parsed.Address, nil
+}
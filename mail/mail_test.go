@@ -0,0 +1,151 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mail
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+)
+
+//smtpStandIn accepts a single message over SMTP, just enough of the protocol for net/smtp to deliver to it
+func smtpStandIn(t *testing.T) (string, chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen for SMTP: %v", err)
+	}
+
+	received := make(chan string, 1)
+	go func() {
+		defer listener.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost ready")
+
+		var data strings.Builder
+		inData := false
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					received <- data.String()
+					reply("250 OK")
+					continue
+				}
+				data.WriteString(line)
+				continue
+			}
+
+			switch command := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 localhost")
+			case command == "DATA":
+				inData = true
+				reply("354 Send data")
+			case command == "QUIT":
+				reply("221 Bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+
+	return listener.Addr().String(), received
+}
+
+func TestSMTPSender(t *testing.T) {
+	address, received := smtpStandIn(t)
+
+	ss := &SMTPSender{Address: address}
+	err := ss.Send(Message{From: "Berry CMS <berrycms@localhost>", To: "someone@localhost", Subject: "Hello", Body: "Hello there\nfrom the test"})
+	if err != nil {
+		t.Fatalf("Unable to send message: %v", err)
+	}
+
+	msg := <-received
+	for _, expected := range []string{"To: someone@localhost\r\n", "Subject: Hello\r\n", "Hello there\r\nfrom the test"} {
+		if !strings.Contains(msg, expected) {
+			t.Errorf("Received message should contain %q:\n%s", expected, msg)
+		}
+	}
+}
+
+func TestFileSender(t *testing.T) {
+	dir, err := ioutil.TempDir("", "berrycms-mail")
+	if err != nil {
+		t.Fatalf("Unable to create mail directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := Configure(Settings{Transport: TransportFile, From: "berrycms@localhost", Dir: dir}); err != nil {
+		t.Fatalf("Unable to configure file transport: %v", err)
+	}
+	defer Configure(DefaultSettings)
+
+	if err := Send(Message{To: "someone@localhost", Subject: "Dropped", Body: "In a file"}); err != nil {
+		t.Fatalf("Unable to send message: %v", err)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Expected one message file, got %d: %v", len(files), err)
+	}
+
+	data, err := ioutil.ReadFile(dir + string(os.PathSeparator) + files[0].Name())
+	if err != nil {
+		t.Fatalf("Unable to read message file: %v", err)
+	}
+
+	if !strings.Contains(string(data), "From: berrycms@localhost\r\n") {
+		t.Errorf("Message should be sent from the configured address:\n%s", data)
+	}
+}
+
+func TestMessageHeaderInjection(t *testing.T) {
+	if _, err := (Message{From: "berrycms@localhost", To: "someone@localhost", Subject: "Hi\r\nBcc: everyone@localhost"}).Bytes(); err == nil {
+		t.Errorf("Line breaks in headers should be rejected")
+	}
+}
+
+func TestSettingsValidate(t *testing.T) {
+	if err := DefaultSettings.Validate(); err != nil {
+		t.Errorf("Default settings should be valid: %v", err)
+	}
+
+	for _, s := range []Settings{
+		{Transport: "pigeon", From: "berrycms@localhost"},
+		{Transport: TransportSMTP, From: "not an address"},
+		{Transport: TransportFile, From: "berrycms@localhost"},
+	} {
+		if err := s.Validate(); err == nil {
+			t.Errorf("Settings %v should be invalid", s)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/smtp"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/tacusci/berrycms/util"
+)
+
+//SMTPSender delivers messages to an SMTP server, authenticating if a username is given
+type SMTPSender struct {
+	Address  string
+	Username string
+	Password string
+}
+
+//Send delivers the message to the SMTP server
+func (ss *SMTPSender) Send(msg Message) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	from, err := envelopeAddress(msg.From)
+	if err != nil {
+		return err
+	}
+
+	to, err := envelopeAddress(msg.To)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if len(ss.Username) > 0 {
+		host, _, err := net.SplitHostPort(ss.Address)
+		if err != nil {
+			return err
+		}
+		//net/smtp refuses to send the password unless the connection is encrypted or to localhost
+		auth = smtp.PlainAuth("", ss.Username, ss.Password, host)
+	}
+
+	return smtp.SendMail(ss.Address, auth, from, []string{to}, data)
+}
+
+//SendmailSender hands messages to the local sendmail binary, which reads the recipient from the headers
+type SendmailSender struct {
+	Path string
+}
+
+//Send pipes the message into sendmail
+func (ss *SendmailSender) Send(msg Message) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(ss.Path, "-t", "-i")
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Sendmail failed -> %s %s", err.Error(), stderr.String())
+	}
+	return nil
+}
+
+//FileSender drops each message into the directory as a .eml file instead of delivering it, for testing and
+//for sites without any mail server
+type FileSender struct {
+	Dir string
+}
+
+//Send writes the message to a new file in the directory
+func (fs *FileSender) Send(msg Message) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(fs.Dir, 0700); err != nil {
+		return err
+	}
+
+	suffix, err := util.GenerateToken(4)
+	if err != nil {
+		return err
+	}
+
+	fileName := filepath.Join(fs.Dir, fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405"), suffix))
+	return ioutil.WriteFile(fileName, data, 0600)
+}
@@ -20,6 +20,7 @@ import (
 	"flag"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"strings"
@@ -28,15 +29,18 @@ import (
 
 	"golang.org/x/crypto/acme/autocert"
 
+	"github.com/tacusci/berrycms/backup"
 	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/mail"
 	"github.com/tacusci/berrycms/web"
 	"github.com/tacusci/logging"
 )
 
 type options struct {
+	configFile          string
+	configSources       map[string]string
+	debug               bool
 	cpuProfile          bool
-	testData            bool
-	wipe                bool
 	yesToAll            bool
 	port                uint
 	addr                string
@@ -44,6 +48,7 @@ type options struct {
 	sqlUsername         string
 	sqlPassword         string
 	sqlAddress          string
+	sqlSSLMode          string
 	activityLogLoc      string
 	adminHiddenPassword string
 	adminPagesDisabled  bool
@@ -51,38 +56,32 @@ type options struct {
 	noSitemap           bool
 	logFileName         string
 	autoCertDomain      string
+	rotateSessionKeys   bool
+	sessionTimeouts     web.SessionTimeouts
+	backupSettings      backup.Settings
+	mailSettings        mail.Settings
 }
 
 var shuttingDown bool
 
 func parseCmdArgs() *options {
 	opts := &options{}
-
-	debugLevel := flag.Bool("dbg", false, "Set logging to debug")
-	flag.BoolVar(&opts.testData, "testdb", false, "Creates testing data")
-	flag.BoolVar(&opts.wipe, "wipe", false, "Completely wipes database")
-	flag.BoolVar(&opts.yesToAll, "y", false, "Automatically agree to cli confirmation requests")
-	flag.UintVar(&opts.port, "p", 8080, "Port to listen for HTTP requests on")
-	flag.StringVar(&opts.addr, "a", "0.0.0.0", "IP address to listen against if multiple network adapters")
-	flag.StringVar(&opts.sql, "db", "sqlite", "Database server type to try to connect to [sqlite/mysql]")
-	flag.StringVar(&opts.sqlUsername, "dbuser", "berryadmin", "Database server username, ignored if using sqlite")
-	flag.StringVar(&opts.sqlPassword, "dbpass", "", "Database server password, ignored if using sqlite")
-	flag.StringVar(&opts.sqlAddress, "dbaddr", "/", "Database server location, ignored if using sqlite")
-	flag.StringVar(&opts.activityLogLoc, "actlog", "", "Activity/access log file location")
-	flag.StringVar(&opts.adminHiddenPassword, "ahp", "", "URI prefix to hide admin pages behind")
-	flag.BoolVar(&opts.noRobots, "nrtxt", false, "Don't provide a robots.txt URI")
-	flag.BoolVar(&opts.noSitemap, "nsxml", false, "Don't provide a sitemap.xml URI")
-	flag.BoolVar(&opts.adminPagesDisabled, "apd", false, "Admin interface pages disabled")
-	flag.StringVar(&opts.logFileName, "log", "", "Server log file location")
-	flag.BoolVar(&opts.cpuProfile, "cpuprofile", false, "Enable CPU profiling")
-	flag.StringVar(&opts.autoCertDomain, "autocert", "", "Domain/web address to serve HTTPS against")
-
+	defineFlags(flag.CommandLine, opts)
+	flag.Usage = func() {
+		printUsage(os.Stderr)
+	}
 	flag.Parse()
 
+	problems := opts.loadConfig(flag.CommandLine, os.LookupEnv)
+	problems = append(problems, opts.validate()...)
+	if len(problems) > 0 {
+		logging.ErrorAndExit(fmt.Sprintf("Invalid configuration:\n  %s", strings.Join(problems, "\n  ")))
+	}
+
 	loggingLevel := logging.WarnLevel
 	logging.ColorLogLevelLabelOnly = true
 
-	if *debugLevel {
+	if opts.debug {
 		logging.SetLevel(logging.DebugLevel)
 		return opts
 	}
@@ -91,9 +90,96 @@ func parseCmdArgs() *options {
 	return opts
 }
 
+//defineFlags binds each command line flag to the option it sets
+func defineFlags(fs *flag.FlagSet, opts *options) {
+	fs.StringVar(&opts.configFile, "config", "", "TOML config file to read settings from, environment variables and then flags take precedence over it")
+	fs.BoolVar(&opts.debug, "dbg", false, "Set logging to debug")
+	fs.BoolVar(&opts.yesToAll, "y", false, "Automatically agree to cli confirmation requests")
+	fs.UintVar(&opts.port, "p", 8080, "Port to listen for HTTP requests on")
+	fs.StringVar(&opts.addr, "a", "0.0.0.0", "IP address to listen against if multiple network adapters")
+	fs.StringVar(&opts.sql, "db", "sqlite", "Database server type to try to connect to [sqlite/mysql/postgres]")
+	fs.StringVar(&opts.sqlUsername, "dbuser", "berryadmin", "Database server username, ignored if using sqlite")
+	fs.StringVar(&opts.sqlPassword, "dbpass", "", "Database server password, ignored if using sqlite")
+	fs.StringVar(&opts.sqlAddress, "dbaddr", "/", "Database server location, ignored if using sqlite")
+	fs.StringVar(&opts.sqlSSLMode, "dbsslmode", "disable", "Postgres SSL mode [disable/require/verify-ca/verify-full], ignored unless using postgres")
+	fs.StringVar(&opts.activityLogLoc, "actlog", "", "Activity/access log file location")
+	fs.StringVar(&opts.adminHiddenPassword, "ahp", "", "URI prefix to hide admin pages behind")
+	fs.BoolVar(&opts.noRobots, "nrtxt", false, "Don't provide a robots.txt URI")
+	fs.BoolVar(&opts.noSitemap, "nsxml", false, "Don't provide a sitemap.xml URI")
+	fs.BoolVar(&opts.adminPagesDisabled, "apd", false, "Admin interface pages disabled")
+	fs.StringVar(&opts.logFileName, "log", "", "Server log file location")
+	fs.BoolVar(&opts.cpuProfile, "cpuprofile", false, "Enable CPU profiling")
+	fs.StringVar(&opts.autoCertDomain, "autocert", "", "Domain/web address to serve HTTPS against")
+	fs.DurationVar(&opts.sessionTimeouts.Idle, "sessionidle", web.DefaultSessionTimeouts.Idle, "How long a login session can be idle for before it expires")
+	fs.DurationVar(&opts.sessionTimeouts.MaxAge, "sessionmax", web.DefaultSessionTimeouts.MaxAge, "How long a login session can last for however active it is")
+	fs.DurationVar(&opts.sessionTimeouts.RememberMaxAge, "remembermax", web.DefaultSessionTimeouts.RememberMaxAge, "How long a \"remember me\" login session lasts for")
+	fs.StringVar(&opts.backupSettings.Dir, "backupdir", backup.DefaultSettings.Dir, "Directory to save SQLite database backups to")
+	fs.DurationVar(&opts.backupSettings.Interval, "backupinterval", backup.DefaultSettings.Interval, "How often to back up the SQLite database, 0 to never")
+	fs.IntVar(&opts.backupSettings.KeepDaily, "backupdaily", backup.DefaultSettings.KeepDaily, "Number of days to keep a backup from")
+	fs.IntVar(&opts.backupSettings.KeepWeekly, "backupweekly", backup.DefaultSettings.KeepWeekly, "Number of weeks to keep a backup from")
+	fs.StringVar(&opts.mailSettings.Transport, "mailtransport", mail.DefaultSettings.Transport, "How to send mail: none, smtp, sendmail or file")
+	fs.StringVar(&opts.mailSettings.From, "mailfrom", mail.DefaultSettings.From, "Address mail is sent from")
+	fs.StringVar(&opts.mailSettings.SMTPAddress, "smtpaddr", mail.DefaultSettings.SMTPAddress, "SMTP server address to send mail through")
+	fs.StringVar(&opts.mailSettings.SMTPUsername, "smtpuser", "", "SMTP server username, leave blank if it doesn't need logging in to")
+	fs.StringVar(&opts.mailSettings.SMTPPassword, "smtppass", "", "SMTP server password")
+	fs.StringVar(&opts.mailSettings.SendmailPath, "sendmail", mail.DefaultSettings.SendmailPath, "Location of the sendmail binary")
+	fs.StringVar(&opts.mailSettings.Dir, "maildir", mail.DefaultSettings.Dir, "Directory to drop mail into with the file transport")
+	fs.BoolVar(&opts.rotateSessionKeys, "rotatekeys", false, "Generate new session cookie keys, cookies from before the previous rotation stop being valid")
+}
+
+//settingsOverride settings given in the config file, environment or on the command line take precedence over
+//those saved from the admin pages
+func settingsOverride(opts *options) func(*db.Settings) {
+	given := func(name string) bool {
+		_, ok := opts.configSources[name]
+		return ok
+	}
+
+	return func(s *db.Settings) {
+		if given("nrtxt") {
+			s.RobotsEnabled = !opts.noRobots
+		}
+		if given("nsxml") {
+			s.SitemapEnabled = !opts.noSitemap
+		}
+		if given("sessionidle") {
+			s.SessionIdle = int64(opts.sessionTimeouts.Idle.Seconds())
+		}
+		if given("sessionmax") {
+			s.SessionMaxAge = int64(opts.sessionTimeouts.MaxAge.Seconds())
+		}
+		if given("remembermax") {
+			s.RememberMaxAge = int64(opts.sessionTimeouts.RememberMaxAge.Seconds())
+		}
+	}
+}
+
+//postgresURL builds the connection URL for the Postgres server from the database flags
+func postgresURL(opts *options) string {
+	host := opts.sqlAddress
+	//the default address is only meaningful to MySQL
+	if host == "/" {
+		host = "localhost"
+	}
+
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(opts.sqlUsername, opts.sqlPassword),
+		Host:     host,
+		RawQuery: url.Values{"sslmode": []string{opts.sqlSSLMode}}.Encode(),
+	}
+	return u.String()
+}
+
 func main() {
 	opts := parseCmdArgs()
 
+	cmd, args := findCommand(flag.Args())
+	if cmd == nil {
+		flag.Usage()
+		logging.ErrorAndExit(fmt.Sprintf("Unknown command %s", strings.Join(flag.Args(), " ")))
+	}
+
 	flushInitialised := make(chan bool)
 	if len(opts.logFileName) > 0 {
 		go logging.FlushLogs(opts.logFileName, &flushInitialised)
@@ -101,43 +187,57 @@ func main() {
 		<-flushInitialised
 	}
 
-	logging.WhiteOutput(fmt.Sprintf("🍓 Berry CMS %s 🍓\n", db.VERSION))
+	err := cmd.run(opts, args)
+	if err != nil {
+		logging.Error(err.Error())
+	}
+
+	//stop writing log lines to file
+	if logging.LoggingOutputReciever != nil {
+		close(logging.LoggingOutputReciever)
+	}
+	close(flushInitialised)
+
+	if err != nil {
+		os.Exit(1)
+	}
+}
 
+//connectDB connects to the configured database
+func connectDB(opts *options) error {
 	switch opts.sql {
 	case "sqlite":
 		db.Connect(db.SQLITE, "", "berrycms")
 	case "mysql":
 		db.Connect(db.MySQL, fmt.Sprintf("%s:%s@%s", opts.sqlUsername, opts.sqlPassword, opts.sqlAddress), "berrycms")
+	case "postgres":
+		db.Connect(db.Postgres, postgresURL(opts), "berrycms")
 	default:
-		logging.ErrorAndExit(fmt.Sprintf("Unknown database server type %s...", opts.sql))
+		return fmt.Errorf("Unknown database server type %s", opts.sql)
 	}
+	return nil
+}
 
-	var wipeOccurred bool
-
-	if opts.wipe {
-		//if yes to all flag is was used, user won't be prompted
-		//to confirm as if statement won't continue evaluating
-		//conditions eg., the bool val returned by 'askConfirmToWipe'
-		//so it'll never be called
-		if opts.yesToAll || askConfirmToWipe() {
-			db.Wipe()
-			wipeOccurred = true
-		} else {
-			logging.Info("Skipping wiping database...")
-		}
+//connectMigratedDB connects to the configured database, makes sure its tables exist and brings its schema up to date
+func connectMigratedDB(opts *options) error {
+	if err := connectDB(opts); err != nil {
+		return err
 	}
 
 	db.Setup()
 
-	//if wipe never happened but test data creation requested, display message/warning
-	if !wipeOccurred && opts.testData {
-		logging.Warn("Wipe not carried out, skipping creating test data...")
+	if err := db.Migrate(db.Conn); err != nil {
+		return fmt.Errorf("Error migrating database schema: %s", err.Error())
 	}
+	return nil
+}
 
-	if wipeOccurred {
-		if opts.testData {
-			db.CreateTestData()
-		}
+//serve runs the web server until it's told to stop
+func serve(opts *options, args []string) error {
+	logging.WhiteOutput(fmt.Sprintf("🍓 Berry CMS %s 🍓\n", db.VERSION))
+
+	if err := connectMigratedDB(opts); err != nil {
+		return err
 	}
 
 	go db.Heartbeat()
@@ -164,22 +264,52 @@ func main() {
 		srv.TLSConfig = certManager.TLSConfig()
 	}
 
+	if opts.rotateSessionKeys {
+		logging.Info("Rotating session keys...")
+		skt := db.SessionKeysTable{}
+		if err := skt.Rotate(db.Conn); err != nil {
+			return fmt.Errorf("Error rotating session keys: %s", err.Error())
+		}
+	}
+
+	//session cookies should never be sent in the clear if the server can use HTTPS
+	if err := web.ConfigureSessionStore(srv.TLSConfig != nil); err != nil {
+		return fmt.Errorf("Error loading session keys: %s", err.Error())
+	}
+
+	if err := backup.Configure(opts.backupSettings); err != nil {
+		return err
+	}
+
+	if err := mail.Configure(opts.mailSettings); err != nil {
+		return err
+	}
+
 	rs := web.MutableRouter{
 		Server:              srv,
 		ActivityLogLoc:      opts.activityLogLoc,
 		AdminOff:            opts.adminPagesDisabled,
 		AdminHidden:         len(opts.adminHiddenPassword) > 0,
 		AdminHiddenPassword: opts.adminHiddenPassword,
-		NoRobots:            opts.noRobots,
-		NoSitemap:           opts.noSitemap,
+		SettingsOverride:    settingsOverride(opts),
 		CpuProfile:          opts.cpuProfile,
 	}
+
+	if err := rs.ApplySettings(); err != nil {
+		return err
+	}
 	rs.Reload()
 
-	clearOldSessionsStop := make(chan bool)
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	schedulePagesStop := make(chan bool)
 
-	go web.ClearOldSessions(&clearOldSessionsStop)
-	go listenForStopSig(srv, &clearOldSessionsStop)
+	go web.ClearOldSessions(backgroundCtx)
+	//database servers have their own backup tools, only SQLite's file is backed up
+	if backup.Enabled() {
+		go backup.Schedule(backgroundCtx)
+	}
+	go web.SchedulePages(&rs, &schedulePagesStop)
+	go listenForStopSig(srv, stopBackground, &schedulePagesStop)
 
 	logging.Info(fmt.Sprintf("Starting http server @ %s 🌏 ...", srv.Addr))
 
@@ -193,7 +323,7 @@ func main() {
 	if !shuttingDown {
 		if err != nil {
 			//only bother outputting error returned from listening server if we're not already trying to shutdown
-			logging.ErrorAndExit(fmt.Sprintf("☠️  Error starting server (%s) ☠️", err.Error()))
+			return fmt.Errorf("☠️  Error starting server (%s) ☠️", err.Error())
 		}
 	}
 
@@ -201,19 +331,45 @@ func main() {
 	db.Close()
 
 	logging.Info("Shutting down... BYE! 👋")
+	return nil
+}
 
-	//stop writing log lines to file
-	if logging.LoggingOutputReciever != nil {
-		close(logging.LoggingOutputReciever)
+//exportArchive writes the database's content to a new archive file
+func exportArchive(fileName string) error {
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
 	}
-	close(flushInitialised)
+
+	if err := db.Export(db.Conn, file); err != nil {
+		file.Close()
+		os.Remove(fileName)
+		return err
+	}
+
+	return file.Close()
+}
+
+//importArchive replaces the database's content with that of the archive file
+func importArchive(fileName string) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return db.Import(db.Conn, file)
 }
 
 func askConfirmToWipe() bool {
+	return askConfirm("⚠ Wiping the database is irreversible, are you sure? ⚠ ")
+}
+
+func askConfirm(question string) bool {
 	reader := bufio.NewReader(os.Stdin)
 
 	for {
-		logging.YellowOutput("⚠ Wiping the database is irreversible, are you sure? ⚠ ")
+		logging.YellowOutput(question)
 		fmt.Printf(" [y/n]: ")
 
 		response, err := reader.ReadString('\n')
@@ -246,14 +402,17 @@ func cacheDir(domain string) (dir string) {
 }
 
 //fires on Ctrl+C/SIGTERM send to process
-func listenForStopSig(srv *http.Server, wc *chan bool) {
+func listenForStopSig(srv *http.Server, stopBackground context.CancelFunc, wcs ...*chan bool) {
 	var gracefulStop = make(chan os.Signal)
 	signal.Notify(gracefulStop, syscall.SIGTERM)
 	signal.Notify(gracefulStop, syscall.SIGINT)
 	sig := <-gracefulStop
-	logging.Debug("Stopping clearing old sessions...")
-	//send a terminate command to the session clearing goroutine's channel
-	*wc <- true
+	logging.Debug("Stopping background workers...")
+	//send a terminate command to each background goroutine's channel
+	for _, wc := range wcs {
+		*wc <- true
+	}
+	stopBackground()
 	shuttingDown = true
 	logging.Error(fmt.Sprintf("☠️ Caught sig: %+v (Shutting down and cleaning up...) ☠️", sig))
 	logging.Info("Stopping HTTP server...")
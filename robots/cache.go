@@ -69,13 +69,18 @@ func Generate(adminPagesDisabled bool) error {
 		}
 	}
 
-	pt := db.PagesTable{}
-	rows, err := pt.Select(db.Conn, "route", "roleprotected = '1'")
+	restrictedPages := db.From(db.TableOf(&db.PageGroupPermission{})).Columns("pageuuid")
+	rows, err := db.From(&db.PagesTable{}).
+		Columns("route").
+		Where(db.Or(db.Equal("roleprotected", true), db.InQuery("uuid", restrictedPages))).
+		Query(db.Conn)
 
 	if err != nil {
 		return err
 	}
 
+	defer rows.Close()
+
 	var pageRouteToDisallow string
 
 	for rows.Next() {
@@ -101,6 +106,11 @@ func CacheBytes() []byte {
 	return cache.Bytes()
 }
 
+//Invalidate drops the cached robots.txt, it won't be served until it's generated again
+func Invalidate() {
+	cache = nil
+}
+
 func Reset() {
 	//we don't want to allocate memory each reset
 	if cache == nil {
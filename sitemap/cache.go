@@ -3,6 +3,7 @@ package sitemap
 import (
 	"bytes"
 	"fmt"
+	"time"
 
 	"github.com/tacusci/berrycms/db"
 	"github.com/tacusci/berrycms/util"
@@ -49,21 +50,34 @@ func Generate(httpScheme string, urlDomainPrefix string) error {
 		return err
 	}
 
-	pt := db.PagesTable{}
-	rows, err := pt.Select(db.Conn, "route", "roleprotected = '0'")
+	restrictedPages := db.From(db.TableOf(&db.PageGroupPermission{})).Columns("pageuuid")
+	//pages restricted to groups shouldn't be advertised any more than role protected ones
+	rows, err := db.From(&db.PagesTable{}).
+		Columns("route", "status", "publishdatetime", "unpublishdatetime").
+		Where(db.Equal("roleprotected", false), db.NotInQuery("uuid", restrictedPages)).
+		Query(db.Conn)
 
 	if err != nil {
 		return err
 	}
 
-	var pageRouteToAdd string
+	defer rows.Close()
+
+	now := time.Now().Unix()
 
 	for rows.Next() {
-		err := rows.Scan(&pageRouteToAdd)
+		p := db.Page{}
+		err := rows.Scan(&p.Route, &p.Status, &p.PublishDateTime, &p.UnpublishDateTime)
 		if err != nil {
 			return err
 		}
 
+		if !p.IsLive(now) {
+			continue
+		}
+
+		pageRouteToAdd := p.Route
+
 		var alreadyExists bool
 		for _, v := range *additionalRoutes {
 			if pageRouteToAdd == v {
@@ -101,6 +115,11 @@ func CacheBytes() []byte {
 	return cache.Bytes()
 }
 
+//Invalidate drops the cached sitemap so that it's generated again on next request
+func Invalidate() {
+	cache = nil
+}
+
 func Reset() {
 	//we don't want to allocate memory each reset
 	if cache == nil {
@@ -0,0 +1,52 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import "testing"
+
+func TestDiffLines(t *testing.T) {
+	a := []string{"first", "second", "third"}
+	b := []string{"first", "changed", "third", "fourth"}
+
+	expected := []DiffLine{
+		{Op: DiffEqual, Text: "first"},
+		{Op: DiffDelete, Text: "second"},
+		{Op: DiffInsert, Text: "changed"},
+		{Op: DiffEqual, Text: "third"},
+		{Op: DiffInsert, Text: "fourth"},
+	}
+
+	diff := DiffLines(a, b)
+
+	if len(diff) != len(expected) {
+		t.Fatalf("Expected %d diff lines, got %d: %v", len(expected), len(diff), diff)
+	}
+
+	for i := range expected {
+		if diff[i] != expected[i] {
+			t.Errorf("Diff line %d should be %v, got %v", i, expected[i], diff[i])
+		}
+	}
+}
+
+func TestDiffLinesIdentical(t *testing.T) {
+	lines := []string{"same", "content"}
+
+	for _, line := range DiffLines(lines, lines) {
+		if line.Op != DiffEqual {
+			t.Errorf("Identical content should not produce changes, got %v", line)
+		}
+	}
+}
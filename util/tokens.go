@@ -0,0 +1,49 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+//GenerateToken creates a random hex encoded token from the given number of bytes
+func GenerateToken(numBytes int) (string, error) {
+	b, err := GenerateKey(numBytes)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+//GenerateKey creates the given number of random bytes for use as a cryptographic key
+func GenerateKey(numBytes int) ([]byte, error) {
+	b := make([]byte, numBytes)
+	if _, err := randRead(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+//randRead fills the slice with cryptographically secure random bytes
+var randRead = rand.Read
+
+//HashToken hashes a generated token for storage, unlike passwords tokens are random enough
+//that they don't need salting, and the hash has to be the same each time so it can be looked up
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	//TOTPPeriod number of seconds each time based one time password is valid for
+	TOTPPeriod = 30
+	//TOTPDigits length of each time based one time password
+	TOTPDigits = 6
+	//totpSkewSteps number of periods either side of now a code is still accepted for, to allow for clock drift
+	totpSkewSteps = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+//GenerateTOTPSecret creates a random base32 encoded secret to share with an authenticator app
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := randRead(secret); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+//TOTPStep gets the RFC 6238 time step counter the given time falls in
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / TOTPPeriod
+}
+
+//TOTPCodeForStep generates the RFC 4226 HOTP code for the secret at the given time step
+func TOTPCodeForStep(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", err
+	}
+
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	//dynamic truncation, the low 4 bits of the last byte pick where the 31 bit code is read from
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < TOTPDigits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", TOTPDigits, code%mod), nil
+}
+
+//ValidateTOTP checks the code against the secret around the given time, returning the time step it matched so that it can't be used twice
+func ValidateTOTP(secret string, code string, t time.Time) (int64, bool) {
+	code = strings.Replace(strings.TrimSpace(code), " ", "", -1)
+	if len(code) != TOTPDigits {
+		return 0, false
+	}
+
+	now := TOTPStep(t)
+	for step := now - totpSkewSteps; step <= now+totpSkewSteps; step++ {
+		expected, err := TOTPCodeForStep(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+//TOTPURI builds the otpauth URI authenticator apps use to enrol a secret, usually shown as a QR code
+func TOTPURI(issuer string, accountName string, secret string) string {
+	label := url.PathEscape(fmt.Sprintf("%s:%s", issuer, accountName))
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprintf("%d", TOTPDigits))
+	params.Set("period", fmt.Sprintf("%d", TOTPPeriod))
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, params.Encode())
+}
+
+//GenerateRecoveryCodes creates single use codes which can stand in for a TOTP code if the authenticator is lost
+func GenerateRecoveryCodes(count int) ([]string, error) {
+	codes := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		token, err := GenerateToken(5)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, fmt.Sprintf("%s-%s", token[:5], token[5:]))
+	}
+	return codes, nil
+}
+
+//NormaliseRecoveryCode strips the formatting users might type a recovery code with so that it matches how it was hashed
+func NormaliseRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.Replace(code, "-", "", -1)
+	return strings.Replace(code, " ", "", -1)
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+func TestTOTPCodeForStep(t *testing.T) {
+	//RFC 6238 appendix B SHA1 test vectors, truncated to 6 digits
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+
+	for unix, expected := range vectors {
+		code, err := TOTPCodeForStep(secret, TOTPStep(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatalf("Error generating TOTP code: %v", err)
+		}
+		if code != expected {
+			t.Errorf("TOTP code at %d should be %s, got %s", unix, expected, code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("Error generating TOTP secret: %v", err)
+	}
+
+	now := time.Now()
+	code, _ := TOTPCodeForStep(secret, TOTPStep(now))
+
+	if step, ok := ValidateTOTP(secret, code, now); !ok || step != TOTPStep(now) {
+		t.Errorf("Current TOTP code should be valid")
+	}
+
+	if _, ok := ValidateTOTP(secret, code, now.Add(time.Duration(TOTPPeriod*5)*time.Second)); ok {
+		t.Errorf("TOTP code should not be valid several periods later")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("Error generating recovery codes: %v", err)
+	}
+
+	if len(codes) != 10 {
+		t.Fatalf("Expected 10 recovery codes, got %d", len(codes))
+	}
+
+	for _, code := range codes {
+		if NormaliseRecoveryCode(" "+code+" ") != NormaliseRecoveryCode(code) || len(NormaliseRecoveryCode(code)) != 10 {
+			t.Errorf("Recovery code %s didn't normalise consistently", code)
+		}
+	}
+}
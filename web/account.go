@@ -0,0 +1,190 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gobuffalo/plush"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/util"
+	"github.com/tacusci/logging"
+)
+
+//AccountHandler lets logged in users change their own name, email address and password
+type AccountHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (ah *AccountHandler) Get(w http.ResponseWriter, r *http.Request) {
+	amw := AuthMiddleware{}
+	loggedInUser, err := amw.LoggedInUser(r)
+	if err != nil || loggedInUser == nil {
+		http.Redirect(w, r, ah.loginRoute(), http.StatusFound)
+		return
+	}
+
+	message := ""
+	loginErrorStore, err := sessionsstore.Get(r, "passerrmsg")
+
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	if loginErrorMessage, ok := loginErrorStore.Values["errormessage"].(string); ok && loginErrorMessage != "" {
+		message = loginErrorMessage
+		loginErrorStore.Values["errormessage"] = ""
+		loginErrorStore.Save(r, w)
+	}
+
+	ah.render(w, r, loggedInUser, message)
+}
+
+//Post handles post requests to URI
+func (ah *AccountHandler) Post(w http.ResponseWriter, r *http.Request) {
+	amw := AuthMiddleware{}
+
+	//changing the password or email address hands over the account, so tokens aren't trusted with it
+	if amw.APITokenFromRequest(r) != nil {
+		fourOhThree(w, r)
+		return
+	}
+
+	loggedInUser, err := amw.LoggedInUser(r)
+	if err != nil || loggedInUser == nil {
+		http.Redirect(w, r, ah.loginRoute(), http.StatusFound)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		Error(w, err)
+		return
+	}
+
+	if err := ah.checkCurrentPassword(r, loggedInUser); err != nil {
+		ah.render(w, r, loggedInUser, err.Error())
+		return
+	}
+
+	user := *loggedInUser
+	user.FirstName = r.PostFormValue("firstname")
+	user.LastName = r.PostFormValue("lastname")
+	user.Email = r.PostFormValue("email")
+
+	authHash := r.PostFormValue("authhash")
+	if authHash != r.PostFormValue("repeatedauthhash") {
+		ah.render(w, r, &user, "Password and repeated passwords don't match")
+		return
+	}
+
+	//users can't rename themselves, the username is left as it is
+	if err := validateUserDetails(user.FirstName, user.LastName, user.Email, user.Username); err != nil {
+		ah.render(w, r, &user, err.Error())
+		return
+	}
+
+	err = db.WithTransaction(db.Conn, func(tx *sql.Tx) error {
+		ut := db.UsersTable{}
+		if err := ut.Update(tx, &user); err != nil {
+			return err
+		}
+
+		if len(authHash) == 0 {
+			return nil
+		}
+
+		return ut.ResetPassword(tx, &user, util.HashAndSalt([]byte(authHash)), user.UUID, time.Now().Unix())
+	})
+
+	if err != nil {
+		ah.render(w, r, &user, err.Error())
+		return
+	}
+
+	//a new password logs the user out everywhere, this session included
+	if len(authHash) > 0 {
+		logging.Info(fmt.Sprintf("User %s changed their password", user.Username))
+		setLoginMessage(w, r, "Your password has been changed, login with your new one")
+		http.Redirect(w, r, ah.loginRoute(), http.StatusFound)
+		return
+	}
+
+	logging.Info(fmt.Sprintf("User %s changed their account details", user.Username))
+	setLoginMessage(w, r, "Your details have been saved")
+	http.Redirect(w, r, ah.route, http.StatusFound)
+}
+
+//checkCurrentPassword wrong guesses count towards the same lockout as logging in, so the form can't be used to find the password
+func (ah *AccountHandler) checkCurrentPassword(r *http.Request, user *db.User) error {
+	allowed, err := loginAllowed(r, user.Username)
+	if err != nil {
+		return err
+	}
+
+	if !allowed {
+		return errors.New(loginThrottledMessage)
+	}
+
+	check := &db.User{Username: user.Username, AuthHash: r.PostFormValue("currentauthhash")}
+	if !check.Login() {
+		if err := recordFailedLogin(r, user.Username); err != nil {
+			logging.Error(err.Error())
+		}
+		return errors.New("Current password is incorrect")
+	}
+
+	return nil
+}
+
+func (ah *AccountHandler) render(w http.ResponseWriter, r *http.Request, user *db.User, message string) {
+	pctx := plush.NewContext()
+	pctx.Set("title", "Account")
+	pctx.Set("quillenabled", false)
+	pctx.Set("submitroute", ah.route)
+	pctx.Set("user", user)
+	pctx.Set("message", message)
+	pctx.Set("adminhiddenpassword", "")
+	if ah.Router.AdminHidden {
+		pctx.Set("adminhiddenpassword", fmt.Sprintf("/%s", ah.Router.AdminHiddenPassword))
+	}
+
+	RenderDefault(w, "account.html", pctx)
+}
+
+func (ah *AccountHandler) loginRoute() string {
+	if ah.Router.AdminHidden {
+		return fmt.Sprintf("/%s/login", ah.Router.AdminHiddenPassword)
+	}
+	return "/login"
+}
+
+//Route get URI route for handler
+func (ah *AccountHandler) Route() string { return ah.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (ah *AccountHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (ah *AccountHandler) HandlesPost() bool { return true }
+
+//Permission get the permission a client needs to be granted to use handler, the handler itself makes sure there's a logged in user
+func (ah *AccountHandler) Permission() db.Permission { return db.PERM_NONE }
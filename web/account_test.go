@@ -0,0 +1,238 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/util"
+)
+
+const handlerRouteAccount string = "/account"
+const testUserPassword string = "testuserpassword"
+
+//testUser loads the user with the username, creating them with the role first if they don't exist yet
+func testUser(t *testing.T, username string, role db.UsersRoleFlag) *db.User {
+	ut := db.UsersTable{}
+	user, err := ut.SelectByUsername(db.Conn, username)
+	if err != nil {
+		t.Fatalf("Error loading test user: %v", err)
+	}
+
+	if len(user.UUID) > 0 {
+		return user
+	}
+
+	err = ut.Insert(db.Conn, &db.User{
+		Username:        username,
+		CreatedDateTime: time.Now().Unix(),
+		Email:           username + "@local.com",
+		UserroleId:      int(role),
+		FirstName:       "Test",
+		LastName:        "User",
+		AuthHash:        util.HashAndSalt([]byte(testUserPassword)),
+	})
+	if err != nil {
+		t.Fatalf("Error inserting test user: %v", err)
+	}
+
+	user, err = ut.SelectByUsername(db.Conn, username)
+	if err != nil || len(user.UUID) == 0 {
+		t.Fatalf("Test user wasn't created: %v", err)
+	}
+	return user
+}
+
+//logInAs gives the request the session cookie of a new login by the user
+func logInAs(t *testing.T, req *http.Request, user *db.User) *http.Request {
+	sessionUUID, err := util.GenerateToken(16)
+	if err != nil {
+		t.Fatalf("Error generating session UUID: %v", err)
+	}
+
+	ast := db.AuthSessionsTable{}
+	err = ast.Insert(db.Conn, &db.AuthSession{
+		CreatedDateTime:    time.Now().Unix(),
+		LastActiveDateTime: time.Now().Unix(),
+		UserUUID:           user.UUID,
+		SessionUUID:        sessionUUID,
+		IPAddress:          "127.0.0.1",
+		UserAgent:          "test",
+	})
+	if err != nil {
+		t.Fatalf("Error inserting test session: %v", err)
+	}
+
+	loginRecorder := httptest.NewRecorder()
+	authSessionStore, err := sessionsstore.Get(req, "auth")
+	if err != nil {
+		t.Fatalf("Error loading auth session store: %v", err)
+	}
+	authSessionStore.Values["sessionuuid"] = sessionUUID
+	if err := authSessionStore.Save(req, loginRecorder); err != nil {
+		t.Fatalf("Error saving auth session store: %v", err)
+	}
+
+	for _, cookie := range loginRecorder.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	return req
+}
+
+//userFormRequest builds a post of the user details form with the values
+func userFormRequest(route string, formValues url.Values) *http.Request {
+	req := httptest.NewRequest("POST", route, strings.NewReader(formValues.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
+
+//useResourcesDir makes sure the working directory contains the /res folder, forms can't be rendered without it
+func useResourcesDir(t *testing.T) {
+	if _, err := os.Stat("res"); os.IsNotExist(err) {
+		if err := os.Chdir("../"); err != nil {
+			t.Fatalf("Error changing to the resources directory: %v", err)
+		}
+	}
+}
+
+//responseBody reads all of the response's body
+func responseBody(t *testing.T, resp *http.Response) string {
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Error reading response body: %v", err)
+	}
+	return string(body)
+}
+
+//postAccount submits the account form as the user, with the current password and the user's details
+func postAccount(t *testing.T, user *db.User, currentPassword string) *http.Response {
+	ah := AccountHandler{
+		Router: &MutableRouter{},
+		route:  handlerRouteAccount,
+	}
+
+	formValues := url.Values{}
+	formValues.Set("currentauthhash", currentPassword)
+	formValues.Set("firstname", user.FirstName)
+	formValues.Set("lastname", user.LastName)
+	formValues.Set("email", user.Email)
+
+	responseRecorder := httptest.NewRecorder()
+	ah.Post(responseRecorder, logInAs(t, userFormRequest(handlerRouteAccount, formValues), user))
+	return responseRecorder.Result()
+}
+
+func TestAccountPost(t *testing.T) {
+	user := testUser(t, "accountuser", db.REG_USER)
+	user.FirstName = "Changed"
+
+	resp := postAccount(t, user, testUserPassword)
+
+	if resp.StatusCode != http.StatusFound {
+		t.Errorf("Test account post didn't redirect request, STATUS CODE: %d", resp.StatusCode)
+	}
+
+	if location := resp.Header.Get("Location"); location != handlerRouteAccount {
+		t.Errorf("Test account post redirected to %s instead of the account page", location)
+	}
+
+	ut := db.UsersTable{}
+	if savedUser, err := ut.SelectByUUID(db.Conn, user.UUID); err != nil || savedUser.FirstName != "Changed" {
+		t.Errorf("Test account post didn't save the user's details")
+	}
+}
+
+func TestAccountPostWrongCurrentPassword(t *testing.T) {
+	useResourcesDir(t)
+	user := testUser(t, "wrongpassworduser", db.REG_USER)
+	originalFirstName := user.FirstName
+	user.FirstName = "Changed"
+
+	resp := postAccount(t, user, "notthepassword")
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Test account post with the wrong password didn't show the form again, STATUS CODE: %d", resp.StatusCode)
+	}
+
+	if body := responseBody(t, resp); !strings.Contains(body, "Current password is incorrect") {
+		t.Errorf("Test account post with the wrong password didn't say why it was rejected")
+	}
+
+	ut := db.UsersTable{}
+	if savedUser, err := ut.SelectByUUID(db.Conn, user.UUID); err != nil || savedUser.FirstName != originalFirstName {
+		t.Errorf("Test account post with the wrong password saved the user's details")
+	}
+
+	lat := db.LoginAttemptsTable{}
+	failures, _, err := lat.FailuresByUsernameSince(db.Conn, user.Username, time.Now().Add(-time.Minute).Unix())
+	if err != nil {
+		t.Fatalf("Error counting failed logins: %v", err)
+	}
+
+	if failures != 1 {
+		t.Errorf("Test account post with the wrong password recorded %d failed logins instead of 1", failures)
+	}
+
+	//enough wrong passwords should lock the account just like on the login page, the earlier ones are from
+	//long enough ago that the backoff doesn't stop the last one being tried
+	lockedUser := testUser(t, "lockedpassworduser", db.REG_USER)
+	for i := 1; i < accountLockAfter; i++ {
+		err := lat.Insert(db.Conn, &db.LoginAttempt{
+			CreatedDateTime: time.Now().Add(-loginMaxBackoff * 2).Unix(),
+			Username:        lockedUser.Username,
+			IPAddress:       "127.0.0.1",
+		})
+		if err != nil {
+			t.Fatalf("Error inserting failed login: %v", err)
+		}
+	}
+
+	postAccount(t, lockedUser, "notthepassword")
+
+	alt := db.AccountLocksTable{}
+	lockedUntil, err := alt.ActiveLockUntil(db.Conn, lockedUser.UUID, time.Now().Unix())
+	if err != nil {
+		t.Fatalf("Error loading account lock: %v", err)
+	}
+
+	if lockedUntil == 0 {
+		t.Errorf("Test account post with the wrong password didn't lock the account after %d failed logins", accountLockAfter)
+	}
+}
+
+func TestAccountPostDuplicateEmail(t *testing.T) {
+	useResourcesDir(t)
+	user := testUser(t, "accountemailuser", db.REG_USER)
+	otherUser := testUser(t, "accountotheruser", db.REG_USER)
+	user.Email = otherUser.Email
+
+	resp := postAccount(t, user, testUserPassword)
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Test account post with a duplicate email didn't show the form again, STATUS CODE: %d", resp.StatusCode)
+	}
+
+	if body := responseBody(t, resp); !strings.Contains(body, "Email address "+otherUser.Email+" is already in use") {
+		t.Errorf("Test account post with a duplicate email didn't say why it was rejected")
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"net/http"
 
 	"github.com/gobuffalo/plush"
+	"github.com/tacusci/berrycms/db"
 )
 
 //AdminHandler handler to contain pointer to core router and the URI string
@@ -50,3 +51,6 @@ func (ah *AdminHandler) HandlesGet() bool { return true }
 
 //HandlesPost retrieve whether this handler handles post requests
 func (ah *AdminHandler) HandlesPost() bool { return false }
+
+//Permission get the permission a client needs to be granted to use handler
+func (ah *AdminHandler) Permission() db.Permission { return db.PERM_ADMIN_VIEW }
@@ -0,0 +1,122 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gobuffalo/plush"
+	"github.com/tacusci/berrycms/backup"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/logging"
+)
+
+//AdminBackupHandler lets root users take a backup of the database and download it
+type AdminBackupHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (abh *AdminBackupHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if !abh.isRoot(r) {
+		fourOhThree(w, r)
+		return
+	}
+
+	settings := backup.Current()
+
+	pctx := plush.NewContext()
+	pctx.Set("title", "Backups")
+	pctx.Set("quillenabled", false)
+	pctx.Set("backupsenabled", backup.Enabled())
+	pctx.Set("backupdir", settings.Dir)
+	pctx.Set("backupinterval", settings.Interval.String())
+	pctx.Set("keepdaily", settings.KeepDaily)
+	pctx.Set("keepweekly", settings.KeepWeekly)
+	pctx.Set("submitroute", r.RequestURI)
+	pctx.Set("adminhiddenpassword", "")
+	if abh.Router.AdminHidden {
+		pctx.Set("adminhiddenpassword", fmt.Sprintf("/%s", abh.Router.AdminHiddenPassword))
+	}
+
+	RenderDefault(w, "admin.backup.html", pctx)
+}
+
+//Post handles post requests to URI
+func (abh *AdminBackupHandler) Post(w http.ResponseWriter, r *http.Request) {
+	if !abh.isRoot(r) {
+		fourOhThree(w, r)
+		return
+	}
+
+	if !backup.Enabled() {
+		Error(w, fmt.Errorf("Online backups are only supported for SQLite databases"))
+		return
+	}
+
+	fileName, err := backup.Create()
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		Error(w, err)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	logging.Info(fmt.Sprintf("Sending backup %s", fileName))
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filepath.Base(fileName)))
+	http.ServeContent(w, r, filepath.Base(fileName), info.ModTime(), file)
+}
+
+//isRoot backups hold every user's password hash, so only root users can take them
+func (abh *AdminBackupHandler) isRoot(r *http.Request) bool {
+	amw := AuthMiddleware{}
+
+	//tokens can be leaked or scoped, so backups need a web login
+	if amw.APITokenFromRequest(r) != nil {
+		return false
+	}
+
+	loggedInUser, err := amw.LoggedInUser(r)
+	return err == nil && loggedInUser != nil && db.UsersRoleFlag(loggedInUser.UserroleId) == db.ROOT_USER
+}
+
+//Route get URI route for handler
+func (abh *AdminBackupHandler) Route() string { return abh.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (abh *AdminBackupHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (abh *AdminBackupHandler) HandlesPost() bool { return true }
+
+//Permission get the permission a client needs to be granted to use handler
+func (abh *AdminBackupHandler) Permission() db.Permission { return db.PERM_ADMIN_VIEW }
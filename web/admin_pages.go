@@ -34,7 +34,7 @@ func (aph *AdminPagesHandler) Get(w http.ResponseWriter, r *http.Request) {
 	authors := make([]string, 0)
 
 	pt := db.PagesTable{}
-	rows, err := pt.Select(db.Conn, "createddatetime, uuid, title, route, authoruuid", "")
+	rows, err := db.From(&pt).Columns("createddatetime", "uuid", "title", "route", "authoruuid", "status").Query(db.Conn)
 
 	if err != nil {
 		Error(w, err)
@@ -46,13 +46,17 @@ func (aph *AdminPagesHandler) Get(w http.ResponseWriter, r *http.Request) {
 
 	for rows.Next() {
 		p := db.Page{}
-		rows.Scan(&p.CreatedDateTime, &p.UUID, &p.Title, &p.Route, &p.AuthorUUID)
+		rows.Scan(&p.CreatedDateTime, &p.UUID, &p.Title, &p.Route, &p.AuthorUUID, &p.Status)
 		pages = append(pages, p)
 
 		authorUser, err := ut.SelectByUUID(db.Conn, p.AuthorUUID)
 
+		//authors are looked up by the page's index, so one has to be added for every page
 		if err != nil {
 			logging.Error(err.Error())
+			authors = append(authors, "Unknown")
+		} else if authorUser.UUID == "" {
+			authors = append(authors, "Unknown")
 		} else {
 			authors = append(authors, fmt.Sprintf("%s %s", authorUser.FirstName, authorUser.LastName))
 		}
@@ -83,3 +87,6 @@ func (aph *AdminPagesHandler) HandlesGet() bool { return true }
 
 //HandlesPost retrieve whether this handler handles post requests
 func (aph *AdminPagesHandler) HandlesPost() bool { return false }
+
+//Permission get the permission a client needs to be granted to use handler
+func (aph *AdminPagesHandler) Permission() db.Permission { return db.PERM_PAGES_VIEW }
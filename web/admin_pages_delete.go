@@ -15,6 +15,7 @@
 package web
 
 import (
+	"database/sql"
 	"fmt"
 	"github.com/tacusci/berrycms/db"
 	"github.com/tacusci/logging"
@@ -39,11 +40,26 @@ func (apdh *AdminPagesDeleteHandler) Post(w http.ResponseWriter, r *http.Request
 		Error(w, err)
 	}
 
+	amw := AuthMiddleware{}
 	pt := db.PagesTable{}
 	deletedPages := false
 	for _, v := range r.PostForm {
+		pageToDelete, err := pt.SelectByUUID(db.Conn, v[0])
+		if err != nil {
+			logging.Error(err.Error())
+			continue
+		}
+		if !amw.HasPagePermission(r, pageToDelete, db.PAGE_EDIT) {
+			logging.Error(fmt.Sprintf("Not permitted to delete page %s, skipping...", pageToDelete.UUID))
+			continue
+		}
+		if err := db.WithTransaction(db.Conn, func(tx *sql.Tx) error {
+			return deletePage(tx, pageToDelete.UUID)
+		}); err != nil {
+			logging.Error(err.Error())
+			continue
+		}
 		deletedPages = true
-		pt.DeleteByUUID(db.Conn, v[0])
 	}
 
 	if deletedPages {
@@ -67,3 +83,23 @@ func (apdh *AdminPagesDeleteHandler) HandlesGet() bool { return false }
 
 //HandlesPost retrieve whether this handler handles post requests
 func (apdh *AdminPagesDeleteHandler) HandlesPost() bool { return true }
+
+//Permission get the permission a client needs to be granted to use handler
+func (apdh *AdminPagesDeleteHandler) Permission() db.Permission { return db.PERM_PAGES_DELETE }
+
+//deletePage removes the page along with its revision history and group permissions
+func deletePage(tx *sql.Tx, pageUUID string) error {
+	pt := db.PagesTable{}
+	if _, err := pt.DeleteByUUID(tx, pageUUID); err != nil {
+		return err
+	}
+
+	prt := db.PageRevisionsTable{}
+	if _, err := prt.DeleteByPageUUID(tx, pageUUID); err != nil {
+		return err
+	}
+
+	pgpt := db.PageGroupPermissionsTable{}
+	_, err := pgpt.DeleteByPageUUID(tx, pageUUID)
+	return err
+}
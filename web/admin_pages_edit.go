@@ -19,6 +19,7 @@ import (
 	"html/template"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/dchenk/go-render-quill"
 
@@ -47,6 +48,12 @@ func (apeh *AdminPagesEditHandler) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	amw := AuthMiddleware{}
+	if !amw.HasPagePermission(r, pageToEdit, db.PAGE_EDIT) {
+		fourOhThree(w, r)
+		return
+	}
+
 	if html, err := quill.Render([]byte(pageToEdit.Content)); err == nil {
 		pctx := plush.NewContext()
 		pctx.Set("title", fmt.Sprintf("Edit Page - %s", pageToEdit.Title))
@@ -54,6 +61,10 @@ func (apeh *AdminPagesEditHandler) Get(w http.ResponseWriter, r *http.Request) {
 		pctx.Set("pagetitle", pageToEdit.Title)
 		pctx.Set("pageroute", pageToEdit.Route)
 		pctx.Set("pagecontent", template.HTML(string(html)))
+		pctx.Set("pageuuid", pageToEdit.UUID)
+		pctx.Set("pagestatus", pageToEdit.Status.String())
+		pctx.Set("pagepublishat", UnixToDateTimeLocal(pageToEdit.PublishDateTime))
+		pctx.Set("pageunpublishat", UnixToDateTimeLocal(pageToEdit.UnpublishDateTime))
 		pctx.Set("adminhiddenpassword", "")
 		if apeh.Router.AdminHidden {
 			pctx.Set("adminhiddenpassword", fmt.Sprintf("/%s", apeh.Router.AdminHiddenPassword))
@@ -88,19 +99,60 @@ func (apeh *AdminPagesEditHandler) Post(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	amw := AuthMiddleware{}
+	loggedInUser, err := amw.LoggedInUser(r)
+
+	if err != nil || loggedInUser == nil {
+		logging.Error("Unable to find logged in user to record page revision against, stopping...")
+		return
+	}
+
+	if !amw.HasPagePermission(r, pageToEdit, db.PAGE_EDIT) {
+		logging.Error(fmt.Sprintf("User %s doesn't have permission to edit page %s, stopping...", loggedInUser.Username, pageToEdit.UUID))
+		return
+	}
+
+	prt := db.PageRevisionsTable{}
+
+	//pages saved before revisions existed have no history yet, so keep their original content before overwriting it
+	if revisions, err := prt.SelectByPageUUID(db.Conn, pageToEdit.UUID); err == nil && len(revisions) == 0 {
+		err = prt.Insert(db.Conn, &db.PageRevision{
+			CreatedDateTime: pageToEdit.CreatedDateTime,
+			PageUUID:        pageToEdit.UUID,
+			AuthorUUID:      pageToEdit.AuthorUUID,
+			Title:           pageToEdit.Title,
+			Route:           pageToEdit.Route,
+			Content:         pageToEdit.Content,
+		})
+		if err != nil {
+			logging.Error(err.Error())
+		}
+	}
+
 	pageToEdit.Title = r.PostFormValue("title")
 	oldPageRoute := pageToEdit.Route
+	wasLive := pageToEdit.IsLive(time.Now().Unix())
 	pageToEdit.Route = r.PostFormValue("route")
 	pageToEdit.Content = r.PostFormValue("pagecontent")
 
+	if err := parsePagePublicationForm(r, pageToEdit); err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
 	err = pt.Update(db.Conn, pageToEdit)
 
 	if err != nil {
 		logging.Error(err.Error())
+		return
 	}
 
-	//reloading all page routes is potentially really intensive, so only do this if the route has actually changed
-	if strings.Compare(oldPageRoute, pageToEdit.Route) != 0 {
+	if err := prt.InsertFromPage(db.Conn, pageToEdit, loggedInUser.UUID); err != nil {
+		logging.Error(err.Error())
+	}
+
+	//reloading all page routes is potentially really intensive, so only do this if the route or whether it's live has actually changed
+	if strings.Compare(oldPageRoute, pageToEdit.Route) != 0 || wasLive != pageToEdit.IsLive(time.Now().Unix()) {
 		apeh.Router.Reload()
 	}
 }
@@ -113,3 +165,6 @@ func (apeh *AdminPagesEditHandler) HandlesGet() bool { return true }
 
 //HandlesPost retrieve whether this handler handles post requests
 func (apeh *AdminPagesEditHandler) HandlesPost() bool { return true }
+
+//Permission get the permission a client needs to be granted to use handler
+func (apeh *AdminPagesEditHandler) Permission() db.Permission { return db.PERM_PAGES_EDIT }
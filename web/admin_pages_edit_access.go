@@ -0,0 +1,188 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/plush"
+	"github.com/gorilla/mux"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/logging"
+)
+
+//AdminPagesEditAccessHandler sets which groups can read or edit a page
+type AdminPagesEditAccessHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//pageGroupAccess pairs a group with the access it currently has to a page for rendering
+type pageGroupAccess struct {
+	Group      db.Group
+	Permission string
+}
+
+//Get handles get requests to URI
+func (apeah *AdminPagesEditAccessHandler) Get(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	pt := db.PagesTable{}
+	page, err := pt.SelectByUUID(db.Conn, vars["uuid"])
+	if err != nil {
+		logging.Error(err.Error())
+		fourOhFour(w, r)
+		return
+	}
+
+	amw := AuthMiddleware{}
+	if !amw.HasPagePermission(r, page, db.PAGE_EDIT) {
+		fourOhThree(w, r)
+		return
+	}
+
+	pgpt := db.PageGroupPermissionsTable{}
+	permissions, err := pgpt.SelectByPageUUID(db.Conn, page.UUID)
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	groupPermissions := make(map[string]db.PagePermission)
+	for _, pgp := range permissions {
+		groupPermissions[pgp.GroupUUID] = db.PagePermission(pgp.Permission)
+	}
+
+	gt := db.GroupTable{}
+	rows, err := db.From(&gt).Columns("createddatetime", "uuid", "title").Query(db.Conn)
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	defer rows.Close()
+
+	groupsAccess := []pageGroupAccess{}
+	for rows.Next() {
+		group := db.Group{}
+		if err := rows.Scan(&group.CreatedDateTime, &group.UUID, &group.Title); err != nil {
+			logging.Error(err.Error())
+			continue
+		}
+		groupsAccess = append(groupsAccess, pageGroupAccess{Group: group, Permission: groupPermissions[group.UUID].String()})
+	}
+
+	pctx := plush.NewContext()
+	pctx.Set("title", fmt.Sprintf("Access - %s", page.Title))
+	pctx.Set("quillenabled", false)
+	pctx.Set("submitroute", r.RequestURI)
+	pctx.Set("pagetitle", page.Title)
+	pctx.Set("pageuuid", page.UUID)
+	pctx.Set("groupsaccess", groupsAccess)
+	pctx.Set("adminhiddenpassword", "")
+	if apeah.Router.AdminHidden {
+		pctx.Set("adminhiddenpassword", fmt.Sprintf("/%s", apeah.Router.AdminHiddenPassword))
+	}
+
+	RenderDefault(w, "admin.pages.edit.access.html", pctx)
+}
+
+//Post handles post requests to URI
+func (apeah *AdminPagesEditAccessHandler) Post(w http.ResponseWriter, r *http.Request) {
+	defer http.Redirect(w, r, r.RequestURI, http.StatusFound)
+	vars := mux.Vars(r)
+
+	err := r.ParseForm()
+
+	if err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	pt := db.PagesTable{}
+	page, err := pt.SelectByUUID(db.Conn, vars["uuid"])
+	if err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	amw := AuthMiddleware{}
+	if !amw.HasPagePermission(r, page, db.PAGE_EDIT) {
+		logging.Error(fmt.Sprintf("Not permitted to change access of page %s, stopping...", page.UUID))
+		return
+	}
+
+	gt := db.GroupTable{}
+	permissions := []db.PageGroupPermission{}
+	for key, values := range r.PostForm {
+		if !strings.HasPrefix(key, "group-") || len(values) == 0 {
+			continue
+		}
+
+		permission, err := db.ParsePagePermission(values[0])
+		if err != nil {
+			logging.Error(err.Error())
+			return
+		}
+
+		if permission == db.PAGE_NO_ACCESS {
+			continue
+		}
+
+		group, err := gt.SelectByUUID(db.Conn, strings.TrimPrefix(key, "group-"))
+		if err != nil {
+			logging.Error(err.Error())
+			return
+		}
+
+		if len(group.UUID) == 0 {
+			logging.Error(fmt.Sprintf("Group %s doesn't exist, stopping...", strings.TrimPrefix(key, "group-")))
+			return
+		}
+
+		permissions = append(permissions, db.PageGroupPermission{
+			CreatedDateTime: time.Now().Unix(),
+			GroupUUID:       group.UUID,
+			Permission:      int(permission),
+		})
+	}
+
+	pgpt := db.PageGroupPermissionsTable{}
+	err = db.WithTransaction(db.Conn, func(tx *sql.Tx) error {
+		return pgpt.ReplaceForPage(tx, page.UUID, permissions)
+	})
+	if err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	//restricted pages are left out of the sitemap and added to robots
+	apeah.Router.Reload()
+}
+
+//Route get URI route for handler
+func (apeah *AdminPagesEditAccessHandler) Route() string { return apeah.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (apeah *AdminPagesEditAccessHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (apeah *AdminPagesEditAccessHandler) HandlesPost() bool { return true }
+
+//Permission get the permission a client needs to be granted to use handler
+func (apeah *AdminPagesEditAccessHandler) Permission() db.Permission { return db.PERM_PAGES_EDIT }
@@ -0,0 +1,98 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gobuffalo/plush"
+	"github.com/gorilla/mux"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/logging"
+)
+
+//AdminPagesEditRevisionsHandler lists all of the saved revisions of a page
+type AdminPagesEditRevisionsHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (aperh *AdminPagesEditRevisionsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	pt := db.PagesTable{}
+	page, err := pt.SelectByUUID(db.Conn, vars["uuid"])
+	if err != nil {
+		logging.Error(err.Error())
+		fourOhFour(w, r)
+		return
+	}
+
+	amw := AuthMiddleware{}
+	if !amw.HasPagePermission(r, page, db.PAGE_EDIT) {
+		fourOhThree(w, r)
+		return
+	}
+
+	prt := db.PageRevisionsTable{}
+	revisions, err := prt.SelectByPageUUID(db.Conn, page.UUID)
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	ut := db.UsersTable{}
+	authors := make([]string, 0, len(revisions))
+
+	for _, revision := range revisions {
+		authorUser, err := ut.SelectByUUID(db.Conn, revision.AuthorUUID)
+		if err != nil || authorUser.UUID == "" {
+			authors = append(authors, "Unknown")
+			continue
+		}
+		authors = append(authors, fmt.Sprintf("%s %s", authorUser.FirstName, authorUser.LastName))
+	}
+
+	pctx := plush.NewContext()
+	pctx.Set("unixtostring", UnixToTimeString)
+	pctx.Set("title", fmt.Sprintf("Revisions - %s", page.Title))
+	pctx.Set("quillenabled", false)
+	pctx.Set("pagetitle", page.Title)
+	pctx.Set("pageuuid", page.UUID)
+	pctx.Set("revisions", revisions)
+	pctx.Set("authors", authors)
+	pctx.Set("adminhiddenpassword", "")
+	if aperh.Router.AdminHidden {
+		pctx.Set("adminhiddenpassword", fmt.Sprintf("/%s", aperh.Router.AdminHiddenPassword))
+	}
+
+	RenderDefault(w, "admin.pages.edit.revisions.html", pctx)
+}
+
+//Post handles post requests to URI
+func (aperh *AdminPagesEditRevisionsHandler) Post(w http.ResponseWriter, r *http.Request) {}
+
+//Route get URI route for handler
+func (aperh *AdminPagesEditRevisionsHandler) Route() string { return aperh.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (aperh *AdminPagesEditRevisionsHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (aperh *AdminPagesEditRevisionsHandler) HandlesPost() bool { return false }
+
+//Permission get the permission a client needs to be granted to use handler
+func (aperh *AdminPagesEditRevisionsHandler) Permission() db.Permission { return db.PERM_PAGES_EDIT }
@@ -0,0 +1,125 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gobuffalo/plush"
+	"github.com/gorilla/mux"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/util"
+)
+
+//AdminPagesEditRevisionsDiffHandler shows the differences between two revisions of a page
+type AdminPagesEditRevisionsDiffHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (aperdh *AdminPagesEditRevisionsDiffHandler) Get(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	pt := db.PagesTable{}
+	page, err := pt.SelectByUUID(db.Conn, vars["uuid"])
+	if err != nil {
+		fourOhFour(w, r)
+		return
+	}
+
+	amw := AuthMiddleware{}
+	if !amw.HasPagePermission(r, page, db.PAGE_EDIT) {
+		fourOhThree(w, r)
+		return
+	}
+
+	prt := db.PageRevisionsTable{}
+
+	fromRevision, err := prt.SelectByUUID(db.Conn, r.URL.Query().Get("from"))
+	if err != nil || fromRevision.PageUUID != vars["uuid"] {
+		fourOhFour(w, r)
+		return
+	}
+
+	toRevision, err := prt.SelectByUUID(db.Conn, r.URL.Query().Get("to"))
+	if err != nil || toRevision.PageUUID != vars["uuid"] {
+		fourOhFour(w, r)
+		return
+	}
+
+	//always show changes going forward in time, regardless of the order they were picked in
+	if fromRevision.CreatedDateTime > toRevision.CreatedDateTime {
+		fromRevision, toRevision = toRevision, fromRevision
+	}
+
+	pctx := plush.NewContext()
+	pctx.Set("unixtostring", UnixToTimeString)
+	pctx.Set("title", fmt.Sprintf("Revision Diff - %s", toRevision.Title))
+	pctx.Set("quillenabled", false)
+	pctx.Set("pageuuid", vars["uuid"])
+	pctx.Set("fromrevision", fromRevision)
+	pctx.Set("torevision", toRevision)
+	pctx.Set("titlediff", util.DiffLines([]string{fromRevision.Title}, []string{toRevision.Title}))
+	pctx.Set("routediff", util.DiffLines([]string{fromRevision.Route}, []string{toRevision.Route}))
+	pctx.Set("contentdiff", util.DiffLines(pageTextLines(fromRevision.Content), pageTextLines(toRevision.Content)))
+	pctx.Set("adminhiddenpassword", "")
+	if aperdh.Router.AdminHidden {
+		pctx.Set("adminhiddenpassword", fmt.Sprintf("/%s", aperdh.Router.AdminHiddenPassword))
+	}
+
+	RenderDefault(w, "admin.pages.edit.revisions.diff.html", pctx)
+}
+
+//Post handles post requests to URI
+func (aperdh *AdminPagesEditRevisionsDiffHandler) Post(w http.ResponseWriter, r *http.Request) {}
+
+//Route get URI route for handler
+func (aperdh *AdminPagesEditRevisionsDiffHandler) Route() string { return aperdh.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (aperdh *AdminPagesEditRevisionsDiffHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (aperdh *AdminPagesEditRevisionsDiffHandler) HandlesPost() bool { return false }
+
+//Permission get the permission a client needs to be granted to use handler
+func (aperdh *AdminPagesEditRevisionsDiffHandler) Permission() db.Permission {
+	return db.PERM_PAGES_EDIT
+}
+
+//pageTextLines pulls the text out of saved QuillJS delta page content, falling back to the raw content if it isn't a delta
+func pageTextLines(content string) []string {
+	var delta []struct {
+		Insert interface{} `json:"insert"`
+	}
+
+	text := content
+	if err := json.Unmarshal([]byte(content), &delta); err == nil {
+		var sb strings.Builder
+		for _, op := range delta {
+			//embeds such as images are objects rather than strings
+			if insert, ok := op.Insert.(string); ok {
+				sb.WriteString(insert)
+			}
+		}
+		text = sb.String()
+	}
+
+	return strings.Split(strings.TrimRight(text, "\n"), "\n")
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/logging"
+)
+
+//AdminPagesEditRevisionsRestoreHandler replaces a page's current content with one of its earlier revisions
+type AdminPagesEditRevisionsRestoreHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (aperrh *AdminPagesEditRevisionsRestoreHandler) Get(w http.ResponseWriter, r *http.Request) {}
+
+//Post handles post requests to URI
+func (aperrh *AdminPagesEditRevisionsRestoreHandler) Post(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var redirectURI = "/admin/pages/edit/" + vars["uuid"]
+
+	if aperrh.Router.AdminHidden {
+		redirectURI = fmt.Sprintf("/%s", aperrh.Router.AdminHiddenPassword) + redirectURI
+	}
+
+	defer http.Redirect(w, r, redirectURI, http.StatusFound)
+
+	err := r.ParseForm()
+
+	if err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	amw := AuthMiddleware{}
+	loggedInUser, err := amw.LoggedInUser(r)
+
+	if err != nil || loggedInUser == nil {
+		logging.Error("Unable to find logged in user to record page revision against, stopping...")
+		return
+	}
+
+	pt := db.PagesTable{}
+	pageToRestore, err := pt.SelectByUUID(db.Conn, vars["uuid"])
+	if err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	if !amw.HasPagePermission(r, pageToRestore, db.PAGE_EDIT) {
+		logging.Error(fmt.Sprintf("User %s doesn't have permission to edit page %s, stopping...", loggedInUser.Username, pageToRestore.UUID))
+		return
+	}
+
+	prt := db.PageRevisionsTable{}
+	revision, err := prt.SelectByUUID(db.Conn, r.PostFormValue("revisionuuid"))
+	if err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	if revision.PageUUID != pageToRestore.UUID {
+		logging.Error(fmt.Sprintf("Revision %s does not belong to page %s, stopping...", revision.UUID, pageToRestore.UUID))
+		return
+	}
+
+	oldPageRoute := pageToRestore.Route
+	pageToRestore.Title = revision.Title
+	pageToRestore.Route = revision.Route
+	pageToRestore.Content = revision.Content
+
+	if err := pt.Update(db.Conn, pageToRestore); err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	//restoring counts as a new save, so the history keeps going forwards rather than being rewritten
+	if err := prt.InsertFromPage(db.Conn, pageToRestore, loggedInUser.UUID); err != nil {
+		logging.Error(err.Error())
+	}
+
+	if strings.Compare(oldPageRoute, pageToRestore.Route) != 0 {
+		aperrh.Router.Reload()
+	}
+}
+
+//Route get URI route for handler
+func (aperrh *AdminPagesEditRevisionsRestoreHandler) Route() string { return aperrh.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (aperrh *AdminPagesEditRevisionsRestoreHandler) HandlesGet() bool { return false }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (aperrh *AdminPagesEditRevisionsRestoreHandler) HandlesPost() bool { return true }
+
+//Permission get the permission a client needs to be granted to use handler
+func (aperrh *AdminPagesEditRevisionsRestoreHandler) Permission() db.Permission {
+	return db.PERM_PAGES_EDIT
+}
@@ -15,6 +15,7 @@
 package web
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -38,6 +39,9 @@ func (apnh *AdminPagesNewHandler) Get(w http.ResponseWriter, r *http.Request) {
 	pctx.Set("pagetitle", "")
 	pctx.Set("pageroute", "")
 	pctx.Set("pagecontent", "")
+	pctx.Set("pagestatus", db.PAGE_DRAFT.String())
+	pctx.Set("pagepublishat", "")
+	pctx.Set("pageunpublishat", "")
 	pctx.Set("quillenabled", true)
 	pctx.Set("adminhiddenpassword", "")
 	if apnh.Router.AdminHidden {
@@ -58,6 +62,7 @@ func (apnh *AdminPagesNewHandler) Post(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		logging.Error(err.Error())
 		http.Redirect(w, r, redirectURI, http.StatusFound)
+		return
 	}
 
 	pt := db.PagesTable{}
@@ -65,9 +70,12 @@ func (apnh *AdminPagesNewHandler) Post(w http.ResponseWriter, r *http.Request) {
 	amw := AuthMiddleware{}
 	loggedInUser, err := amw.LoggedInUser(r)
 
-	if err != nil {
-		logging.Error(err.Error())
+	if err != nil || loggedInUser == nil {
+		if err != nil {
+			logging.Error(err.Error())
+		}
 		http.Redirect(w, r, redirectURI, http.StatusFound)
+		return
 	}
 
 	pageToCreate := &db.Page{
@@ -78,16 +86,31 @@ func (apnh *AdminPagesNewHandler) Post(w http.ResponseWriter, r *http.Request) {
 		Content:         r.PostFormValue("pagecontent"),
 	}
 
+	if err := parsePagePublicationForm(r, pageToCreate); err != nil {
+		logging.Error(err.Error())
+		http.Redirect(w, r, redirectURI, http.StatusFound)
+		return
+	}
+
 	err = pt.Insert(db.Conn, pageToCreate)
 
+	//a page might already be at the route, it mustn't be mistaken for the one just created
 	if err != nil {
 		logging.Error(err.Error())
+		http.Redirect(w, r, redirectURI, http.StatusFound)
+		return
 	}
 
 	pageToCreate, err = pt.SelectByRoute(db.Conn, pageToCreate.Route)
 
 	if err != nil {
 		http.Redirect(w, r, r.RequestURI, http.StatusFound)
+		return
+	}
+
+	prt := db.PageRevisionsTable{}
+	if err := prt.InsertFromPage(db.Conn, pageToCreate, loggedInUser.UUID); err != nil {
+		logging.Error(err.Error())
 	}
 
 	apnh.Router.Reload()
@@ -109,3 +132,47 @@ func (apnh *AdminPagesNewHandler) HandlesGet() bool { return true }
 
 //HandlesPost retrieve whether this handler handles post requests
 func (apnh *AdminPagesNewHandler) HandlesPost() bool { return true }
+
+//Permission get the permission a client needs to be granted to use handler
+func (apnh *AdminPagesNewHandler) Permission() db.Permission { return db.PERM_PAGES_CREATE }
+
+//parsePagePublicationForm reads the status and publish times from the submitted page form into the page
+func parsePagePublicationForm(r *http.Request, p *db.Page) error {
+	status, err := db.ParsePageStatus(r.PostFormValue("status"))
+	if err != nil {
+		return err
+	}
+
+	publishAt, err := DateTimeLocalToUnix(r.PostFormValue("publishat"))
+	if err != nil {
+		return err
+	}
+
+	unpublishAt, err := DateTimeLocalToUnix(r.PostFormValue("unpublishat"))
+	if err != nil {
+		return err
+	}
+
+	p.Status = status
+	p.PublishDateTime = publishAt
+	p.UnpublishDateTime = unpublishAt
+
+	return validatePagePublication(p)
+}
+
+//validatePagePublication makes sure that the page's status and publish times make sense together
+func validatePagePublication(p *db.Page) error {
+	if p.Status != db.PAGE_PUBLISHED && p.Status != db.PAGE_DRAFT && p.Status != db.PAGE_SCHEDULED {
+		return fmt.Errorf("Unknown page status %d", p.Status)
+	}
+
+	if p.Status == db.PAGE_SCHEDULED && p.PublishDateTime == 0 {
+		return errors.New("Scheduled pages need a time to publish at")
+	}
+
+	if p.PublishDateTime > 0 && p.UnpublishDateTime > 0 && p.UnpublishDateTime <= p.PublishDateTime {
+		return errors.New("Page unpublish time must be after its publish time")
+	}
+
+	return nil
+}
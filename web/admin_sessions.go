@@ -0,0 +1,129 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gobuffalo/plush"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/logging"
+)
+
+//AdminSessionsHandler lists the logged in user's sessions and lets them revoke them
+type AdminSessionsHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (ash *AdminSessionsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	amw := AuthMiddleware{}
+	loggedInUser, err := amw.LoggedInUser(r)
+	if err != nil || loggedInUser == nil {
+		fourOhThree(w, r)
+		return
+	}
+
+	renderSessions(w, r, ash.Router, loggedInUser, "My Sessions")
+}
+
+//Post handles post requests to URI
+func (ash *AdminSessionsHandler) Post(w http.ResponseWriter, r *http.Request) {
+	amw := AuthMiddleware{}
+
+	//sessions belong to web logins, tokens have their own page to be revoked from
+	if amw.APITokenFromRequest(r) != nil {
+		fourOhThree(w, r)
+		return
+	}
+
+	loggedInUser, err := amw.LoggedInUser(r)
+	if err != nil || loggedInUser == nil {
+		fourOhThree(w, r)
+		return
+	}
+
+	revokeSessions(w, r, loggedInUser)
+	http.Redirect(w, r, ash.route, http.StatusFound)
+}
+
+//renderSessions lists the user's sessions with forms to revoke each of them
+func renderSessions(w http.ResponseWriter, r *http.Request, router *MutableRouter, user *db.User, title string) {
+	ast := db.AuthSessionsTable{}
+	authSessions, err := ast.SelectByUserUUID(db.Conn, user.UUID)
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	amw := AuthMiddleware{}
+
+	pctx := plush.NewContext()
+	pctx.Set("unixtostring", UnixToTimeString)
+	pctx.Set("title", title)
+	pctx.Set("quillenabled", false)
+	pctx.Set("submitroute", r.RequestURI)
+	pctx.Set("username", user.Username)
+	pctx.Set("sessions", authSessions)
+	pctx.Set("currentsessionuuid", amw.CurrentSessionUUID(r))
+	pctx.Set("adminhiddenpassword", "")
+	if router.AdminHidden {
+		pctx.Set("adminhiddenpassword", fmt.Sprintf("/%s", router.AdminHiddenPassword))
+	}
+
+	RenderDefault(w, "admin.sessions.html", pctx)
+}
+
+//revokeSessions deletes either the user's session posted by ID, or all of them
+func revokeSessions(w http.ResponseWriter, r *http.Request, user *db.User) {
+	if err := r.ParseForm(); err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	ast := db.AuthSessionsTable{}
+
+	if r.PostFormValue("all") != "" {
+		if _, err := ast.DeleteByUserUUID(db.Conn, user.UUID); err != nil {
+			logging.Error(err.Error())
+		}
+		return
+	}
+
+	authSessionID, err := strconv.Atoi(r.PostFormValue("authsessionid"))
+	if err != nil {
+		logging.Error(fmt.Sprintf("Invalid session ID %s to revoke, stopping...", r.PostFormValue("authsessionid")))
+		return
+	}
+
+	if _, err := ast.DeleteByID(db.Conn, authSessionID, user.UUID); err != nil {
+		logging.Error(err.Error())
+	}
+}
+
+//Route get URI route for handler
+func (ash *AdminSessionsHandler) Route() string { return ash.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (ash *AdminSessionsHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (ash *AdminSessionsHandler) HandlesPost() bool { return true }
+
+//Permission get the permission a client needs to be granted to use handler
+func (ash *AdminSessionsHandler) Permission() db.Permission { return db.PERM_NONE }
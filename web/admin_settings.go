@@ -0,0 +1,141 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/plush"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/logging"
+)
+
+//AdminSettingsHandler lets admins change the site settings without restarting
+type AdminSettingsHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (ash *AdminSettingsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	st := db.SettingsTable{}
+	settings, err := st.Select(db.Conn)
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	ash.render(w, settings, "")
+}
+
+//Post handles post requests to URI
+func (ash *AdminSettingsHandler) Post(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		Error(w, err)
+		return
+	}
+
+	settings, err := settingsFromForm(r)
+	if err != nil {
+		ash.render(w, settings, err.Error())
+		return
+	}
+
+	gt := db.GroupTable{}
+	if group, err := gt.SelectByTitle(db.Conn, settings.DefaultGroup); err != nil || len(group.UUID) == 0 {
+		ash.render(w, settings, fmt.Sprintf("Group %s doesn't exist", settings.DefaultGroup))
+		return
+	}
+
+	st := db.SettingsTable{}
+	if err := st.Save(db.Conn, settings); err != nil {
+		ash.render(w, settings, err.Error())
+		return
+	}
+
+	logging.Info("Site settings changed, reloading...")
+	ash.Router.Reload()
+
+	http.Redirect(w, r, ash.route, http.StatusFound)
+}
+
+//settingsFromForm reads the submitted settings, the returned settings are always usable to refill the form
+func settingsFromForm(r *http.Request) (*db.Settings, error) {
+	settings := &db.Settings{
+		SiteTitle:        strings.TrimSpace(r.PostFormValue("sitetitle")),
+		BaseURL:          strings.TrimSpace(r.PostFormValue("baseurl")),
+		DefaultTheme:     strings.TrimSpace(r.PostFormValue("defaulttheme")),
+		RobotsEnabled:    r.PostFormValue("robotsenabled") == "on",
+		SitemapEnabled:   r.PostFormValue("sitemapenabled") == "on",
+		RegistrationOpen: r.PostFormValue("registrationopen") == "on",
+		DefaultGroup:     strings.TrimSpace(r.PostFormValue("defaultgroup")),
+	}
+
+	timeouts := []struct {
+		name  string
+		label string
+		dest  *int64
+	}{
+		{"sessionidle", "Session idle timeout", &settings.SessionIdle},
+		{"sessionmax", "Maximum session age", &settings.SessionMaxAge},
+		{"remembermax", "Remember me session age", &settings.RememberMaxAge},
+	}
+
+	for _, timeout := range timeouts {
+		d, err := time.ParseDuration(strings.TrimSpace(r.PostFormValue(timeout.name)))
+		if err != nil {
+			return settings, fmt.Errorf("%s must be a duration such as 20m or 12h", timeout.label)
+		}
+		*timeout.dest = int64(d.Seconds())
+	}
+
+	return settings, nil
+}
+
+func (ash *AdminSettingsHandler) render(w http.ResponseWriter, settings *db.Settings, errorMessage string) {
+	timeouts := sessionTimeoutsOf(*settings)
+
+	pctx := plush.NewContext()
+	pctx.Set("title", "Settings")
+	pctx.Set("quillenabled", false)
+	pctx.Set("submitroute", ash.route)
+	pctx.Set("settings", settings)
+	pctx.Set("sessionidle", timeouts.Idle.String())
+	pctx.Set("sessionmax", timeouts.MaxAge.String())
+	pctx.Set("remembermax", timeouts.RememberMaxAge.String())
+	pctx.Set("overridden", ash.Router.SettingsOverride != nil)
+	pctx.Set("errormessage", errorMessage)
+	pctx.Set("adminhiddenpassword", "")
+	if ash.Router.AdminHidden {
+		pctx.Set("adminhiddenpassword", fmt.Sprintf("/%s", ash.Router.AdminHiddenPassword))
+	}
+
+	RenderDefault(w, "admin.settings.html", pctx)
+}
+
+//Route get URI route for handler
+func (ash *AdminSettingsHandler) Route() string { return ash.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (ash *AdminSettingsHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (ash *AdminSettingsHandler) HandlesPost() bool { return true }
+
+//Permission get the permission a client needs to be granted to use handler
+func (ash *AdminSettingsHandler) Permission() db.Permission { return db.PERM_SETTINGS_MANAGE }
@@ -0,0 +1,166 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gobuffalo/plush"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/util"
+	"github.com/tacusci/logging"
+)
+
+//apiTokenExpiryDays how long a new API token can be set to last for, tokens always have to expire
+var apiTokenExpiryDays = []int{7, 30, 90, 365}
+
+//AdminTokensHandler lists and creates the logged in user's personal API tokens
+type AdminTokensHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (ath *AdminTokensHandler) Get(w http.ResponseWriter, r *http.Request) {
+	ath.render(w, r, "")
+}
+
+//Post handles post requests to URI
+func (ath *AdminTokensHandler) Post(w http.ResponseWriter, r *http.Request) {
+	amw := AuthMiddleware{}
+
+	//tokens can't be used to create more tokens, otherwise they'd never really expire
+	if amw.APITokenFromRequest(r) != nil {
+		fourOhThree(w, r)
+		return
+	}
+
+	loggedInUser, err := amw.LoggedInUser(r)
+	if err != nil || loggedInUser == nil {
+		fourOhThree(w, r)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		Error(w, err)
+		return
+	}
+
+	title := r.PostFormValue("title")
+	if len(title) == 0 {
+		Error(w, errors.New("API token title is blank"))
+		return
+	}
+
+	expiresInDays, err := strconv.Atoi(r.PostFormValue("expiresindays"))
+	if err != nil || expiresInDays <= 0 {
+		Error(w, fmt.Errorf("Invalid API token expiry %s", r.PostFormValue("expiresindays")))
+		return
+	}
+
+	ut := db.UsersTable{}
+	scopes := []db.Permission{}
+	for _, permission := range db.AllPermissions {
+		if r.PostFormValue(string(permission)) == "" {
+			continue
+		}
+		//there's no point scoping a token to something the user can't do
+		if hasPermission, err := ut.HasPermission(db.Conn, loggedInUser, permission); err == nil && hasPermission {
+			scopes = append(scopes, permission)
+		}
+	}
+
+	token, err := util.GenerateToken(32)
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	apiToken := &db.APIToken{
+		CreatedDateTime: time.Now().Unix(),
+		UserUUID:        loggedInUser.UUID,
+		Title:           title,
+		TokenHash:       util.HashToken(token),
+		ExpiresDateTime: time.Now().AddDate(0, 0, expiresInDays).Unix(),
+	}
+	apiToken.SetScopes(scopes)
+
+	att := db.APITokensTable{}
+	if err := att.Insert(db.Conn, apiToken); err != nil {
+		Error(w, err)
+		return
+	}
+
+	//this is the only time the token itself is ever shown, after this only its hash exists
+	ath.render(w, r, token)
+}
+
+func (ath *AdminTokensHandler) render(w http.ResponseWriter, r *http.Request, newToken string) {
+	amw := AuthMiddleware{}
+	loggedInUser, err := amw.LoggedInUser(r)
+	if err != nil || loggedInUser == nil {
+		fourOhThree(w, r)
+		return
+	}
+
+	att := db.APITokensTable{}
+	tokens, err := att.SelectByUserUUID(db.Conn, loggedInUser.UUID)
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	ut := db.UsersTable{}
+	grantablePermissions := []db.Permission{}
+	for _, permission := range db.AllPermissions {
+		if hasPermission, err := ut.HasPermission(db.Conn, loggedInUser, permission); err != nil {
+			logging.Error(err.Error())
+		} else if hasPermission {
+			grantablePermissions = append(grantablePermissions, permission)
+		}
+	}
+
+	pctx := plush.NewContext()
+	pctx.Set("unixtostring", UnixToTimeString)
+	pctx.Set("title", "API Tokens")
+	pctx.Set("quillenabled", false)
+	pctx.Set("submitroute", r.RequestURI)
+	pctx.Set("tokens", tokens)
+	pctx.Set("newtoken", newToken)
+	pctx.Set("permissions", grantablePermissions)
+	pctx.Set("expirydays", apiTokenExpiryDays)
+	pctx.Set("adminhiddenpassword", "")
+	if ath.Router.AdminHidden {
+		pctx.Set("adminhiddenpassword", fmt.Sprintf("/%s", ath.Router.AdminHiddenPassword))
+	}
+
+	RenderDefault(w, "admin.tokens.html", pctx)
+}
+
+//Route get URI route for handler
+func (ath *AdminTokensHandler) Route() string { return ath.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (ath *AdminTokensHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (ath *AdminTokensHandler) HandlesPost() bool { return true }
+
+//Permission get the permission a client needs to be granted to use handler
+func (ath *AdminTokensHandler) Permission() db.Permission { return db.PERM_NONE }
@@ -0,0 +1,265 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gobuffalo/plush"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/util"
+)
+
+//twoFactorIssuer name authenticator apps list enrolled accounts under
+const twoFactorIssuer = "Berrycms"
+
+//recoveryCodeCount number of recovery codes generated for a user each time
+const recoveryCodeCount = 10
+
+//AdminTwoFactorHandler enrols the logged in user in two factor authentication and manages their recovery codes
+type AdminTwoFactorHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (atfh *AdminTwoFactorHandler) Get(w http.ResponseWriter, r *http.Request) {
+	atfh.render(w, r, nil, "")
+}
+
+//Post handles post requests to URI
+func (atfh *AdminTwoFactorHandler) Post(w http.ResponseWriter, r *http.Request) {
+	amw := AuthMiddleware{}
+
+	//two factor authentication protects the web login, tokens have no business changing it
+	if amw.APITokenFromRequest(r) != nil {
+		fourOhThree(w, r)
+		return
+	}
+
+	loggedInUser, err := amw.LoggedInUser(r)
+	if err != nil || loggedInUser == nil {
+		fourOhThree(w, r)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		Error(w, err)
+		return
+	}
+
+	utft := db.UserTwoFactorTable{}
+	twoFactor, err := utft.SelectByUserUUID(db.Conn, loggedInUser.UUID)
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	switch r.PostFormValue("action") {
+	case "start":
+		if twoFactor != nil && twoFactor.Enabled {
+			atfh.render(w, r, nil, "Two factor authentication is already enabled")
+			return
+		}
+
+		secret, err := util.GenerateTOTPSecret()
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		//starting again replaces any secret from an enrolment which was never confirmed
+		err = utft.Replace(db.Conn, &db.UserTwoFactor{
+			CreatedDateTime: time.Now().Unix(),
+			UserUUID:        loggedInUser.UUID,
+			Secret:          secret,
+		})
+
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		atfh.render(w, r, nil, "")
+	case "confirm":
+		if twoFactor == nil || twoFactor.Enabled {
+			atfh.render(w, r, nil, "")
+			return
+		}
+
+		step, ok := util.ValidateTOTP(twoFactor.Secret, r.PostFormValue("code"), time.Now())
+		if !ok {
+			atfh.render(w, r, nil, "Authentication code incorrect, check your device's clock and try again")
+			return
+		}
+
+		twoFactor.Enabled = true
+		twoFactor.LastUsedStep = step
+		if err := utft.Update(db.Conn, twoFactor); err != nil {
+			Error(w, err)
+			return
+		}
+
+		atfh.replaceRecoveryCodes(w, r, loggedInUser)
+	case "regenerate":
+		verified, err := verifyTwoFactorCode(loggedInUser, r.PostFormValue("code"))
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		if !verified {
+			atfh.render(w, r, nil, "Authentication code incorrect...")
+			return
+		}
+
+		atfh.replaceRecoveryCodes(w, r, loggedInUser)
+	case "disable":
+		ut := db.UsersTable{}
+		required, err := ut.TwoFactorRequired(db.Conn, loggedInUser)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		if required {
+			atfh.render(w, r, nil, "Two factor authentication is required for members of one of your groups")
+			return
+		}
+
+		verified, err := verifyTwoFactorCode(loggedInUser, r.PostFormValue("code"))
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		if !verified {
+			atfh.render(w, r, nil, "Authentication code incorrect...")
+			return
+		}
+
+		err = db.WithTransaction(db.Conn, func(tx *sql.Tx) error {
+			if _, err := utft.DeleteByUserUUID(tx, loggedInUser.UUID); err != nil {
+				return err
+			}
+
+			rct := db.RecoveryCodesTable{}
+			_, err := rct.DeleteByUserUUID(tx, loggedInUser.UUID)
+			return err
+		})
+
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		atfh.render(w, r, nil, "")
+	default:
+		http.Redirect(w, r, r.RequestURI, http.StatusFound)
+	}
+}
+
+func (atfh *AdminTwoFactorHandler) replaceRecoveryCodes(w http.ResponseWriter, r *http.Request, user *db.User) {
+	recoveryCodes, err := util.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	codeHashes := make([]string, 0, len(recoveryCodes))
+	for _, code := range recoveryCodes {
+		codeHashes = append(codeHashes, util.HashToken(util.NormaliseRecoveryCode(code)))
+	}
+
+	rct := db.RecoveryCodesTable{}
+	err = db.WithTransaction(db.Conn, func(tx *sql.Tx) error {
+		return rct.ReplaceForUser(tx, user.UUID, codeHashes)
+	})
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	//like API tokens, this is the only time the codes themselves are ever shown
+	atfh.render(w, r, recoveryCodes, "")
+}
+
+func (atfh *AdminTwoFactorHandler) render(w http.ResponseWriter, r *http.Request, recoveryCodes []string, errorMessage string) {
+	amw := AuthMiddleware{}
+	loggedInUser, err := amw.LoggedInUser(r)
+	if err != nil || loggedInUser == nil {
+		fourOhThree(w, r)
+		return
+	}
+
+	utft := db.UserTwoFactorTable{}
+	twoFactor, err := utft.SelectByUserUUID(db.Conn, loggedInUser.UUID)
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	ut := db.UsersTable{}
+	required, err := ut.TwoFactorRequired(db.Conn, loggedInUser)
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	rct := db.RecoveryCodesTable{}
+	remainingRecoveryCodes, err := rct.CountByUserUUID(db.Conn, loggedInUser.UUID)
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	pctx := plush.NewContext()
+	pctx.Set("title", "Two Factor Authentication")
+	pctx.Set("quillenabled", false)
+	pctx.Set("submitroute", atfh.route)
+	pctx.Set("twofactorenabled", twoFactor != nil && twoFactor.Enabled)
+	pctx.Set("twofactorpending", twoFactor != nil && !twoFactor.Enabled)
+	pctx.Set("twofactorrequired", required)
+	pctx.Set("secret", "")
+	pctx.Set("otpauthuri", "")
+	if twoFactor != nil && !twoFactor.Enabled {
+		pctx.Set("secret", twoFactor.Secret)
+		pctx.Set("otpauthuri", util.TOTPURI(twoFactorIssuer, loggedInUser.Username, twoFactor.Secret))
+	}
+	pctx.Set("recoverycodes", recoveryCodes)
+	pctx.Set("remainingrecoverycodes", remainingRecoveryCodes)
+	pctx.Set("errormessage", errorMessage)
+	pctx.Set("adminhiddenpassword", "")
+	if atfh.Router.AdminHidden {
+		pctx.Set("adminhiddenpassword", fmt.Sprintf("/%s", atfh.Router.AdminHiddenPassword))
+	}
+
+	RenderDefault(w, "admin.twofactor.html", pctx)
+}
+
+//Route get URI route for handler
+func (atfh *AdminTwoFactorHandler) Route() string { return atfh.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (atfh *AdminTwoFactorHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (atfh *AdminTwoFactorHandler) HandlesPost() bool { return true }
+
+//Permission get the permission a client needs to be granted to use handler
+func (atfh *AdminTwoFactorHandler) Permission() db.Permission { return db.PERM_NONE }
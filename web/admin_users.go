@@ -17,6 +17,7 @@ package web
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gobuffalo/plush"
 	"github.com/tacusci/berrycms/db"
@@ -33,21 +34,36 @@ func (uh *AdminUsersHandler) Get(w http.ResponseWriter, r *http.Request) {
 	users := make([]db.User, 0)
 
 	ut := db.UsersTable{}
-	rows, err := ut.Select(db.Conn, "createddatetime, uuid, firstname, lastname, username, email", "")
-	defer rows.Close()
-
+	rows, err := db.From(&ut).Columns("createddatetime", "uuid", "firstname", "lastname", "username", "email").Query(db.Conn)
 	if err != nil {
 		Error(w, err)
+		return
 	}
 
+	defer rows.Close()
+
 	for rows.Next() {
 		u := db.User{}
 		rows.Scan(&u.CreatedDateTime, &u.UUID, &u.FirstName, &u.LastName, &u.Username, &u.Email)
 		users = append(users, u)
 	}
 
+	alt := db.AccountLocksTable{}
+	activeLocks, err := alt.SelectActive(db.Conn, time.Now().Unix())
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	//keyed by user UUID, users without an entry aren't locked
+	lockedUntil := map[string]string{}
+	for _, lock := range activeLocks {
+		lockedUntil[lock.UserUUID] = UnixToTimeString(lock.LockedUntil)
+	}
+
 	pctx := plush.NewContext()
 	pctx.Set("users", users)
+	pctx.Set("lockeduntil", lockedUntil)
 	pctx.Set("title", "Users")
 	pctx.Set("quillenabled", false)
 	pctx.Set("adminhiddenpassword", "")
@@ -70,3 +86,6 @@ func (uh *AdminUsersHandler) HandlesGet() bool { return true }
 
 //HandlesPost retrieve whether this handler handles post requests
 func (uh *AdminUsersHandler) HandlesPost() bool { return false }
+
+//Permission get the permission a client needs to be granted to use handler
+func (uh *AdminUsersHandler) Permission() db.Permission { return db.PERM_USERS_VIEW }
@@ -15,6 +15,7 @@
 package web
 
 import (
+	"database/sql"
 	"fmt"
 	"net/http"
 
@@ -49,7 +50,6 @@ func (audh *AdminUsersDeleteHandler) Post(w http.ResponseWriter, r *http.Request
 	}
 
 	ut := db.UsersTable{}
-	st := db.AuthSessionsTable{}
 	pt := db.PagesTable{}
 	amw := AuthMiddleware{}
 
@@ -72,7 +72,7 @@ func (audh *AdminUsersDeleteHandler) Post(w http.ResponseWriter, r *http.Request
 			//make sure that the logged in user is not the same as user to delete
 			//the first condition evals before the second, that way no nil pointer exception occurs
 			if (loggedInUser != nil) && (loggedInUser.UUID != userToDelete.UUID) {
-				rows, err := pt.Select(db.Conn, "uuid", fmt.Sprintf("authoruuid = '%s'", userToDelete.UUID))
+				rows, err := db.From(&pt).Columns("uuid").Where(db.Equal("authoruuid", userToDelete.UUID)).Query(db.Conn)
 
 				if err != nil {
 					logging.Error(err.Error())
@@ -91,11 +91,11 @@ func (audh *AdminUsersDeleteHandler) Post(w http.ResponseWriter, r *http.Request
 
 				//make sure that the user to delete isn't the author of any pages (should probably do something different to this in future)
 				if rowCount == 0 {
-					st.Delete(db.Conn, fmt.Sprintf("uuid = '%s'", userToDelete.UUID))
-					ut.DeleteByUUID(db.Conn, userToDelete.UUID)
-					gmt := db.GroupMembershipTable{}
-					//will delete user from all groups, maybe this should be a different function?
-					gmt.DeleteUserFromGroup(db.Conn, userToDelete, &db.Group{UUID: "*"})
+					if err := db.WithTransaction(db.Conn, func(tx *sql.Tx) error {
+						return ut.DeleteWithDependents(tx, userToDelete)
+					}); err != nil {
+						logging.Error(err.Error())
+					}
 				}
 			}
 		}
@@ -110,3 +110,6 @@ func (audh *AdminUsersDeleteHandler) HandlesGet() bool { return false }
 
 //HandlesPost retrieve whether this handler handles post requests
 func (audh *AdminUsersDeleteHandler) HandlesPost() bool { return true }
+
+//Permission get the permission a client needs to be granted to use handler
+func (audh *AdminUsersDeleteHandler) Permission() db.Permission { return db.PERM_USERS_DELETE }
@@ -0,0 +1,177 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/plush"
+	"github.com/gorilla/mux"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/util"
+	"github.com/tacusci/logging"
+)
+
+//AdminUsersEditHandler lets admins change a user's details and set a new password for them
+type AdminUsersEditHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (aueh *AdminUsersEditHandler) Get(w http.ResponseWriter, r *http.Request) {
+	user := aueh.userFromRequest(r)
+	if user == nil {
+		fourOhFour(w, r)
+		return
+	}
+
+	if aueh.isLoggedInUser(r, user) {
+		http.Redirect(w, r, aueh.accountRoute(), http.StatusFound)
+		return
+	}
+
+	if !aueh.canEdit(user) {
+		fourOhThree(w, r)
+		return
+	}
+
+	aueh.render(w, r, user, "")
+}
+
+//Post handles post requests to URI
+func (aueh *AdminUsersEditHandler) Post(w http.ResponseWriter, r *http.Request) {
+	user := aueh.userFromRequest(r)
+	if user == nil {
+		fourOhFour(w, r)
+		return
+	}
+
+	if aueh.isLoggedInUser(r, user) {
+		http.Redirect(w, r, aueh.accountRoute(), http.StatusFound)
+		return
+	}
+
+	if !aueh.canEdit(user) {
+		fourOhThree(w, r)
+		return
+	}
+
+	amw := AuthMiddleware{}
+	loggedInUser, err := amw.LoggedInUser(r)
+	if err != nil || loggedInUser == nil {
+		fourOhThree(w, r)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		Error(w, err)
+		return
+	}
+
+	user.FirstName = r.PostFormValue("firstname")
+	user.LastName = r.PostFormValue("lastname")
+	user.Username = r.PostFormValue("username")
+	user.Email = r.PostFormValue("email")
+
+	if validated, err := validatePostForm(r); err != nil || !validated {
+		aueh.render(w, r, user, err.Error())
+		return
+	}
+
+	//the password is only changed if a new one was given
+	authHash := r.PostFormValue("authhash")
+
+	err = db.WithTransaction(db.Conn, func(tx *sql.Tx) error {
+		ut := db.UsersTable{}
+		if err := ut.Update(tx, user); err != nil {
+			return err
+		}
+
+		if len(authHash) == 0 {
+			return nil
+		}
+
+		return ut.ResetPassword(tx, user, util.HashAndSalt([]byte(authHash)), loggedInUser.UUID, time.Now().Unix())
+	})
+
+	if err != nil {
+		aueh.render(w, r, user, err.Error())
+		return
+	}
+
+	logging.Info(fmt.Sprintf("User %s edited the details of user %s", loggedInUser.Username, user.Username))
+	if len(authHash) > 0 {
+		logging.Info(fmt.Sprintf("User %s set a new password for user %s", loggedInUser.Username, user.Username))
+	}
+
+	http.Redirect(w, r, strings.TrimSuffix(aueh.route, "/edit/{uuid}"), http.StatusFound)
+}
+
+func (aueh *AdminUsersEditHandler) userFromRequest(r *http.Request) *db.User {
+	ut := db.UsersTable{}
+	user, err := ut.SelectByUUID(db.Conn, mux.Vars(r)["uuid"])
+	if err != nil || len(user.UUID) == 0 {
+		return nil
+	}
+	return user
+}
+
+//canEdit the root user's details can only be changed from their own account page, otherwise admins could take over the account
+func (aueh *AdminUsersEditHandler) canEdit(user *db.User) bool {
+	return db.UsersRoleFlag(user.UserroleId) != db.ROOT_USER
+}
+
+//isLoggedInUser users change their own details from the account page, which makes them give their current password
+func (aueh *AdminUsersEditHandler) isLoggedInUser(r *http.Request, user *db.User) bool {
+	amw := AuthMiddleware{}
+	loggedInUser, err := amw.LoggedInUser(r)
+	return err == nil && loggedInUser != nil && loggedInUser.UUID == user.UUID
+}
+
+func (aueh *AdminUsersEditHandler) accountRoute() string {
+	return strings.TrimSuffix(aueh.route, "/admin/users/edit/{uuid}") + "/account"
+}
+
+func (aueh *AdminUsersEditHandler) render(w http.ResponseWriter, r *http.Request, user *db.User, errorMessage string) {
+	pctx := plush.NewContext()
+	pctx.Set("title", fmt.Sprintf("Edit User - %s", user.Username))
+	pctx.Set("quillenabled", false)
+	pctx.Set("submitroute", r.URL.Path)
+	pctx.Set("user", user)
+	pctx.Set("errormessage", errorMessage)
+	pctx.Set("adminhiddenpassword", "")
+	if aueh.Router.AdminHidden {
+		pctx.Set("adminhiddenpassword", fmt.Sprintf("/%s", aueh.Router.AdminHiddenPassword))
+	}
+
+	RenderDefault(w, "admin.users.edit.html", pctx)
+}
+
+//Route get URI route for handler
+func (aueh *AdminUsersEditHandler) Route() string { return aueh.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (aueh *AdminUsersEditHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (aueh *AdminUsersEditHandler) HandlesPost() bool { return true }
+
+//Permission get the permission a client needs to be granted to use handler
+func (aueh *AdminUsersEditHandler) Permission() db.Permission { return db.PERM_USERS_EDIT }
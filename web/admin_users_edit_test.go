@@ -0,0 +1,143 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/tacusci/berrycms/db"
+)
+
+const handlerRouteEditUser string = "/admin/users/edit/{uuid}"
+
+//postEditUser submits the edit form for the user as the logged in user, with the user's details
+func postEditUser(t *testing.T, loggedInUser *db.User, user *db.User) *http.Response {
+	aueh := AdminUsersEditHandler{
+		Router: &MutableRouter{},
+		route:  handlerRouteEditUser,
+	}
+
+	formValues := url.Values{}
+	formValues.Set("firstname", user.FirstName)
+	formValues.Set("lastname", user.LastName)
+	formValues.Set("username", user.Username)
+	formValues.Set("email", user.Email)
+
+	req := userFormRequest(strings.Replace(handlerRouteEditUser, "{uuid}", user.UUID, 1), formValues)
+	req = mux.SetURLVars(logInAs(t, req, loggedInUser), map[string]string{"uuid": user.UUID})
+
+	responseRecorder := httptest.NewRecorder()
+	aueh.Post(responseRecorder, req)
+	return responseRecorder.Result()
+}
+
+func TestEditUsersPost(t *testing.T) {
+	adminUser := testUser(t, "editadminuser", db.MOD_USER)
+	user := testUser(t, "editeduser", db.REG_USER)
+	user.LastName = "Edited"
+
+	resp := postEditUser(t, adminUser, user)
+
+	if resp.StatusCode != http.StatusFound {
+		t.Errorf("Test edit user post didn't redirect request, STATUS CODE: %d", resp.StatusCode)
+	}
+
+	if location := resp.Header.Get("Location"); location != "/admin/users" {
+		t.Errorf("Test edit user post redirected to %s instead of the users page", location)
+	}
+
+	ut := db.UsersTable{}
+	if savedUser, err := ut.SelectByUUID(db.Conn, user.UUID); err != nil || savedUser.LastName != "Edited" {
+		t.Errorf("Test edit user post didn't save the user's details")
+	}
+}
+
+func TestEditUsersPostDuplicateDetails(t *testing.T) {
+	useResourcesDir(t)
+	adminUser := testUser(t, "editadminuser", db.MOD_USER)
+	otherUser := testUser(t, "editotheruser", db.REG_USER)
+
+	user := testUser(t, "editduplicateuser", db.REG_USER)
+	user.Username = otherUser.Username
+
+	resp := postEditUser(t, adminUser, user)
+
+	if body := responseBody(t, resp); !strings.Contains(body, "Username "+otherUser.Username+" is already taken") {
+		t.Errorf("Test edit user post with a duplicate username didn't say why it was rejected")
+	}
+
+	user = testUser(t, "editduplicateuser", db.REG_USER)
+	user.Email = otherUser.Email
+
+	resp = postEditUser(t, adminUser, user)
+
+	if body := responseBody(t, resp); !strings.Contains(body, "Email address "+otherUser.Email+" is already in use") {
+		t.Errorf("Test edit user post with a duplicate email didn't say why it was rejected")
+	}
+}
+
+func TestEditUsersPostSelf(t *testing.T) {
+	adminUser := testUser(t, "editadminuser", db.MOD_USER)
+	originalLastName := adminUser.LastName
+	adminUser.LastName = "Edited"
+
+	resp := postEditUser(t, adminUser, adminUser)
+
+	if resp.StatusCode != http.StatusFound {
+		t.Errorf("Test edit user post of themselves didn't redirect request, STATUS CODE: %d", resp.StatusCode)
+	}
+
+	if location := resp.Header.Get("Location"); location != handlerRouteAccount {
+		t.Errorf("Test edit user post of themselves redirected to %s instead of the account page", location)
+	}
+
+	ut := db.UsersTable{}
+	if savedUser, err := ut.SelectByUUID(db.Conn, adminUser.UUID); err != nil || savedUser.LastName != originalLastName {
+		t.Errorf("Test edit user post of themselves saved their details without their current password")
+	}
+}
+
+func TestEditUsersPostRootUser(t *testing.T) {
+	useResourcesDir(t)
+	adminUser := testUser(t, "editadminuser", db.MOD_USER)
+
+	ut := db.UsersTable{}
+	rootUser, err := ut.SelectRootUser(db.Conn)
+	if err != nil {
+		t.Fatalf("Error loading root user: %v", err)
+	}
+
+	if len(rootUser.UUID) == 0 {
+		rootUser = testUser(t, "editrootuser", db.ROOT_USER)
+	}
+
+	originalLastName := rootUser.LastName
+	rootUser.LastName = "Edited"
+
+	resp := postEditUser(t, adminUser, rootUser)
+
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Test edit user post of the root user wasn't forbidden, STATUS CODE: %d", resp.StatusCode)
+	}
+
+	if savedUser, err := ut.SelectByUUID(db.Conn, rootUser.UUID); err != nil || savedUser.LastName != originalLastName {
+		t.Errorf("Test edit user post of the root user saved their details")
+	}
+}
@@ -33,7 +33,7 @@ func (ugh *AdminUserGroupsHandler) Get(w http.ResponseWriter, r *http.Request) {
 	groups := []db.Group{}
 
 	groupTable := db.GroupTable{}
-	rows, err := groupTable.Select(db.Conn, "createddatetime, uuid, title", "")
+	rows, err := db.From(&groupTable).Columns("createddatetime", "uuid", "title").Query(db.Conn)
 
 	if err != nil {
 		Error(w, err)
@@ -75,3 +75,5 @@ func (ugh *AdminUserGroupsHandler) Route() string { return ugh.route }
 func (ugh *AdminUserGroupsHandler) HandlesGet() bool { return true }
 
 func (ugh *AdminUserGroupsHandler) HandlesPost() bool { return false }
+
+func (ugh *AdminUserGroupsHandler) Permission() db.Permission { return db.PERM_GROUPS_MANAGE }
@@ -1,6 +1,7 @@
 package web
 
 import (
+	"database/sql"
 	"fmt"
 	"net/http"
 
@@ -53,7 +54,13 @@ func (augdh *AdminUserGroupsDeleteHandler) Post(w http.ResponseWriter, r *http.R
 
 		if groupToDelete.Title != "Admins" && groupToDelete.Title != "Moderators" && groupToDelete.Title != "Users" {
 			if loggedInUser != nil {
-				gt.DeleteByUUID(db.Conn, groupToDelete.UUID)
+				//the group's memberships and permissions go with it, or not at all
+				if err := db.WithTransaction(db.Conn, func(tx *sql.Tx) error {
+					_, err := gt.DeleteByUUID(tx, groupToDelete.UUID)
+					return err
+				}); err != nil {
+					logging.Error(err.Error())
+				}
 			}
 		}
 	}
@@ -67,3 +74,6 @@ func (augdh *AdminUserGroupsDeleteHandler) HandlesGet() bool { return false }
 
 //HandlesPost retrieve whether this handler handles post requests
 func (augdh *AdminUserGroupsDeleteHandler) HandlesPost() bool { return true }
+
+//Permission get the permission a client needs to be granted to use handler
+func (augdh *AdminUserGroupsDeleteHandler) Permission() db.Permission { return db.PERM_GROUPS_MANAGE }
@@ -35,7 +35,7 @@ func (augeh *AdminUserGroupsEditHandler) Get(w http.ResponseWriter, r *http.Requ
 	gmt := db.GroupMembershipTable{}
 
 	//retrieve every membership for this group
-	groupMembershipRows, err := gmt.Select(db.Conn, "createddatetime, groupuuid, useruuid", fmt.Sprintf("groupuuid = '%s'", vars["uuid"]))
+	groupMembershipRows, err := db.From(&gmt).Columns("createddatetime", "groupuuid", "useruuid").Where(db.Equal("groupuuid", vars["uuid"])).Query(db.Conn)
 	if err != nil {
 		Error(w, errors.New("Group memberships not found"))
 		return
@@ -67,7 +67,7 @@ func (augeh *AdminUserGroupsEditHandler) Get(w http.ResponseWriter, r *http.Requ
 
 	//retrieve list of all existing users
 	ut := db.UsersTable{}
-	userRows, err := ut.Select(db.Conn, "*", "")
+	userRows, err := db.From(&ut).Query(db.Conn)
 	if err != nil {
 		Error(w, err)
 		return
@@ -101,23 +101,33 @@ func (augeh *AdminUserGroupsEditHandler) Get(w http.ResponseWriter, r *http.Requ
 	userRows.Close()
 
 	gt := db.GroupTable{}
-	groupRows, err := gt.Select(db.Conn, "title", fmt.Sprintf("uuid = '%s'", vars["uuid"]))
+	groupRows, err := db.From(&gt).Columns("title", "requiretwofactor").Where(db.Equal("uuid", vars["uuid"])).Query(db.Conn)
 	if err != nil {
 		Error(w, err)
 		return
 	}
 
 	var groupTitle string
+	var requireTwoFactor bool
 	if groupRows.Next() {
-		groupRows.Scan(&groupTitle)
+		groupRows.Scan(&groupTitle, &requireTwoFactor)
 	}
 
 	groupRows.Close()
 
+	//only root users can make two factor authentication mandatory
+	isRoot := false
+	amw := AuthMiddleware{}
+	if loggedInUser, err := amw.LoggedInUser(r); err == nil && loggedInUser != nil {
+		isRoot = db.UsersRoleFlag(loggedInUser.UserroleId) == db.ROOT_USER
+	}
+
 	pctx := plush.NewContext()
 	pctx.Set("title", "Edit Group")
 	pctx.Set("submitroute", r.RequestURI)
 	pctx.Set("grouptitle", groupTitle)
+	pctx.Set("requiretwofactor", requireTwoFactor)
+	pctx.Set("isroot", isRoot)
 	pctx.Set("groupuuid", vars["uuid"])
 	pctx.Set("usersInGroup", usersInGroup)
 	pctx.Set("usersNotInGroup", usersNotInGroup)
@@ -149,3 +159,6 @@ func (augeh *AdminUserGroupsEditHandler) HandlesGet() bool { return true }
 
 //HandlesPost retrieve whether this handler handles post requests
 func (augeh *AdminUserGroupsEditHandler) HandlesPost() bool { return true }
+
+//Permission get the permission a client needs to be granted to use handler
+func (augeh *AdminUserGroupsEditHandler) Permission() db.Permission { return db.PERM_GROUPS_MANAGE }
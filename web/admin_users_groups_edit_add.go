@@ -69,7 +69,7 @@ func (augeah *AdminUserGroupsEditAddHandler) Post(w http.ResponseWriter, r *http
 	if loggedInUser != nil {
 
 		groupTitle := ""
-		rows, err := gt.Select(db.Conn, "title", fmt.Sprintf("uuid = '%s'", groupUUID))
+		rows, err := db.From(&gt).Columns("title").Where(db.Equal("uuid", groupUUID)).Query(db.Conn)
 		if err != nil {
 			Error(w, err)
 			return
@@ -105,3 +105,6 @@ func (augeah *AdminUserGroupsEditAddHandler) HandlesGet() bool { return false }
 
 //HandlesPost retrieve whether this handler handles post requests
 func (augeah *AdminUserGroupsEditAddHandler) HandlesPost() bool { return true }
+
+//Permission get the permission a client needs to be granted to use handler
+func (augeah *AdminUserGroupsEditAddHandler) Permission() db.Permission { return db.PERM_GROUPS_MANAGE }
@@ -0,0 +1,134 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/gobuffalo/plush"
+	"github.com/gorilla/mux"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/logging"
+)
+
+//AdminUserGroupsEditPermissionsHandler sets which permissions members of a group are granted
+type AdminUserGroupsEditPermissionsHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//groupPermissionGrant pairs a permission with whether the group has it for rendering
+type groupPermissionGrant struct {
+	Permission db.Permission
+	Granted    bool
+}
+
+//Get handles get requests to URI
+func (augeph *AdminUserGroupsEditPermissionsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	gt := db.GroupTable{}
+	group, err := gt.SelectByUUID(db.Conn, vars["uuid"])
+	if err != nil || len(group.UUID) == 0 {
+		fourOhFour(w, r)
+		return
+	}
+
+	gpt := db.GroupPermissionsTable{}
+	permissions, err := gpt.SelectByGroupUUID(db.Conn, group.UUID)
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	grants := make([]groupPermissionGrant, 0, len(db.AllPermissions))
+	for _, permission := range db.AllPermissions {
+		grant := groupPermissionGrant{Permission: permission}
+		for _, p := range permissions {
+			if p == permission {
+				grant.Granted = true
+				break
+			}
+		}
+		grants = append(grants, grant)
+	}
+
+	pctx := plush.NewContext()
+	pctx.Set("title", fmt.Sprintf("Permissions - %s", group.Title))
+	pctx.Set("quillenabled", false)
+	pctx.Set("submitroute", r.RequestURI)
+	pctx.Set("grouptitle", group.Title)
+	pctx.Set("groupuuid", group.UUID)
+	pctx.Set("grants", grants)
+	pctx.Set("adminhiddenpassword", "")
+	if augeph.Router.AdminHidden {
+		pctx.Set("adminhiddenpassword", fmt.Sprintf("/%s", augeph.Router.AdminHiddenPassword))
+	}
+
+	RenderDefault(w, "admin.users.groups.edit.permissions.html", pctx)
+}
+
+//Post handles post requests to URI
+func (augeph *AdminUserGroupsEditPermissionsHandler) Post(w http.ResponseWriter, r *http.Request) {
+	defer http.Redirect(w, r, r.RequestURI, http.StatusFound)
+	vars := mux.Vars(r)
+
+	err := r.ParseForm()
+
+	if err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	gt := db.GroupTable{}
+	group, err := gt.SelectByUUID(db.Conn, vars["uuid"])
+	if err != nil || len(group.UUID) == 0 {
+		logging.Error(fmt.Sprintf("Group %s doesn't exist, stopping...", vars["uuid"]))
+		return
+	}
+
+	permissions := []db.Permission{}
+	for key := range r.PostForm {
+		permission, err := db.ParsePermission(key)
+		if err != nil {
+			logging.Error(err.Error())
+			return
+		}
+		permissions = append(permissions, permission)
+	}
+
+	gpt := db.GroupPermissionsTable{}
+	err = db.WithTransaction(db.Conn, func(tx *sql.Tx) error {
+		return gpt.ReplaceForGroup(tx, group.UUID, permissions)
+	})
+	if err != nil {
+		logging.Error(err.Error())
+	}
+}
+
+//Route get URI route for handler
+func (augeph *AdminUserGroupsEditPermissionsHandler) Route() string { return augeph.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (augeph *AdminUserGroupsEditPermissionsHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (augeph *AdminUserGroupsEditPermissionsHandler) HandlesPost() bool { return true }
+
+//Permission get the permission a client needs to be granted to use handler
+func (augeph *AdminUserGroupsEditPermissionsHandler) Permission() db.Permission {
+	return db.PERM_GROUPS_MANAGE
+}
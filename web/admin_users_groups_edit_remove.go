@@ -68,7 +68,7 @@ func (augerh *AdminUserGroupsEditRemoveHandler) Post(w http.ResponseWriter, r *h
 
 	if loggedInUser != nil {
 
-		rows, err := gt.Select(db.Conn, "uuid, title", fmt.Sprintf("uuid = '%s'", groupUUID))
+		rows, err := db.From(&gt).Columns("uuid", "title").Where(db.Equal("uuid", groupUUID)).Query(db.Conn)
 		if err != nil {
 			Error(w, err)
 			return
@@ -117,3 +117,8 @@ func (augerh *AdminUserGroupsEditRemoveHandler) HandlesGet() bool { return false
 
 //HandlesPost retrieve whether this handler handles post requests
 func (augerh *AdminUserGroupsEditRemoveHandler) HandlesPost() bool { return true }
+
+//Permission get the permission a client needs to be granted to use handler
+func (augerh *AdminUserGroupsEditRemoveHandler) Permission() db.Permission {
+	return db.PERM_GROUPS_MANAGE
+}
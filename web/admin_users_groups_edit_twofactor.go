@@ -0,0 +1,82 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/logging"
+)
+
+//AdminUserGroupsEditTwoFactorHandler lets root users make two factor authentication mandatory for members of a group
+type AdminUserGroupsEditTwoFactorHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (augetfh *AdminUserGroupsEditTwoFactorHandler) Get(w http.ResponseWriter, r *http.Request) {}
+
+//Post handles post requests to URI
+func (augetfh *AdminUserGroupsEditTwoFactorHandler) Post(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	amw := AuthMiddleware{}
+	loggedInUser, err := amw.LoggedInUser(r)
+	if err != nil || loggedInUser == nil || db.UsersRoleFlag(loggedInUser.UserroleId) != db.ROOT_USER {
+		fourOhThree(w, r)
+		return
+	}
+
+	groupEditRoute := fmt.Sprintf("/admin/users/groups/edit/%s", vars["uuid"])
+	if augetfh.Router.AdminHidden {
+		groupEditRoute = fmt.Sprintf("/%s", augetfh.Router.AdminHiddenPassword) + groupEditRoute
+	}
+	defer http.Redirect(w, r, groupEditRoute, http.StatusFound)
+
+	if err := r.ParseForm(); err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	gt := db.GroupTable{}
+	group, err := gt.SelectByUUID(db.Conn, vars["uuid"])
+	if err != nil || len(group.UUID) == 0 {
+		logging.Error(fmt.Sprintf("Group %s doesn't exist, stopping...", vars["uuid"]))
+		return
+	}
+
+	group.RequireTwoFactor = r.PostFormValue("requiretwofactor") == "on"
+	if err := gt.Update(db.Conn, group); err != nil {
+		logging.Error(err.Error())
+	}
+}
+
+//Route get URI route for handler
+func (augetfh *AdminUserGroupsEditTwoFactorHandler) Route() string { return augetfh.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (augetfh *AdminUserGroupsEditTwoFactorHandler) HandlesGet() bool { return false }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (augetfh *AdminUserGroupsEditTwoFactorHandler) HandlesPost() bool { return true }
+
+//Permission get the permission a client needs to be granted to use handler
+func (augetfh *AdminUserGroupsEditTwoFactorHandler) Permission() db.Permission {
+	return db.PERM_GROUPS_MANAGE
+}
@@ -78,3 +78,6 @@ func (augnh *AdminUserGroupsNewHandler) HandlesGet() bool { return false }
 
 //HandlesPost retrieve whether this handler handles post requests
 func (augnh *AdminUserGroupsNewHandler) HandlesPost() bool { return true }
+
+//Permission get the permission a client needs to be granted to use handler
+func (augnh *AdminUserGroupsNewHandler) Permission() db.Permission { return db.PERM_GROUPS_MANAGE }
@@ -15,6 +15,7 @@
 package web
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"net/http"
@@ -119,21 +120,30 @@ func (aunh *AdminUsersNewHandler) Post(w http.ResponseWriter, r *http.Request) {
 			AuthHash:        util.HashAndSalt([]byte(authHash)),
 		}
 
-		if err := ut.Insert(db.Conn, userToCreate); err != nil {
-			Error(w, err)
-		}
+		//the root user is only usable once it's in the admins group, so both have to succeed together
+		err := db.WithTransaction(db.Conn, func(tx *sql.Tx) error {
+			if err := ut.Insert(tx, userToCreate); err != nil {
+				return err
+			}
 
-		if postRequestForNewRootUser {
-			logging.Debug("Root user POST form recieved")
-			rootUser, err := ut.SelectRootUser(db.Conn)
+			if postRequestForNewRootUser {
+				logging.Debug("Root user POST form recieved")
+				rootUser, err := ut.SelectRootUser(tx)
 
-			if err != nil {
-				logging.Error("Unable to retrieve root user")
-				Error(w, err)
+				if err != nil {
+					logging.Error("Unable to retrieve root user")
+					return err
+				}
+
+				gmt := db.GroupMembershipTable{}
+				return gmt.AddUserToGroup(tx, rootUser, "Admins")
 			}
 
-			gmt := db.GroupMembershipTable{}
-			gmt.AddUserToGroup(db.Conn, rootUser, "Admins")
+			return nil
+		})
+
+		if err != nil {
+			Error(w, err)
 		}
 	} else {
 		//need to add setting error message on screen
@@ -149,6 +159,9 @@ func (aunh *AdminUsersNewHandler) HandlesGet() bool { return true }
 //HandlesPost retrieve whether this handler handles post requests
 func (aunh *AdminUsersNewHandler) HandlesPost() bool { return true }
 
+//Permission get the permission a client needs to be granted to use handler
+func (aunh *AdminUsersNewHandler) Permission() db.Permission { return db.PERM_USERS_CREATE }
+
 // validate makes sure that the passwords match and that the username and email are in correct format
 func validatePostForm(r *http.Request) (bool, error) {
 	authHash := r.PostFormValue("authhash")
@@ -158,22 +171,26 @@ func validatePostForm(r *http.Request) (bool, error) {
 		return false, errors.New("Password and repeated passwords don't match")
 	}
 
-	firstname := r.PostFormValue("firstname")
-	lastname := r.PostFormValue("lastname")
-	email := r.PostFormValue("email")
-	username := r.PostFormValue("username")
+	if err := validateUserDetails(r.PostFormValue("firstname"), r.PostFormValue("lastname"), r.PostFormValue("email"), r.PostFormValue("username")); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
 
+//validateUserDetails makes sure that none of the details are blank and that the username and email are in correct format
+func validateUserDetails(firstname string, lastname string, email string, username string) error {
 	if len(firstname) <= 0 || len(lastname) <= 0 || len(email) <= 0 || len(username) <= 0 {
-		return false, errors.New("One of required fields is blank")
+		return errors.New("One of required fields is blank")
 	}
 
 	if match, err := regexp.MatchString(usernameRegex, username); err != nil || match == false {
-		return false, errors.New("Username does not match pattern regex")
+		return errors.New("Username does not match pattern regex")
 	}
 
 	if match, err := regexp.MatchString(emailRegex, email); err != nil || match == false {
-		return false, errors.New("Email does not match pattern regex")
+		return errors.New("Email does not match pattern regex")
 	}
 
-	return true, nil
+	return nil
 }
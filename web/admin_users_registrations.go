@@ -0,0 +1,68 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gobuffalo/plush"
+	"github.com/tacusci/berrycms/db"
+)
+
+//AdminUsersRegistrationsHandler lists the verified registrations waiting to be approved or rejected
+type AdminUsersRegistrationsHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (aurh *AdminUsersRegistrationsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	rt := db.RegistrationsTable{}
+	registrations, err := rt.SelectVerified(db.Conn)
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	pctx := plush.NewContext()
+	pctx.Set("registrations", registrations)
+	pctx.Set("defaultgroup", CurrentSettings().DefaultGroup)
+	pctx.Set("registrationopen", CurrentSettings().RegistrationOpen)
+	pctx.Set("title", "Registrations")
+	pctx.Set("quillenabled", false)
+	pctx.Set("adminhiddenpassword", "")
+	if aurh.Router.AdminHidden {
+		pctx.Set("adminhiddenpassword", fmt.Sprintf("/%s", aurh.Router.AdminHiddenPassword))
+	}
+	pctx.Set("unixtostring", UnixToTimeString)
+
+	RenderDefault(w, "admin.users.registrations.html", pctx)
+}
+
+//Post handles post requests to URI
+func (aurh *AdminUsersRegistrationsHandler) Post(w http.ResponseWriter, r *http.Request) {}
+
+//Route get URI route for handler
+func (aurh *AdminUsersRegistrationsHandler) Route() string { return aurh.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (aurh *AdminUsersRegistrationsHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (aurh *AdminUsersRegistrationsHandler) HandlesPost() bool { return false }
+
+//Permission get the permission a client needs to be granted to use handler
+func (aurh *AdminUsersRegistrationsHandler) Permission() db.Permission { return db.PERM_USERS_CREATE }
@@ -0,0 +1,125 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/mail"
+	"github.com/tacusci/logging"
+)
+
+//AdminUsersRegistrationsApproveHandler turns a verified registration into a user in the default group
+type AdminUsersRegistrationsApproveHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (aurah *AdminUsersRegistrationsApproveHandler) Get(w http.ResponseWriter, r *http.Request) {}
+
+//Post handles post requests to URI
+func (aurah *AdminUsersRegistrationsApproveHandler) Post(w http.ResponseWriter, r *http.Request) {
+	var redirectURI = "/admin/users/registrations"
+
+	if aurah.Router.AdminHidden {
+		redirectURI = fmt.Sprintf("/%s", aurah.Router.AdminHiddenPassword) + redirectURI
+	}
+
+	defer http.Redirect(w, r, redirectURI, http.StatusFound)
+
+	amw := AuthMiddleware{}
+	loggedInUser, err := amw.LoggedInUser(r)
+	if err != nil || loggedInUser == nil {
+		logging.Error("Unable to find logged in user to approve registration as, stopping...")
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	registrationID, err := strconv.Atoi(r.PostFormValue("registrationid"))
+	if err != nil {
+		logging.Error(fmt.Sprintf("Registration ID %s is invalid, stopping...", r.PostFormValue("registrationid")))
+		return
+	}
+
+	rt := db.RegistrationsTable{}
+	reg, err := rt.SelectByID(db.Conn, registrationID)
+	if err != nil || reg.Registrationid == 0 {
+		logging.Error(fmt.Sprintf("Registration %d doesn't exist, stopping...", registrationID))
+		return
+	}
+
+	var approvedUser *db.User
+	//the user shouldn't exist without their group membership, nor the registration linger once they do
+	err = db.WithTransaction(db.Conn, func(tx *sql.Tx) error {
+		approvedUser, err = rt.Approve(tx, reg, CurrentSettings().DefaultGroup, time.Now().Unix())
+		return err
+	})
+	if err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	logging.Info(fmt.Sprintf("User %s approved the registration of user %s", loggedInUser.Username, approvedUser.Username))
+
+	if !mail.Enabled() {
+		return
+	}
+
+	linkBase, err := emailLinkBase()
+	if err != nil {
+		logging.Error(fmt.Sprintf("Not emailing %s that they've been approved -> %s", approvedUser.Username, err.Error()))
+		return
+	}
+
+	var loginURI = "/login"
+
+	if aurah.Router.AdminHidden {
+		loginURI = fmt.Sprintf("/%s", aurah.Router.AdminHiddenPassword) + loginURI
+	}
+
+	err = mail.Send(mail.Message{
+		To:      approvedUser.Email,
+		Subject: fmt.Sprintf("Your %s account has been approved", CurrentSettings().SiteTitle),
+		Body: fmt.Sprintf("Hi %s,\n\nYour account %s has been approved, you can now login at:\n\n%s%s\n",
+			approvedUser.FirstName, approvedUser.Username, linkBase, loginURI),
+	})
+	if err != nil {
+		logging.Error(err.Error())
+	}
+}
+
+//Route get URI route for handler
+func (aurah *AdminUsersRegistrationsApproveHandler) Route() string { return aurah.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (aurah *AdminUsersRegistrationsApproveHandler) HandlesGet() bool { return false }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (aurah *AdminUsersRegistrationsApproveHandler) HandlesPost() bool { return true }
+
+//Permission get the permission a client needs to be granted to use handler
+func (aurah *AdminUsersRegistrationsApproveHandler) Permission() db.Permission {
+	return db.PERM_USERS_CREATE
+}
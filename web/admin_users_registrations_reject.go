@@ -0,0 +1,90 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/logging"
+)
+
+//AdminUsersRegistrationsRejectHandler removes a registration without creating its user
+type AdminUsersRegistrationsRejectHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (aurrh *AdminUsersRegistrationsRejectHandler) Get(w http.ResponseWriter, r *http.Request) {}
+
+//Post handles post requests to URI
+func (aurrh *AdminUsersRegistrationsRejectHandler) Post(w http.ResponseWriter, r *http.Request) {
+	var redirectURI = "/admin/users/registrations"
+
+	if aurrh.Router.AdminHidden {
+		redirectURI = fmt.Sprintf("/%s", aurrh.Router.AdminHiddenPassword) + redirectURI
+	}
+
+	defer http.Redirect(w, r, redirectURI, http.StatusFound)
+
+	amw := AuthMiddleware{}
+	loggedInUser, err := amw.LoggedInUser(r)
+	if err != nil || loggedInUser == nil {
+		logging.Error("Unable to find logged in user to reject registration as, stopping...")
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	registrationID, err := strconv.Atoi(r.PostFormValue("registrationid"))
+	if err != nil {
+		logging.Error(fmt.Sprintf("Registration ID %s is invalid, stopping...", r.PostFormValue("registrationid")))
+		return
+	}
+
+	rt := db.RegistrationsTable{}
+	reg, err := rt.SelectByID(db.Conn, registrationID)
+	if err != nil || reg.Registrationid == 0 {
+		logging.Error(fmt.Sprintf("Registration %d doesn't exist, stopping...", registrationID))
+		return
+	}
+
+	if _, err := rt.DeleteByID(db.Conn, reg.Registrationid); err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	logging.Info(fmt.Sprintf("User %s rejected the registration of %s", loggedInUser.Username, reg.Username))
+}
+
+//Route get URI route for handler
+func (aurrh *AdminUsersRegistrationsRejectHandler) Route() string { return aurrh.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (aurrh *AdminUsersRegistrationsRejectHandler) HandlesGet() bool { return false }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (aurrh *AdminUsersRegistrationsRejectHandler) HandlesPost() bool { return true }
+
+//Permission get the permission a client needs to be granted to use handler
+func (aurrh *AdminUsersRegistrationsRejectHandler) Permission() db.Permission {
+	return db.PERM_USERS_CREATE
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/tacusci/berrycms/db"
+)
+
+//AdminUsersSessionsHandler lists another user's sessions and lets them be revoked
+type AdminUsersSessionsHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (aush *AdminUsersSessionsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	user := aush.userFromRequest(r)
+	if user == nil {
+		fourOhFour(w, r)
+		return
+	}
+
+	renderSessions(w, r, aush.Router, user, fmt.Sprintf("Sessions - %s", user.Username))
+}
+
+//Post handles post requests to URI
+func (aush *AdminUsersSessionsHandler) Post(w http.ResponseWriter, r *http.Request) {
+	user := aush.userFromRequest(r)
+	if user == nil {
+		fourOhFour(w, r)
+		return
+	}
+
+	revokeSessions(w, r, user)
+	http.Redirect(w, r, r.RequestURI, http.StatusFound)
+}
+
+func (aush *AdminUsersSessionsHandler) userFromRequest(r *http.Request) *db.User {
+	ut := db.UsersTable{}
+	user, err := ut.SelectByUUID(db.Conn, mux.Vars(r)["uuid"])
+	if err != nil || len(user.UUID) == 0 {
+		return nil
+	}
+	return user
+}
+
+//Route get URI route for handler
+func (aush *AdminUsersSessionsHandler) Route() string { return aush.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (aush *AdminUsersSessionsHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (aush *AdminUsersSessionsHandler) HandlesPost() bool { return true }
+
+//Permission get the permission a client needs to be granted to use handler, seeing where users log in from and logging them out
+//is part of looking after their account
+func (aush *AdminUsersSessionsHandler) Permission() db.Permission { return db.PERM_USERS_EDIT }
@@ -0,0 +1,91 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/logging"
+)
+
+//AdminUsersUnlockHandler clears the lock on a user's account before it runs out
+type AdminUsersUnlockHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (auuh *AdminUsersUnlockHandler) Get(w http.ResponseWriter, r *http.Request) {}
+
+//Post handles post requests to URI
+func (auuh *AdminUsersUnlockHandler) Post(w http.ResponseWriter, r *http.Request) {
+	var redirectURI = "/admin/users"
+
+	if auuh.Router.AdminHidden {
+		redirectURI = fmt.Sprintf("/%s", auuh.Router.AdminHiddenPassword) + redirectURI
+	}
+
+	defer http.Redirect(w, r, redirectURI, http.StatusFound)
+
+	amw := AuthMiddleware{}
+	loggedInUser, err := amw.LoggedInUser(r)
+	if err != nil || loggedInUser == nil {
+		logging.Error("Unable to find logged in user to clear account lock as, stopping...")
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	ut := db.UsersTable{}
+	userToUnlock, err := ut.SelectByUUID(db.Conn, r.PostFormValue("useruuid"))
+	if err != nil || len(userToUnlock.UUID) == 0 {
+		logging.Error(fmt.Sprintf("User %s doesn't exist, stopping...", r.PostFormValue("useruuid")))
+		return
+	}
+
+	alt := db.AccountLocksTable{}
+	cleared, err := alt.Clear(db.Conn, userToUnlock.UUID, loggedInUser.UUID, time.Now().Unix())
+	if err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	if cleared > 0 {
+		logging.Info(fmt.Sprintf("User %s cleared the account lock of user %s", loggedInUser.Username, userToUnlock.Username))
+	}
+
+	//otherwise the backoff from the attempts that caused the lock would still apply
+	if err := recordSuccessfulLogin(userToUnlock.Username); err != nil {
+		logging.Error(err.Error())
+	}
+}
+
+//Route get URI route for handler
+func (auuh *AdminUsersUnlockHandler) Route() string { return auuh.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (auuh *AdminUsersUnlockHandler) HandlesGet() bool { return false }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (auuh *AdminUsersUnlockHandler) HandlesPost() bool { return true }
+
+//Permission get the permission a client needs to be granted to use handler, clearing a lock is part of looking after the account
+func (auuh *AdminUsersUnlockHandler) Permission() db.Permission { return db.PERM_USERS_EDIT }
@@ -0,0 +1,123 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/logging"
+)
+
+const apiV1Prefix = "/api/v1"
+
+//maxAPIRequestBodySize largest JSON request body the API will read, page content is the only thing which should get near this
+const maxAPIRequestBodySize = 4 << 20
+
+//APIEndpoint a single method of a JSON API route along with the permission a client needs to use it
+type APIEndpoint struct {
+	Route      string
+	Method     string
+	Permission db.Permission
+	Handle     http.HandlerFunc
+}
+
+//GetAPIEndpoints get fixed list of all versioned JSON API endpoints
+func GetAPIEndpoints(router *MutableRouter) []APIEndpoint {
+	pages := &APIPagesHandler{Router: router}
+	users := &APIUsersHandler{Router: router}
+	groups := &APIGroupsHandler{Router: router}
+
+	return []APIEndpoint{
+		{Route: apiV1Prefix + "/pages", Method: "GET", Permission: db.PERM_PAGES_VIEW, Handle: pages.List},
+		{Route: apiV1Prefix + "/pages", Method: "POST", Permission: db.PERM_PAGES_CREATE, Handle: pages.Create},
+		{Route: apiV1Prefix + "/pages/{uuid}", Method: "GET", Permission: db.PERM_PAGES_VIEW, Handle: pages.Get},
+		{Route: apiV1Prefix + "/pages/{uuid}", Method: "PUT", Permission: db.PERM_PAGES_EDIT, Handle: pages.Update},
+		{Route: apiV1Prefix + "/pages/{uuid}", Method: "DELETE", Permission: db.PERM_PAGES_DELETE, Handle: pages.Delete},
+
+		{Route: apiV1Prefix + "/users", Method: "GET", Permission: db.PERM_USERS_VIEW, Handle: users.List},
+		{Route: apiV1Prefix + "/users", Method: "POST", Permission: db.PERM_USERS_CREATE, Handle: users.Create},
+		{Route: apiV1Prefix + "/users/{uuid}", Method: "GET", Permission: db.PERM_USERS_VIEW, Handle: users.Get},
+		{Route: apiV1Prefix + "/users/{uuid}", Method: "DELETE", Permission: db.PERM_USERS_DELETE, Handle: users.Delete},
+
+		{Route: apiV1Prefix + "/groups", Method: "GET", Permission: db.PERM_GROUPS_MANAGE, Handle: groups.List},
+		{Route: apiV1Prefix + "/groups", Method: "POST", Permission: db.PERM_GROUPS_MANAGE, Handle: groups.Create},
+		{Route: apiV1Prefix + "/groups/{uuid}", Method: "GET", Permission: db.PERM_GROUPS_MANAGE, Handle: groups.Get},
+		{Route: apiV1Prefix + "/groups/{uuid}", Method: "PUT", Permission: db.PERM_GROUPS_MANAGE, Handle: groups.Update},
+		{Route: apiV1Prefix + "/groups/{uuid}", Method: "DELETE", Permission: db.PERM_GROUPS_MANAGE, Handle: groups.Delete},
+		{Route: apiV1Prefix + "/groups/{uuid}/members", Method: "GET", Permission: db.PERM_GROUPS_MANAGE, Handle: groups.ListMembers},
+		{Route: apiV1Prefix + "/groups/{uuid}/members", Method: "POST", Permission: db.PERM_GROUPS_MANAGE, Handle: groups.AddMember},
+		{Route: apiV1Prefix + "/groups/{uuid}/members/{useruuid}", Method: "DELETE", Permission: db.PERM_GROUPS_MANAGE, Handle: groups.RemoveMember},
+	}
+}
+
+//requireAPIPermission wraps API handler function so that only clients granted the permission get through to it
+func (mr *MutableRouter) requireAPIPermission(permission db.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		amw := AuthMiddleware{Router: mr}
+		if !amw.IsLoggedIn(r) {
+			writeAPIError(w, http.StatusUnauthorized, "Not logged in")
+			return
+		}
+		if !amw.HasPermission(r, permission) {
+			writeAPIError(w, http.StatusForbidden, fmt.Sprintf("Missing permission %s", permission))
+			return
+		}
+		next(w, r)
+	}
+}
+
+//apiError body of every unsuccessful API response
+type apiError struct {
+	Error string `json:"error"`
+}
+
+//writeAPIJSON serialises value as the JSON body of the response
+func writeAPIJSON(w http.ResponseWriter, code int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		logging.Error(err.Error())
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, code int, message string) {
+	writeAPIJSON(w, code, apiError{Error: message})
+}
+
+//writeAPIServerError logs the actual error but doesn't leak it to the client
+func writeAPIServerError(w http.ResponseWriter, err error) {
+	logging.Error(err.Error())
+	writeAPIError(w, http.StatusInternalServerError, "Internal server error")
+}
+
+//readAPIJSON decodes the JSON request body into value, unknown fields are rejected so that typos don't silently do nothing
+func readAPIJSON(w http.ResponseWriter, r *http.Request, value interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIRequestBodySize))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(value); err != nil {
+		if err == io.EOF {
+			return fmt.Errorf("Request body is empty")
+		}
+		return fmt.Errorf("Invalid JSON request body -> %s", err.Error())
+	}
+
+	return nil
+}
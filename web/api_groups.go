@@ -0,0 +1,307 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tacusci/berrycms/db"
+)
+
+//APIGroupsHandler JSON API endpoints for managing groups and their members
+type APIGroupsHandler struct {
+	Router *MutableRouter
+}
+
+//isDefaultGroup checks whether the group is one of those created on setup, which can't be renamed or deleted
+func isDefaultGroup(g *db.Group) bool {
+	return g.Title == "Admins" || g.Title == "Moderators" || g.Title == "Users"
+}
+
+//groupFromRequest loads the group of the UUID in the request route, writing a not found response if it doesn't exist
+func groupFromRequest(w http.ResponseWriter, r *http.Request) *db.Group {
+	gt := db.GroupTable{}
+	group, err := gt.SelectByUUID(db.Conn, mux.Vars(r)["uuid"])
+	if err != nil {
+		writeAPIServerError(w, err)
+		return nil
+	}
+
+	if len(group.UUID) == 0 {
+		writeAPIError(w, http.StatusNotFound, "Group not found")
+		return nil
+	}
+
+	return group
+}
+
+//List responds with every group
+func (agh *APIGroupsHandler) List(w http.ResponseWriter, r *http.Request) {
+	groups := make([]db.Group, 0)
+	if err := db.Find(db.Conn, db.From(&db.GroupTable{}), &groups); err != nil {
+		writeAPIServerError(w, err)
+		return
+	}
+
+	writeAPIJSON(w, http.StatusOK, groups)
+}
+
+//Get responds with a single group
+func (agh *APIGroupsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if group := groupFromRequest(w, r); group != nil {
+		writeAPIJSON(w, http.StatusOK, group)
+	}
+}
+
+//Create adds a new group
+func (agh *APIGroupsHandler) Create(w http.ResponseWriter, r *http.Request) {
+	groupToCreate := &db.Group{}
+	if err := readAPIJSON(w, r, groupToCreate); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(groupToCreate.Title) == 0 {
+		writeAPIError(w, http.StatusBadRequest, "Group title is blank")
+		return
+	}
+
+	gt := db.GroupTable{}
+	if existingGroup, err := gt.SelectByTitle(db.Conn, groupToCreate.Title); err == nil && len(existingGroup.UUID) > 0 {
+		writeAPIError(w, http.StatusConflict, fmt.Sprintf("Group %s already exists", groupToCreate.Title))
+		return
+	}
+
+	groupToCreate.Groupid = 0
+	groupToCreate.UUID = ""
+	groupToCreate.CreatedDateTime = time.Now().Unix()
+
+	if err := gt.Insert(db.Conn, groupToCreate); err != nil {
+		writeAPIServerError(w, err)
+		return
+	}
+
+	writeAPIJSON(w, http.StatusCreated, groupToCreate)
+}
+
+//Update renames a group
+func (agh *APIGroupsHandler) Update(w http.ResponseWriter, r *http.Request) {
+	groupToEdit := groupFromRequest(w, r)
+	if groupToEdit == nil {
+		return
+	}
+
+	if isDefaultGroup(groupToEdit) {
+		writeAPIError(w, http.StatusForbidden, fmt.Sprintf("Default group %s can't be renamed", groupToEdit.Title))
+		return
+	}
+
+	original := *groupToEdit
+
+	if err := readAPIJSON(w, r, groupToEdit); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	groupToEdit.Groupid = original.Groupid
+	groupToEdit.UUID = original.UUID
+	groupToEdit.CreatedDateTime = original.CreatedDateTime
+
+	if len(groupToEdit.Title) == 0 {
+		writeAPIError(w, http.StatusBadRequest, "Group title is blank")
+		return
+	}
+
+	gt := db.GroupTable{}
+	if groupToEdit.Title != original.Title {
+		if existingGroup, err := gt.SelectByTitle(db.Conn, groupToEdit.Title); err == nil && len(existingGroup.UUID) > 0 {
+			writeAPIError(w, http.StatusConflict, fmt.Sprintf("Group %s already exists", groupToEdit.Title))
+			return
+		}
+	}
+
+	if err := gt.Update(db.Conn, groupToEdit); err != nil {
+		writeAPIServerError(w, err)
+		return
+	}
+
+	writeAPIJSON(w, http.StatusOK, groupToEdit)
+}
+
+//Delete removes a group along with all of its memberships and permissions
+func (agh *APIGroupsHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	groupToDelete := groupFromRequest(w, r)
+	if groupToDelete == nil {
+		return
+	}
+
+	if isDefaultGroup(groupToDelete) {
+		writeAPIError(w, http.StatusForbidden, fmt.Sprintf("Default group %s can't be deleted", groupToDelete.Title))
+		return
+	}
+
+	gt := db.GroupTable{}
+	err := db.WithTransaction(db.Conn, func(tx *sql.Tx) error {
+		_, err := gt.DeleteByUUID(tx, groupToDelete.UUID)
+		return err
+	})
+	if err != nil {
+		writeAPIServerError(w, err)
+		return
+	}
+
+	//groups may have been restricting pages
+	agh.Router.Reload()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//ListMembers responds with every user in the group
+func (agh *APIGroupsHandler) ListMembers(w http.ResponseWriter, r *http.Request) {
+	group := groupFromRequest(w, r)
+	if group == nil {
+		return
+	}
+
+	gmt := db.GroupMembershipTable{}
+	rows, err := db.From(&gmt).Columns("useruuid").Where(db.Equal("groupuuid", group.UUID)).Query(db.Conn)
+	if err != nil {
+		writeAPIServerError(w, err)
+		return
+	}
+
+	userUUIDs := make([]string, 0)
+	for rows.Next() {
+		var userUUID string
+		if err := rows.Scan(&userUUID); err != nil {
+			rows.Close()
+			writeAPIServerError(w, err)
+			return
+		}
+		userUUIDs = append(userUUIDs, userUUID)
+	}
+	rows.Close()
+
+	ut := db.UsersTable{}
+	members := make([]db.User, 0, len(userUUIDs))
+	for _, userUUID := range userUUIDs {
+		user, err := ut.SelectByUUID(db.Conn, userUUID)
+		if err != nil {
+			writeAPIServerError(w, err)
+			return
+		}
+		if len(user.UUID) > 0 {
+			members = append(members, *user)
+		}
+	}
+
+	writeAPIJSON(w, http.StatusOK, members)
+}
+
+//AddMember adds the user of the UUID in the request body to the group
+func (agh *APIGroupsHandler) AddMember(w http.ResponseWriter, r *http.Request) {
+	group := groupFromRequest(w, r)
+	if group == nil {
+		return
+	}
+
+	membership := &db.GroupMembership{}
+	if err := readAPIJSON(w, r, membership); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ut := db.UsersTable{}
+	user, err := ut.SelectByUUID(db.Conn, membership.UserUUID)
+	if err != nil {
+		writeAPIServerError(w, err)
+		return
+	}
+
+	if len(user.UUID) == 0 {
+		writeAPIError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	gmt := db.GroupMembershipTable{}
+	groupUUIDs, err := gmt.SelectGroupUUIDsByUserUUID(db.Conn, user.UUID)
+	if err != nil {
+		writeAPIServerError(w, err)
+		return
+	}
+
+	for _, groupUUID := range groupUUIDs {
+		if groupUUID == group.UUID {
+			writeAPIError(w, http.StatusConflict, fmt.Sprintf("User %s is already in group %s", user.Username, group.Title))
+			return
+		}
+	}
+
+	membership.Groupmembershipid = 0
+	membership.CreatedDateTime = time.Now().Unix()
+	membership.GroupUUID = group.UUID
+	membership.UserUUID = user.UUID
+
+	if err := gmt.Insert(db.Conn, membership); err != nil {
+		writeAPIServerError(w, err)
+		return
+	}
+
+	writeAPIJSON(w, http.StatusCreated, membership)
+}
+
+//RemoveMember removes the user of the UUID in the request route from the group
+func (agh *APIGroupsHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	group := groupFromRequest(w, r)
+	if group == nil {
+		return
+	}
+
+	ut := db.UsersTable{}
+	user, err := ut.SelectByUUID(db.Conn, mux.Vars(r)["useruuid"])
+	if err != nil {
+		writeAPIServerError(w, err)
+		return
+	}
+
+	if len(user.UUID) == 0 {
+		writeAPIError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	//don't allow the root user to be removed from the admins user group
+	if group.Title == "Admins" && db.UsersRoleFlag(user.UserroleId) == db.ROOT_USER {
+		writeAPIError(w, http.StatusForbidden, "The root user can't be removed from the admins group")
+		return
+	}
+
+	gmt := db.GroupMembershipTable{}
+	numDeleted, err := gmt.DeleteUserFromGroup(db.Conn, user, group)
+	if err != nil {
+		writeAPIServerError(w, err)
+		return
+	}
+
+	if numDeleted == 0 {
+		writeAPIError(w, http.StatusNotFound, fmt.Sprintf("User %s isn't in group %s", user.Username, group.Title))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,237 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/logging"
+)
+
+//APIPagesHandler JSON API endpoints for managing pages
+type APIPagesHandler struct {
+	Router *MutableRouter
+}
+
+//List responds with every saved page the requester is allowed to read
+func (aph *APIPagesHandler) List(w http.ResponseWriter, r *http.Request) {
+	amw := AuthMiddleware{}
+	pages := make([]db.Page, 0)
+	if err := db.Find(db.Conn, db.From(&db.PagesTable{}), &pages); err != nil {
+		writeAPIServerError(w, err)
+		return
+	}
+
+	readablePages := make([]db.Page, 0, len(pages))
+	for i := range pages {
+		if amw.HasPagePermission(r, &pages[i], db.PAGE_READ) {
+			readablePages = append(readablePages, pages[i])
+		}
+	}
+
+	writeAPIJSON(w, http.StatusOK, readablePages)
+}
+
+//Get responds with a single page
+func (aph *APIPagesHandler) Get(w http.ResponseWriter, r *http.Request) {
+	pt := db.PagesTable{}
+	page, err := pt.SelectByUUID(db.Conn, mux.Vars(r)["uuid"])
+	if err != nil || page == nil || page.UUID == "" {
+		writeAPIError(w, http.StatusNotFound, "Page not found")
+		return
+	}
+
+	amw := AuthMiddleware{}
+	if !amw.HasPagePermission(r, page, db.PAGE_READ) {
+		writeAPIError(w, http.StatusForbidden, "Not permitted to read this page")
+		return
+	}
+
+	writeAPIJSON(w, http.StatusOK, page)
+}
+
+//Create saves a new page authored by the requesting user
+func (aph *APIPagesHandler) Create(w http.ResponseWriter, r *http.Request) {
+	amw := AuthMiddleware{}
+	loggedInUser, err := amw.LoggedInUser(r)
+	if err != nil || loggedInUser == nil {
+		writeAPIError(w, http.StatusUnauthorized, "Not logged in")
+		return
+	}
+
+	pageToCreate := &db.Page{}
+	if err := readAPIJSON(w, r, pageToCreate); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	//these are always set by the server, regardless of what was sent
+	pageToCreate.PageId = 0
+	pageToCreate.UUID = ""
+	pageToCreate.CreatedDateTime = time.Now().Unix()
+	pageToCreate.AuthorUUID = loggedInUser.UUID
+
+	if err := validateAPIPage(pageToCreate); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pt := db.PagesTable{}
+	if _, err := pt.SelectByRoute(db.Conn, pageToCreate.Route); err == nil {
+		writeAPIError(w, http.StatusConflict, fmt.Sprintf("Page with route %s already exists", pageToCreate.Route))
+		return
+	}
+
+	if err := pt.Insert(db.Conn, pageToCreate); err != nil {
+		writeAPIServerError(w, err)
+		return
+	}
+
+	prt := db.PageRevisionsTable{}
+	if err := prt.InsertFromPage(db.Conn, pageToCreate, loggedInUser.UUID); err != nil {
+		logging.Error(err.Error())
+	}
+
+	aph.Router.Reload()
+
+	writeAPIJSON(w, http.StatusCreated, pageToCreate)
+}
+
+//Update overwrites the fields of an existing page with any sent in the request
+func (aph *APIPagesHandler) Update(w http.ResponseWriter, r *http.Request) {
+	amw := AuthMiddleware{}
+	loggedInUser, err := amw.LoggedInUser(r)
+	if err != nil || loggedInUser == nil {
+		writeAPIError(w, http.StatusUnauthorized, "Not logged in")
+		return
+	}
+
+	pt := db.PagesTable{}
+	pageToEdit, err := pt.SelectByUUID(db.Conn, mux.Vars(r)["uuid"])
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, "Page not found")
+		return
+	}
+
+	if !amw.HasPagePermission(r, pageToEdit, db.PAGE_EDIT) {
+		writeAPIError(w, http.StatusForbidden, "Not permitted to edit this page")
+		return
+	}
+
+	original := *pageToEdit
+	wasLive := original.IsLive(time.Now().Unix())
+
+	//decoding on top of the existing page means fields left out of the request keep their current values
+	if err := readAPIJSON(w, r, pageToEdit); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pageToEdit.PageId = original.PageId
+	pageToEdit.UUID = original.UUID
+	pageToEdit.CreatedDateTime = original.CreatedDateTime
+	pageToEdit.AuthorUUID = original.AuthorUUID
+
+	if err := validateAPIPage(pageToEdit); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if strings.Compare(original.Route, pageToEdit.Route) != 0 {
+		if _, err := pt.SelectByRoute(db.Conn, pageToEdit.Route); err == nil {
+			writeAPIError(w, http.StatusConflict, fmt.Sprintf("Page with route %s already exists", pageToEdit.Route))
+			return
+		}
+	}
+
+	prt := db.PageRevisionsTable{}
+
+	//pages saved before revisions existed have no history yet, so keep their original content before overwriting it
+	if revisions, err := prt.SelectByPageUUID(db.Conn, original.UUID); err == nil && len(revisions) == 0 {
+		err = prt.Insert(db.Conn, &db.PageRevision{
+			CreatedDateTime: original.CreatedDateTime,
+			PageUUID:        original.UUID,
+			AuthorUUID:      original.AuthorUUID,
+			Title:           original.Title,
+			Route:           original.Route,
+			Content:         original.Content,
+		})
+		if err != nil {
+			logging.Error(err.Error())
+		}
+	}
+
+	if err := pt.Update(db.Conn, pageToEdit); err != nil {
+		writeAPIServerError(w, err)
+		return
+	}
+
+	if err := prt.InsertFromPage(db.Conn, pageToEdit, loggedInUser.UUID); err != nil {
+		logging.Error(err.Error())
+	}
+
+	if strings.Compare(original.Route, pageToEdit.Route) != 0 || wasLive != pageToEdit.IsLive(time.Now().Unix()) || original.Roleprotected != pageToEdit.Roleprotected {
+		aph.Router.Reload()
+	}
+
+	writeAPIJSON(w, http.StatusOK, pageToEdit)
+}
+
+//Delete removes a page along with its revisions and group permissions
+func (aph *APIPagesHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	pt := db.PagesTable{}
+	pageToDelete, err := pt.SelectByUUID(db.Conn, mux.Vars(r)["uuid"])
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, "Page not found")
+		return
+	}
+
+	amw := AuthMiddleware{}
+	if !amw.HasPagePermission(r, pageToDelete, db.PAGE_EDIT) {
+		writeAPIError(w, http.StatusForbidden, "Not permitted to delete this page")
+		return
+	}
+
+	err = db.WithTransaction(db.Conn, func(tx *sql.Tx) error {
+		return deletePage(tx, pageToDelete.UUID)
+	})
+	if err != nil {
+		writeAPIServerError(w, err)
+		return
+	}
+
+	aph.Router.Reload()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//validateAPIPage makes sure that a page sent to the API has everything it needs to be saved
+func validateAPIPage(p *db.Page) error {
+	if len(p.Title) == 0 {
+		return fmt.Errorf("Page title is blank")
+	}
+
+	if len(p.Route) == 0 {
+		return fmt.Errorf("Page route is blank")
+	}
+
+	return validatePagePublication(p)
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tacusci/berrycms/db"
+)
+
+func TestAPIRequiresLogin(t *testing.T) {
+	mr := &MutableRouter{}
+	handlerCalled := false
+	handler := mr.requireAPIPermission(db.PERM_PAGES_VIEW, func(w http.ResponseWriter, r *http.Request) {
+		handlerCalled = true
+	})
+
+	responseRecorder := httptest.NewRecorder()
+	handler(responseRecorder, httptest.NewRequest("GET", apiV1Prefix+"/pages", nil))
+
+	if handlerCalled {
+		t.Errorf("API handler should not be reached without being logged in")
+	}
+
+	if responseRecorder.Code != http.StatusUnauthorized {
+		t.Errorf("API request without being logged in should be unauthorised, STATUS: %d", responseRecorder.Code)
+	}
+}
+
+func TestAPIUserNeverSerialisesAuthHash(t *testing.T) {
+	u := db.User{Username: "apiuser", AuthHash: "thisisasecrethash"}
+
+	userJSON, err := json.Marshal(u)
+	if err != nil {
+		t.Fatalf("Unable to serialise user: %v", err)
+	}
+
+	if strings.Contains(string(userJSON), u.AuthHash) {
+		t.Errorf("Serialised user contains auth hash: %s", userJSON)
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/util"
+)
+
+//APIUsersHandler JSON API endpoints for managing users
+type APIUsersHandler struct {
+	Router *MutableRouter
+}
+
+//apiNewUser fields accepted when creating a user, the password is sent in plain text and only its hash is stored
+type apiNewUser struct {
+	db.User
+	Password string `json:"password"`
+}
+
+//List responds with every user
+func (auh *APIUsersHandler) List(w http.ResponseWriter, r *http.Request) {
+	users := make([]db.User, 0)
+	if err := db.Find(db.Conn, db.From(&db.UsersTable{}), &users); err != nil {
+		writeAPIServerError(w, err)
+		return
+	}
+
+	writeAPIJSON(w, http.StatusOK, users)
+}
+
+//Get responds with a single user
+func (auh *APIUsersHandler) Get(w http.ResponseWriter, r *http.Request) {
+	ut := db.UsersTable{}
+	user, err := ut.SelectByUUID(db.Conn, mux.Vars(r)["uuid"])
+	if err != nil {
+		writeAPIServerError(w, err)
+		return
+	}
+
+	if len(user.UUID) == 0 {
+		writeAPIError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	writeAPIJSON(w, http.StatusOK, user)
+}
+
+//Create adds a new user, only regular and moderator users can be created this way
+func (auh *APIUsersHandler) Create(w http.ResponseWriter, r *http.Request) {
+	newUser := &apiNewUser{}
+	if err := readAPIJSON(w, r, newUser); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(newUser.FirstName) == 0 || len(newUser.LastName) == 0 || len(newUser.Email) == 0 || len(newUser.Username) == 0 || len(newUser.Password) == 0 {
+		writeAPIError(w, http.StatusBadRequest, "One of required fields is blank")
+		return
+	}
+
+	if match, err := regexp.MatchString(usernameRegex, newUser.Username); err != nil || !match {
+		writeAPIError(w, http.StatusBadRequest, "Username does not match pattern regex")
+		return
+	}
+
+	if match, err := regexp.MatchString(emailRegex, newUser.Email); err != nil || !match {
+		writeAPIError(w, http.StatusBadRequest, "Email does not match pattern regex")
+		return
+	}
+
+	if newUser.UserroleId == 0 {
+		newUser.UserroleId = int(db.REG_USER)
+	}
+
+	role := db.UsersRoleFlag(newUser.UserroleId)
+	if role != db.REG_USER && role != db.MOD_USER && role != db.MEMBER_USER {
+		writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("Users can't be created with role %d", newUser.UserroleId))
+		return
+	}
+
+	ut := db.UsersTable{}
+	if existingUser, err := ut.SelectByUsername(db.Conn, newUser.Username); err != nil {
+		writeAPIServerError(w, err)
+		return
+	} else if len(existingUser.UUID) > 0 {
+		writeAPIError(w, http.StatusConflict, fmt.Sprintf("User %s already exists", newUser.Username))
+		return
+	}
+
+	userToCreate := &db.User{
+		Username:        newUser.Username,
+		CreatedDateTime: time.Now().Unix(),
+		Email:           newUser.Email,
+		UserroleId:      newUser.UserroleId,
+		FirstName:       newUser.FirstName,
+		LastName:        newUser.LastName,
+		AuthHash:        util.HashAndSalt([]byte(newUser.Password)),
+	}
+
+	if err := ut.Insert(db.Conn, userToCreate); err != nil {
+		writeAPIServerError(w, err)
+		return
+	}
+
+	writeAPIJSON(w, http.StatusCreated, userToCreate)
+}
+
+//Delete removes a user, as with the admin pages the root user, the requesting user and page authors can't be deleted
+func (auh *APIUsersHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	ut := db.UsersTable{}
+	userToDelete, err := ut.SelectByUUID(db.Conn, mux.Vars(r)["uuid"])
+	if err != nil {
+		writeAPIServerError(w, err)
+		return
+	}
+
+	if len(userToDelete.UUID) == 0 {
+		writeAPIError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	if db.UsersRoleFlag(userToDelete.UserroleId) == db.ROOT_USER {
+		writeAPIError(w, http.StatusForbidden, "The root user can't be deleted")
+		return
+	}
+
+	amw := AuthMiddleware{}
+	loggedInUser, err := amw.LoggedInUser(r)
+	if err != nil || loggedInUser == nil {
+		writeAPIError(w, http.StatusUnauthorized, "Not logged in")
+		return
+	}
+
+	if loggedInUser.UUID == userToDelete.UUID {
+		writeAPIError(w, http.StatusForbidden, "Users can't delete themselves")
+		return
+	}
+
+	pt := db.PagesTable{}
+	rows, err := db.From(&pt).Columns("uuid").Where(db.Equal("authoruuid", userToDelete.UUID)).Query(db.Conn)
+	if err != nil {
+		writeAPIServerError(w, err)
+		return
+	}
+
+	isAuthor := rows.Next()
+	rows.Close()
+
+	if isAuthor {
+		writeAPIError(w, http.StatusConflict, "User is the author of existing pages")
+		return
+	}
+
+	err = db.WithTransaction(db.Conn, func(tx *sql.Tx) error {
+		return ut.DeleteWithDependents(tx, userToDelete)
+	})
+	if err != nil {
+		writeAPIServerError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
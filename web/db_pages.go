@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"html/template"
 	"net/http"
+	"time"
 
 	"github.com/tacusci/logging"
 
@@ -43,7 +44,7 @@ func (sph *SavedPageHandler) Get(w http.ResponseWriter, r *http.Request) {
 		logging.Error(err.Error())
 	}
 
-	if p == nil {
+	if p == nil || !p.IsLive(time.Now().Unix()) {
 		fourOhFour(w, r)
 		return
 	}
@@ -73,7 +74,7 @@ func (sph *SavedPageHandler) Post(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if p == nil {
+	if p == nil || !p.IsLive(time.Now().Unix()) {
 		fourOhFour(w, r)
 		return
 	}
@@ -157,3 +158,6 @@ func (sph *SavedPageHandler) HandlesGet() bool { return true }
 
 //HandlesPost retrieve whether this handler handles post requests
 func (sph *SavedPageHandler) HandlesPost() bool { return true }
+
+//Permission get the permission a client needs to be granted to use handler
+func (sph *SavedPageHandler) Permission() db.Permission { return db.PERM_NONE }
@@ -16,6 +16,7 @@ package web
 
 import (
 	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/util"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -29,6 +30,34 @@ func init() {
 	db.Setup()
 }
 
+//pageAuthor creates a user for test pages to be written by, pages can't refer to authors who don't exist
+func pageAuthor(t *testing.T) *db.User {
+	ut := db.UsersTable{}
+	author, err := ut.SelectByUsername(db.Conn, "pageauthor")
+	if err != nil {
+		t.Fatalf("Error loading page author: %v", err)
+	}
+
+	if author.UUID != "" {
+		return author
+	}
+
+	author = &db.User{
+		Username:        "pageauthor",
+		CreatedDateTime: time.Now().Unix(),
+		Email:           "pageauthor@local.com",
+		FirstName:       "Page",
+		LastName:        "Author",
+		AuthHash:        util.HashAndSalt([]byte("testingpageauthor")),
+	}
+
+	if err := ut.Insert(db.Conn, author); err != nil {
+		t.Fatalf("Error creating page author: %v", err)
+	}
+
+	return author
+}
+
 func TestSavedPageGet(t *testing.T) {
 	sph := SavedPageHandler{}
 	req := httptest.NewRequest("GET", "/", nil)
@@ -47,7 +76,7 @@ func TestSavedPageGet(t *testing.T) {
 	pt.Insert(db.Conn, &db.Page{
 		CreatedDateTime: time.Now().Unix(),
 		Roleprotected:   false,
-		AuthorUUID:      "",
+		AuthorUUID:      pageAuthor(t).UUID,
 		Title:           "Test Page",
 		Route:           "/testpage",
 		//page content is never saved as HTML but instead as QuillJS delta JSON objects
@@ -71,3 +100,38 @@ func TestSavedPageGet(t *testing.T) {
 		}
 	}
 }
+
+func TestSavedPageGetUnpublished(t *testing.T) {
+	sph := SavedPageHandler{}
+	pt := db.PagesTable{}
+
+	pt.Insert(db.Conn, &db.Page{
+		CreatedDateTime: time.Now().Unix(),
+		AuthorUUID:      pageAuthor(t).UUID,
+		Title:           "Draft Test Page",
+		Route:           "/drafttestpage",
+		Content:         "[{\"insert\":\"This page is not finished!\\n\"}]",
+		Status:          db.PAGE_DRAFT,
+	})
+
+	pt.Insert(db.Conn, &db.Page{
+		CreatedDateTime: time.Now().Unix(),
+		AuthorUUID:      pageAuthor(t).UUID,
+		Title:           "Scheduled Test Page",
+		Route:           "/scheduledtestpage",
+		Content:         "[{\"insert\":\"This page is not out yet!\\n\"}]",
+		Status:          db.PAGE_SCHEDULED,
+		PublishDateTime: time.Now().Add(time.Hour).Unix(),
+	})
+
+	for _, route := range []string{"/drafttestpage", "/scheduledtestpage"} {
+		req := httptest.NewRequest("GET", route, nil)
+		responseRecorder := httptest.NewRecorder()
+
+		sph.Get(responseRecorder, req)
+
+		if resp := responseRecorder.Result(); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Test get of unpublished page %s should 404, STATUS: %d...", route, resp.StatusCode)
+		}
+	}
+}
@@ -39,6 +39,7 @@ type Handler interface {
 	Post(w http.ResponseWriter, r *http.Request)
 	HandlesGet() bool
 	HandlesPost() bool
+	Permission() db.Permission
 }
 
 //GetDefaultHandlers get fixed list of all default handlers
@@ -55,6 +56,30 @@ func GetDefaultHandlers(router *MutableRouter) []Handler {
 			route:  adminHiddenPrefix + "/login",
 			Router: router,
 		},
+		&LoginTwoFactorHandler{
+			route:  adminHiddenPrefix + "/login/twofactor",
+			Router: router,
+		},
+		&PasswordForgotHandler{
+			route:  adminHiddenPrefix + "/login/forgot",
+			Router: router,
+		},
+		&PasswordResetHandler{
+			route:  adminHiddenPrefix + "/login/reset/{token}",
+			Router: router,
+		},
+		&RegisterHandler{
+			route:  adminHiddenPrefix + "/register",
+			Router: router,
+		},
+		&RegisterVerifyHandler{
+			route:  adminHiddenPrefix + "/register/verify/{token}",
+			Router: router,
+		},
+		&AccountHandler{
+			route:  adminHiddenPrefix + "/account",
+			Router: router,
+		},
 		&LogoutHandler{
 			route:  adminHiddenPrefix + "/logout",
 			Router: router,
@@ -71,10 +96,58 @@ func GetDefaultHandlers(router *MutableRouter) []Handler {
 			route:  adminHiddenPrefix + "/admin/users/new",
 			Router: router,
 		},
+		&AdminUsersEditHandler{
+			route:  adminHiddenPrefix + "/admin/users/edit/{uuid}",
+			Router: router,
+		},
 		&AdminUsersDeleteHandler{
 			route:  adminHiddenPrefix + "/admin/users/delete",
 			Router: router,
 		},
+		&AdminUsersSessionsHandler{
+			route:  adminHiddenPrefix + "/admin/users/sessions/{uuid}",
+			Router: router,
+		},
+		&AdminSessionsHandler{
+			route:  adminHiddenPrefix + "/admin/sessions",
+			Router: router,
+		},
+		&AdminUsersUnlockHandler{
+			route:  adminHiddenPrefix + "/admin/users/unlock",
+			Router: router,
+		},
+		&AdminUsersRegistrationsHandler{
+			route:  adminHiddenPrefix + "/admin/users/registrations",
+			Router: router,
+		},
+		&AdminUsersRegistrationsApproveHandler{
+			route:  adminHiddenPrefix + "/admin/users/registrations/approve",
+			Router: router,
+		},
+		&AdminUsersRegistrationsRejectHandler{
+			route:  adminHiddenPrefix + "/admin/users/registrations/reject",
+			Router: router,
+		},
+		&AdminTokensHandler{
+			route:  adminHiddenPrefix + "/admin/tokens",
+			Router: router,
+		},
+		&AdminTokensRevokeHandler{
+			route:  adminHiddenPrefix + "/admin/tokens/revoke",
+			Router: router,
+		},
+		&AdminBackupHandler{
+			route:  adminHiddenPrefix + "/admin/backup",
+			Router: router,
+		},
+		&AdminSettingsHandler{
+			route:  adminHiddenPrefix + "/admin/settings",
+			Router: router,
+		},
+		&AdminTwoFactorHandler{
+			route:  adminHiddenPrefix + "/admin/twofactor",
+			Router: router,
+		},
 		&AdminPagesHandler{
 			route:  adminHiddenPrefix + "/admin/pages",
 			Router: router,
@@ -87,6 +160,22 @@ func GetDefaultHandlers(router *MutableRouter) []Handler {
 			route:  adminHiddenPrefix + "/admin/pages/edit/{uuid}",
 			Router: router,
 		},
+		&AdminPagesEditAccessHandler{
+			route:  adminHiddenPrefix + "/admin/pages/edit/{uuid}/access",
+			Router: router,
+		},
+		&AdminPagesEditRevisionsHandler{
+			route:  adminHiddenPrefix + "/admin/pages/edit/{uuid}/revisions",
+			Router: router,
+		},
+		&AdminPagesEditRevisionsDiffHandler{
+			route:  adminHiddenPrefix + "/admin/pages/edit/{uuid}/revisions/diff",
+			Router: router,
+		},
+		&AdminPagesEditRevisionsRestoreHandler{
+			route:  adminHiddenPrefix + "/admin/pages/edit/{uuid}/revisions/restore",
+			Router: router,
+		},
 		&AdminPagesDeleteHandler{
 			route:  adminHiddenPrefix + "/admin/pages/delete",
 			Router: router,
@@ -111,6 +200,14 @@ func GetDefaultHandlers(router *MutableRouter) []Handler {
 			route:  adminHiddenPrefix + "/admin/users/groups/edit/{uuid}/remove",
 			Router: router,
 		},
+		&AdminUserGroupsEditPermissionsHandler{
+			route:  adminHiddenPrefix + "/admin/users/groups/edit/{uuid}/permissions",
+			Router: router,
+		},
+		&AdminUserGroupsEditTwoFactorHandler{
+			route:  adminHiddenPrefix + "/admin/users/groups/edit/{uuid}/twofactor",
+			Router: router,
+		},
 		&AdminUserGroupsDeleteHandler{
 			route:  adminHiddenPrefix + "/admin/users/groups/delete",
 			Router: router,
@@ -123,6 +220,28 @@ func UnixToTimeString(unix int64) string {
 	return time.Unix(unix, 0).Format("15:04:05 02-01-2006")
 }
 
+const dateTimeLocalLayout = "2006-01-02T15:04"
+
+//UnixToDateTimeLocal take unix time and convert to the format used by datetime-local form inputs, unset times are left blank
+func UnixToDateTimeLocal(unix int64) string {
+	if unix <= 0 {
+		return ""
+	}
+	return time.Unix(unix, 0).Format(dateTimeLocalLayout)
+}
+
+//DateTimeLocalToUnix take datetime-local form input value in server local time and convert to unix time, blank values are 0
+func DateTimeLocalToUnix(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	t, err := time.ParseInLocation(dateTimeLocalLayout, value, time.Local)
+	if err != nil {
+		return 0, err
+	}
+	return t.Unix(), nil
+}
+
 //RenderDefault uses plush rendering engine to take default page template and create HTML content
 func RenderDefault(w http.ResponseWriter, template string, pctx *plush.Context) error {
 	header, err := ioutil.ReadFile("res" + string(os.PathSeparator) + "header.snip")
@@ -138,6 +257,8 @@ func RenderDefault(w http.ResponseWriter, template string, pctx *plush.Context)
 		return err
 	}
 
+	pctx.Set("sitetitle", CurrentSettings().SiteTitle)
+
 	renderedContent, err := plush.Render(string(append(append(header, []byte("\n")...), content...))+"\n</html>", pctx)
 
 	if err != nil {
@@ -153,7 +274,7 @@ func RenderDefault(w http.ResponseWriter, template string, pctx *plush.Context)
 func Render(w http.ResponseWriter, r *http.Request, p *db.Page, ctx *plush.Context) error {
 	// assume response is fine/OK
 	var respCode = http.StatusOK
-	var htmlHead = "<head><link rel=\"stylesheet\" href=\"/css/berry-default.css\"><link rel=\"stylesheet\" href=\"/css/font.css\"></head>"
+	var htmlHead = "<head><link rel=\"stylesheet\" href=\"" + themeStylesheet() + "\"><link rel=\"stylesheet\" href=\"/css/font.css\"></head>"
 	var respBytesData []byte
 	var uriVars map[string]string = mux.Vars(r)
 
@@ -280,7 +401,7 @@ func Render(w http.ResponseWriter, r *http.Request, p *db.Page, ctx *plush.Conte
 
 //RenderStr uses plush rendering engine to read page content from the DB and create HTML content as string
 func RenderStr(ctx *plush.Context) string {
-	html, err := plush.Render("<html><head><link rel=\"stylesheet\" href=\"/css/berry-default.css\"><link rel=\"stylesheet\" href=\"/css/font.css\"></head><%= pagecontent %></html>", ctx)
+	html, err := plush.Render("<html><head><link rel=\"stylesheet\" href=\""+themeStylesheet()+"\"><link rel=\"stylesheet\" href=\"/css/font.css\"></head><%= pagecontent %></html>", ctx)
 	if err != nil {
 		logging.Error(err.Error())
 		return "<h1>500 Server Error</h1>"
@@ -22,9 +22,13 @@ import (
 	"github.com/gobuffalo/plush"
 	"github.com/gofrs/uuid"
 	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/mail"
 	"github.com/tacusci/logging"
 )
 
+//maxUserAgentLength longest user agent stored against a session
+const maxUserAgentLength = 125
+
 //LoginHandler handler to contain pointer to core router and the URI string
 type LoginHandler struct {
 	Router *MutableRouter
@@ -50,6 +54,8 @@ func (lh *LoginHandler) Get(w http.ResponseWriter, r *http.Request) {
 		pctx.Set("quillenabled", false)
 		pctx.Set("formhash", lh.mapFormToHash(w, r, "loginform"))
 		pctx.Set("loginerrormessage", "")
+		pctx.Set("passwordresetenabled", mail.Enabled())
+		pctx.Set("registrationopen", registrationAvailable())
 		pctx.Set("adminhiddenpassword", "")
 		if lh.Router.AdminHidden {
 			pctx.Set("adminhiddenpassword", fmt.Sprintf("/%s", lh.Router.AdminHiddenPassword))
@@ -94,6 +100,28 @@ func (lh *LoginHandler) Post(w http.ResponseWriter, r *http.Request) {
 
 	if lh.fetchFormHash(w, r, r.PostFormValue("formname")) == r.PostFormValue("hashid") {
 
+		allowed, err := loginAllowed(r, r.PostFormValue("username"))
+
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		if !allowed {
+			loginErrorStore, err := sessionsstore.Get(r, "passerrmsg")
+
+			if err != nil {
+				Error(w, err)
+				return
+			}
+
+			loginErrorStore.Values["errormessage"] = loginThrottledMessage
+			loginErrorStore.Save(r, w)
+
+			http.Redirect(w, r, lh.route, http.StatusFound)
+			return
+		}
+
 		ut := db.UsersTable{}
 		user, err := ut.SelectByUsername(db.Conn, r.PostFormValue("username"))
 
@@ -107,53 +135,45 @@ func (lh *LoginHandler) Post(w http.ResponseWriter, r *http.Request) {
 		if user.Login() {
 			logging.Debug("Login successful...")
 
-			v4UUID, err := uuid.NewV4()
+			utft := db.UserTwoFactorTable{}
+			twoFactorEnabled, err := utft.IsEnabled(db.Conn, user.UUID)
 
 			if err != nil {
 				Error(w, err)
 				return
 			}
 
-			sessionUUID := v4UUID.String()
+			if twoFactorEnabled {
+				//the password was right, but the session isn't created until the second step is passed too
+				twoFactorStore, err := sessionsstore.Get(r, "twofactor")
 
-			authSessionsTable := db.AuthSessionsTable{}
-
-			if authSession, err := authSessionsTable.SelectByUserUUID(db.Conn, user.UUID); err != nil {
-				logging.Debug(fmt.Sprintf("There's no existing session uuid for user: %s of UUID: %s, creating session of UUID: %s...", user.Username, user.UUID, sessionUUID))
-				err := authSessionsTable.Insert(db.Conn, &db.AuthSession{
-					CreatedDateTime:    time.Now().Unix(),
-					LastActiveDateTime: time.Now().Unix(),
-					SessionUUID:        sessionUUID,
-					UserUUID:           user.UUID,
-				})
-
-				if err != nil {
-					Error(w, err)
-				}
-			} else {
-				logging.Debug(fmt.Sprintf("Existing session for uuid for user: %s of UUID: %s, updating...", user.Username, user.UUID))
-				err := authSessionsTable.Update(db.Conn, &db.AuthSession{
-					CreatedDateTime:    authSession.CreatedDateTime,
-					LastActiveDateTime: time.Now().Unix(),
-					SessionUUID:        sessionUUID,
-					UserUUID:           user.UUID,
-				})
 				if err != nil {
 					Error(w, err)
+					return
 				}
-			}
 
-			authSessionStore, err := sessionsstore.Get(r, "auth")
+				twoFactorStore.Values["useruuid"] = user.UUID
+				twoFactorStore.Values["starteddatetime"] = time.Now().Unix()
+				twoFactorStore.Values["rememberme"] = r.PostFormValue("rememberme") == "on"
+				twoFactorStore.Save(r, w)
 
-			if err != nil {
-				Error(w, err)
+				http.Redirect(w, r, lh.route+"/twofactor", http.StatusFound)
+				return
 			}
 
-			authSessionStore.Values["sessionuuid"] = sessionUUID
-			authSessionStore.Save(r, w)
+			if err := recordSuccessfulLogin(user.Username); err != nil {
+				logging.Error(err.Error())
+			}
 
-			logging.Debug("Updated session store with new session UUID and added created date/timestamp")
+			if err := startAuthSession(w, r, user, r.PostFormValue("rememberme") == "on"); err != nil {
+				Error(w, err)
+				return
+			}
 		} else {
+			if err := recordFailedLogin(r, r.PostFormValue("username")); err != nil {
+				logging.Error(err.Error())
+			}
+
 			authSessionStore, err := sessionsstore.Get(r, "auth")
 
 			if err != nil {
@@ -182,6 +202,56 @@ func (lh *LoginHandler) Post(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, lh.route, http.StatusFound)
 }
 
+//startAuthSession creates a new auth session for the user and stores its UUID in the client's session store,
+//remembered sessions outlive the browser being closed
+func startAuthSession(w http.ResponseWriter, r *http.Request, user *db.User, remember bool) error {
+	v4UUID, err := uuid.NewV4()
+
+	if err != nil {
+		return err
+	}
+
+	sessionUUID := v4UUID.String()
+
+	//user agents can be longer than the column, they're only shown to tell sessions apart so it doesn't matter if they're cut short
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	logging.Debug(fmt.Sprintf("Creating session of UUID: %s for user: %s of UUID: %s...", sessionUUID, user.Username, user.UUID))
+
+	authSessionsTable := db.AuthSessionsTable{}
+	err = authSessionsTable.Insert(db.Conn, &db.AuthSession{
+		CreatedDateTime:    time.Now().Unix(),
+		LastActiveDateTime: time.Now().Unix(),
+		SessionUUID:        sessionUUID,
+		UserUUID:           user.UUID,
+		IPAddress:          requestIPAddress(r),
+		UserAgent:          userAgent,
+		Remember:           remember,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	authSessionStore, err := sessionsstore.Get(r, "auth")
+
+	if err != nil {
+		return err
+	}
+
+	authSessionStore.Values["sessionuuid"] = sessionUUID
+	if remember {
+		authSessionStore.Options.MaxAge = int(currentSessionTimeouts().RememberMaxAge.Seconds())
+	}
+	authSessionStore.Save(r, w)
+
+	logging.Debug("Updated session store with new session UUID and added created date/timestamp")
+	return nil
+}
+
 func (lh *LoginHandler) mapFormToHash(w http.ResponseWriter, r *http.Request, formName string) string {
 	formSessionStore, err := sessionsstore.Get(r, "forms")
 	defer formSessionStore.Save(r, w)
@@ -226,3 +296,6 @@ func (lh *LoginHandler) HandlesGet() bool { return true }
 
 //HandlesPost retrieve whether this handler handles post requests
 func (lh *LoginHandler) HandlesPost() bool { return true }
+
+//Permission get the permission a client needs to be granted to use handler
+func (lh *LoginHandler) Permission() db.Permission { return db.PERM_NONE }
@@ -0,0 +1,342 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/plush"
+	"github.com/gorilla/mux"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/mail"
+	"github.com/tacusci/berrycms/util"
+	"github.com/tacusci/logging"
+)
+
+const (
+	//passwordResetExpiry how long a reset link can be used for after it's sent
+	passwordResetExpiry = time.Hour
+	//passwordResetsPerHour most reset links a user can be sent each hour, so the form can't be used to flood their inbox
+	passwordResetsPerHour = 3
+	//passwordResetRequestedMessage shown whether or not an account has the address, so the form doesn't reveal who has one
+	passwordResetRequestedMessage = "If an account has that email address, a link to reset its password has been sent to it"
+)
+
+var errPasswordResetUnusable = errors.New("Password reset link has expired or has already been used")
+
+//PasswordForgotHandler lets users who've forgotten their password have a reset link emailed to them
+type PasswordForgotHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (pfh *PasswordForgotHandler) Get(w http.ResponseWriter, r *http.Request) {
+	lh := LoginHandler{Router: pfh.Router}
+
+	pctx := plush.NewContext()
+	pctx.Set("formname", "passwordforgotform")
+	pctx.Set("title", "Forgot Password")
+	pctx.Set("quillenabled", false)
+	pctx.Set("formhash", lh.mapFormToHash(w, r, "passwordforgotform"))
+	pctx.Set("passwordresetenabled", mail.Enabled())
+	pctx.Set("loginerrormessage", "")
+	pctx.Set("adminhiddenpassword", "")
+	if pfh.Router.AdminHidden {
+		pctx.Set("adminhiddenpassword", fmt.Sprintf("/%s", pfh.Router.AdminHiddenPassword))
+	}
+
+	loginErrorStore, err := sessionsstore.Get(r, "passerrmsg")
+
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	if loginErrorMessage := loginErrorStore.Values["errormessage"]; loginErrorMessage != nil && loginErrorMessage != "" {
+		pctx.Set("loginerrormessage", loginErrorMessage)
+		loginErrorStore.Values["errormessage"] = ""
+		loginErrorStore.Save(r, w)
+	}
+
+	RenderDefault(w, "login.forgot.html", pctx)
+}
+
+//Post handles post requests to URI
+func (pfh *PasswordForgotHandler) Post(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	lh := LoginHandler{Router: pfh.Router}
+	if lh.fetchFormHash(w, r, r.PostFormValue("formname")) != r.PostFormValue("hashid") {
+		logging.Error("Password forgot form submitted with invalid uuid hash")
+		http.Redirect(w, r, pfh.route, http.StatusFound)
+		return
+	}
+
+	if mail.Enabled() {
+		if err := pfh.sendResetLink(strings.TrimSpace(r.PostFormValue("email"))); err != nil {
+			logging.Error(err.Error())
+		}
+	}
+
+	setLoginMessage(w, r, passwordResetRequestedMessage)
+	http.Redirect(w, r, pfh.route, http.StatusFound)
+}
+
+//sendResetLink emails a new reset link to the user with the address, if there is one and they haven't been sent too many already
+func (pfh *PasswordForgotHandler) sendResetLink(email string) error {
+	if len(email) == 0 {
+		return nil
+	}
+
+	ut := db.UsersTable{}
+	user, err := ut.SelectByEmail(db.Conn, email)
+	if err != nil {
+		return err
+	}
+
+	if len(user.UUID) == 0 {
+		logging.Debug(fmt.Sprintf("Password reset requested for unknown email address %s", email))
+		return nil
+	}
+
+	now := time.Now()
+	prst := db.PasswordResetsTable{}
+	sent, err := prst.CountSince(db.Conn, user.UUID, now.Add(-time.Hour).Unix())
+	if err != nil {
+		return err
+	}
+
+	if sent >= passwordResetsPerHour {
+		logging.Warn(fmt.Sprintf("Not sending %s another password reset link, they've been sent %d in the last hour", user.Username, sent))
+		return nil
+	}
+
+	linkBase, err := emailLinkBase()
+	if err != nil {
+		return err
+	}
+
+	token, err := util.GenerateToken(32)
+	if err != nil {
+		return err
+	}
+
+	err = prst.Insert(db.Conn, &db.PasswordReset{
+		CreatedDateTime: now.Unix(),
+		UserUUID:        user.UUID,
+		TokenHash:       util.HashToken(token),
+		ExpiresDateTime: now.Add(passwordResetExpiry).Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s%s/%s", linkBase, strings.TrimSuffix(pfh.route, "/forgot")+"/reset", token)
+	return mail.Send(mail.Message{
+		To:      user.Email,
+		Subject: fmt.Sprintf("Reset your %s password", CurrentSettings().SiteTitle),
+		Body: fmt.Sprintf("Hi %s,\n\nSomebody asked to reset the password of your account, %s. To choose a new password, go to:\n\n%s\n\n"+
+			"The link can only be used once and stops working in %s. If it wasn't you who asked, you can ignore this email and your password won't change.\n",
+			user.FirstName, user.Username, link, passwordResetExpiry),
+	})
+}
+
+//Route get URI route for handler
+func (pfh *PasswordForgotHandler) Route() string { return pfh.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (pfh *PasswordForgotHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (pfh *PasswordForgotHandler) HandlesPost() bool { return true }
+
+//Permission get the permission a client needs to be granted to use handler
+func (pfh *PasswordForgotHandler) Permission() db.Permission { return db.PERM_NONE }
+
+//PasswordResetHandler lets users with a reset link choose a new password
+type PasswordResetHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (prh *PasswordResetHandler) Get(w http.ResponseWriter, r *http.Request) {
+	pr, err := usablePasswordReset(mux.Vars(r)["token"])
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	lh := LoginHandler{Router: prh.Router}
+
+	pctx := plush.NewContext()
+	pctx.Set("formname", "passwordresetform")
+	pctx.Set("title", "Reset Password")
+	pctx.Set("quillenabled", false)
+	pctx.Set("formhash", lh.mapFormToHash(w, r, "passwordresetform"))
+	pctx.Set("submitroute", r.URL.Path)
+	pctx.Set("validlink", pr != nil)
+	pctx.Set("loginerrormessage", "")
+	pctx.Set("adminhiddenpassword", "")
+	if prh.Router.AdminHidden {
+		pctx.Set("adminhiddenpassword", fmt.Sprintf("/%s", prh.Router.AdminHiddenPassword))
+	}
+
+	loginErrorStore, err := sessionsstore.Get(r, "passerrmsg")
+
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	if loginErrorMessage := loginErrorStore.Values["errormessage"]; loginErrorMessage != nil && loginErrorMessage != "" {
+		pctx.Set("loginerrormessage", loginErrorMessage)
+		loginErrorStore.Values["errormessage"] = ""
+		loginErrorStore.Save(r, w)
+	}
+
+	RenderDefault(w, "login.reset.html", pctx)
+}
+
+//Post handles post requests to URI
+func (prh *PasswordResetHandler) Post(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	lh := LoginHandler{Router: prh.Router}
+	if lh.fetchFormHash(w, r, r.PostFormValue("formname")) != r.PostFormValue("hashid") {
+		logging.Error("Password reset form submitted with invalid uuid hash")
+		http.Redirect(w, r, r.URL.Path, http.StatusFound)
+		return
+	}
+
+	password := r.PostFormValue("authhash")
+	if len(password) == 0 || password != r.PostFormValue("repeatedauthhash") {
+		setLoginMessage(w, r, "Passwords must match and can't be blank")
+		http.Redirect(w, r, r.URL.Path, http.StatusFound)
+		return
+	}
+
+	pr, err := usablePasswordReset(mux.Vars(r)["token"])
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	if pr == nil {
+		setLoginMessage(w, r, errPasswordResetUnusable.Error())
+		http.Redirect(w, r, r.URL.Path, http.StatusFound)
+		return
+	}
+
+	err = db.WithTransaction(db.Conn, func(tx *sql.Tx) error {
+		//marking the reset used is what stops the link working twice, even if it's submitted twice at once
+		prst := db.PasswordResetsTable{}
+		used, err := prst.Use(tx, pr, time.Now().Unix())
+		if err != nil {
+			return err
+		}
+
+		if !used {
+			return errPasswordResetUnusable
+		}
+
+		ut := db.UsersTable{}
+		user, err := ut.SelectByUUID(tx, pr.UserUUID)
+		if err != nil {
+			return err
+		}
+
+		return ut.ResetPassword(tx, user, util.HashAndSalt([]byte(password)), user.UUID, time.Now().Unix())
+	})
+
+	if err == errPasswordResetUnusable {
+		setLoginMessage(w, r, err.Error())
+		http.Redirect(w, r, r.URL.Path, http.StatusFound)
+		return
+	}
+
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	logging.Info(fmt.Sprintf("Password of user %s reset with an emailed link", pr.UserUUID))
+
+	setLoginMessage(w, r, "Your password has been changed, login with your new one")
+	http.Redirect(w, r, strings.TrimSuffix(prh.route, "/reset/{token}"), http.StatusFound)
+}
+
+//usablePasswordReset finds the reset the link's token is for, nil if there isn't one which can still be used
+func usablePasswordReset(token string) (*db.PasswordReset, error) {
+	if len(token) == 0 {
+		return nil, nil
+	}
+
+	prst := db.PasswordResetsTable{}
+	pr, err := prst.SelectByTokenHash(db.Conn, util.HashToken(token))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !pr.IsUsable(time.Now().Unix()) {
+		return nil, nil
+	}
+
+	return pr, nil
+}
+
+//setLoginMessage message to show on the next login page the client loads
+func setLoginMessage(w http.ResponseWriter, r *http.Request, message string) {
+	loginErrorStore, err := sessionsstore.Get(r, "passerrmsg")
+	if err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	loginErrorStore.Values["errormessage"] = message
+	loginErrorStore.Save(r, w)
+}
+
+//Route get URI route for handler
+func (prh *PasswordResetHandler) Route() string { return prh.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (prh *PasswordResetHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (prh *PasswordResetHandler) HandlesPost() bool { return true }
+
+//Permission get the permission a client needs to be granted to use handler
+func (prh *PasswordResetHandler) Permission() db.Permission { return db.PERM_NONE }
@@ -0,0 +1,301 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/mail"
+	"github.com/tacusci/berrycms/util"
+)
+
+const handlerRouteLogin string = "/login"
+const handlerRoutePasswordForgot string = "/login/forgot"
+const handlerRoutePasswordReset string = "/login/reset/{token}"
+
+//resetTestUser loads the user with the username, creating them first if they don't exist yet
+func resetTestUser(t *testing.T, username string, password string) *db.User {
+	ut := db.UsersTable{}
+	user, err := ut.SelectByUsername(db.Conn, username)
+	if err != nil {
+		t.Fatalf("Error loading test user: %v", err)
+	}
+
+	if len(user.UUID) > 0 {
+		return user
+	}
+
+	err = ut.Insert(db.Conn, &db.User{
+		Username:        username,
+		CreatedDateTime: time.Now().Unix(),
+		Email:           username + "@local.com",
+		UserroleId:      int(db.REG_USER),
+		FirstName:       "Reset",
+		LastName:        "User",
+		AuthHash:        util.HashAndSalt([]byte(password)),
+	})
+	if err != nil {
+		t.Fatalf("Error inserting test user: %v", err)
+	}
+
+	user, err = ut.SelectByUsername(db.Conn, username)
+	if err != nil || len(user.UUID) == 0 {
+		t.Fatalf("Test user wasn't created: %v", err)
+	}
+	return user
+}
+
+//sendTestPasswordReset gives the user a reset which expires at the given time, returning the token for its link
+func sendTestPasswordReset(t *testing.T, user *db.User, expires time.Time) string {
+	token, err := util.GenerateToken(32)
+	if err != nil {
+		t.Fatalf("Error generating reset token: %v", err)
+	}
+
+	prst := db.PasswordResetsTable{}
+	err = prst.Insert(db.Conn, &db.PasswordReset{
+		CreatedDateTime: time.Now().Unix(),
+		UserUUID:        user.UUID,
+		TokenHash:       util.HashToken(token),
+		ExpiresDateTime: expires.Unix(),
+	})
+	if err != nil {
+		t.Fatalf("Error inserting password reset: %v", err)
+	}
+	return token
+}
+
+//formPostRequest builds a post of the form which carries the hash and cookie the form's page would have given the client
+func formPostRequest(route string, formName string, formValues url.Values, vars map[string]string) *http.Request {
+	lh := LoginHandler{Router: &MutableRouter{}}
+	formRecorder := httptest.NewRecorder()
+	formValues.Set("formname", formName)
+	formValues.Set("hashid", lh.mapFormToHash(formRecorder, httptest.NewRequest("GET", route, nil), formName))
+
+	req := httptest.NewRequest("POST", route, strings.NewReader(formValues.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, cookie := range formRecorder.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	return mux.SetURLVars(req, vars)
+}
+
+//loginMessageOf the message the response has left to show on the next login page
+func loginMessageOf(resp *http.Response) string {
+	req := httptest.NewRequest("GET", handlerRouteLogin, nil)
+	for _, cookie := range resp.Cookies() {
+		req.AddCookie(cookie)
+	}
+
+	loginErrorStore, err := sessionsstore.Get(req, "passerrmsg")
+	if err != nil {
+		return ""
+	}
+
+	message, _ := loginErrorStore.Values["errormessage"].(string)
+	return message
+}
+
+//postPasswordReset submits the reset form for the token with the passwords
+func postPasswordReset(token string, password string, repeatedPassword string) *http.Response {
+	prh := PasswordResetHandler{
+		Router: &MutableRouter{},
+		route:  handlerRoutePasswordReset,
+	}
+
+	formValues := url.Values{}
+	formValues.Set("authhash", password)
+	formValues.Set("repeatedauthhash", repeatedPassword)
+
+	responseRecorder := httptest.NewRecorder()
+	prh.Post(responseRecorder, formPostRequest("/login/reset/"+token, "passwordresetform", formValues, map[string]string{"token": token}))
+	return responseRecorder.Result()
+}
+
+//passwordIs whether the user's saved password is the one given
+func passwordIs(user *db.User, password string) bool {
+	login := db.User{Username: user.Username, AuthHash: password}
+	return login.Login()
+}
+
+func TestPasswordResetPost(t *testing.T) {
+	user := resetTestUser(t, "resetuser", "oldpassword")
+	token := sendTestPasswordReset(t, user, time.Now().Add(time.Hour))
+
+	resp := postPasswordReset(token, "newpassword", "newpassword")
+
+	if resp.StatusCode != http.StatusFound {
+		t.Errorf("Test password reset post didn't redirect request, STATUS CODE: %d", resp.StatusCode)
+	}
+
+	if location := resp.Header.Get("Location"); location != handlerRouteLogin {
+		t.Errorf("Test password reset post redirected to %s instead of the login page", location)
+	}
+
+	if !passwordIs(user, "newpassword") {
+		t.Errorf("Test password reset post didn't change the user's password")
+	}
+}
+
+func TestPasswordResetPostReusedToken(t *testing.T) {
+	user := resetTestUser(t, "reuseduser", "oldpassword")
+	token := sendTestPasswordReset(t, user, time.Now().Add(time.Hour))
+
+	if resp := postPasswordReset(token, "firstpassword", "firstpassword"); resp.Header.Get("Location") != handlerRouteLogin {
+		t.Fatalf("Test password reset post with a new token wasn't accepted")
+	}
+
+	resp := postPasswordReset(token, "secondpassword", "secondpassword")
+
+	if message := loginMessageOf(resp); message != errPasswordResetUnusable.Error() {
+		t.Errorf("Test password reset post with a used token wasn't rejected, message: %s", message)
+	}
+
+	if !passwordIs(user, "firstpassword") {
+		t.Errorf("Test password reset post with a used token changed the user's password")
+	}
+}
+
+func TestPasswordResetPostExpiredToken(t *testing.T) {
+	user := resetTestUser(t, "expireduser", "oldpassword")
+	token := sendTestPasswordReset(t, user, time.Now().Add(-time.Minute))
+
+	resp := postPasswordReset(token, "newpassword", "newpassword")
+
+	if message := loginMessageOf(resp); message != errPasswordResetUnusable.Error() {
+		t.Errorf("Test password reset post with an expired token wasn't rejected, message: %s", message)
+	}
+
+	if !passwordIs(user, "oldpassword") {
+		t.Errorf("Test password reset post with an expired token changed the user's password")
+	}
+}
+
+func TestPasswordResetPostMismatchedPasswords(t *testing.T) {
+	user := resetTestUser(t, "mismatcheduser", "oldpassword")
+	token := sendTestPasswordReset(t, user, time.Now().Add(time.Hour))
+
+	resp := postPasswordReset(token, "newpassword", "otherpassword")
+
+	if message := loginMessageOf(resp); message != "Passwords must match and can't be blank" {
+		t.Errorf("Test password reset post with mismatched passwords wasn't rejected, message: %s", message)
+	}
+
+	if !passwordIs(user, "oldpassword") {
+		t.Errorf("Test password reset post with mismatched passwords changed the user's password")
+	}
+
+	//the link should still work once the passwords are typed the same
+	if resp := postPasswordReset(token, "newpassword", "newpassword"); resp.Header.Get("Location") != handlerRouteLogin {
+		t.Errorf("Test password reset post with mismatched passwords used up the token")
+	}
+}
+
+func TestPasswordResetPostClearsSessions(t *testing.T) {
+	user := resetTestUser(t, "sessionsuser", "oldpassword")
+
+	ast := db.AuthSessionsTable{}
+	err := ast.Insert(db.Conn, &db.AuthSession{
+		CreatedDateTime:    time.Now().Unix(),
+		LastActiveDateTime: time.Now().Unix(),
+		UserUUID:           user.UUID,
+		SessionUUID:        "resetsessionuuid",
+		IPAddress:          "127.0.0.1",
+		UserAgent:          "test",
+	})
+	if err != nil {
+		t.Fatalf("Error inserting test session: %v", err)
+	}
+
+	token := sendTestPasswordReset(t, user, time.Now().Add(time.Hour))
+	postPasswordReset(token, "newpassword", "newpassword")
+
+	sessions, err := ast.SelectByUserUUID(db.Conn, user.UUID)
+	if err != nil {
+		t.Fatalf("Error loading test user's sessions: %v", err)
+	}
+
+	if len(sessions) > 0 {
+		t.Errorf("Test password reset post left the user with %d sessions", len(sessions))
+	}
+}
+
+func TestPasswordForgotPostUnknownEmail(t *testing.T) {
+	mailDir, err := ioutil.TempDir("", "berrycmsmail")
+	if err != nil {
+		t.Fatalf("Error creating mail directory: %v", err)
+	}
+	defer os.RemoveAll(mailDir)
+
+	if err := mail.Configure(mail.Settings{Transport: mail.TransportFile, From: "berrycms@localhost", Dir: mailDir}); err != nil {
+		t.Fatalf("Error configuring mail: %v", err)
+	}
+	defer mail.Configure(mail.DefaultSettings)
+
+	previousSettings := CurrentSettings()
+	settings := previousSettings
+	settings.BaseURL = "https://berrycms.local"
+	setCurrentSettings(settings)
+	defer setCurrentSettings(previousSettings)
+
+	user := resetTestUser(t, "forgotuser", "oldpassword")
+
+	postPasswordForgot := func(email string) *http.Response {
+		pfh := PasswordForgotHandler{
+			Router: &MutableRouter{},
+			route:  handlerRoutePasswordForgot,
+		}
+
+		formValues := url.Values{}
+		formValues.Set("email", email)
+
+		responseRecorder := httptest.NewRecorder()
+		pfh.Post(responseRecorder, formPostRequest(handlerRoutePasswordForgot, "passwordforgotform", formValues, nil))
+		return responseRecorder.Result()
+	}
+
+	knownResp := postPasswordForgot(user.Email)
+	unknownResp := postPasswordForgot("nobody@local.com")
+
+	if knownResp.StatusCode != unknownResp.StatusCode {
+		t.Errorf("Test password forgot post responded %d to a known email and %d to an unknown one", knownResp.StatusCode, unknownResp.StatusCode)
+	}
+
+	if knownResp.Header.Get("Location") != unknownResp.Header.Get("Location") {
+		t.Errorf("Test password forgot post redirected a known email to %s and an unknown one to %s", knownResp.Header.Get("Location"), unknownResp.Header.Get("Location"))
+	}
+
+	if loginMessageOf(knownResp) != loginMessageOf(unknownResp) {
+		t.Errorf("Test password forgot post showed a known email \"%s\" and an unknown one \"%s\"", loginMessageOf(knownResp), loginMessageOf(unknownResp))
+	}
+
+	sentMail, err := ioutil.ReadDir(mailDir)
+	if err != nil {
+		t.Fatalf("Error reading mail directory: %v", err)
+	}
+
+	if len(sentMail) != 1 {
+		t.Errorf("Test password forgot post sent %d emails, only the known email should have been sent one", len(sentMail))
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/logging"
+)
+
+const (
+	//loginAttemptWindow how far back failed login attempts count towards backoff, lockout and throttling
+	loginAttemptWindow = 15 * time.Minute
+	//loginBackoffAfter number of failed attempts for a username before each further attempt has to wait
+	loginBackoffAfter = 3
+	//loginMaxBackoff longest a username has to wait between attempts before it gets locked
+	loginMaxBackoff = time.Minute
+	//accountLockAfter number of failed attempts for a username before the account gets locked
+	accountLockAfter = 10
+	//accountLockDuration how long the first lock of an account lasts, each lock within a day lasts twice as long as the last
+	accountLockDuration = 15 * time.Minute
+	//accountMaxLockDuration longest an account can be locked for without a user clearing it
+	accountMaxLockDuration = 24 * time.Hour
+	//ipThrottleAfter number of failed attempts from a single IP address before it can't try any more
+	ipThrottleAfter = 30
+)
+
+//loginThrottledMessage deliberately doesn't say whether the username exists
+const loginThrottledMessage = "Too many failed login attempts, please try again later..."
+
+//requestIPAddress gets the IP address of the client, headers like X-Forwarded-For aren't used as they can be set by anyone
+func requestIPAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+//loginAllowed checks whether a login attempt as the username from the client's IP address can be made right now
+func loginAllowed(r *http.Request, username string) (bool, error) {
+	now := time.Now()
+	windowStart := now.Add(-loginAttemptWindow).Unix()
+
+	lat := db.LoginAttemptsTable{}
+	ipAddress := requestIPAddress(r)
+	ipFailures, _, err := lat.FailuresByIPAddressSince(db.Conn, ipAddress, windowStart)
+	if err != nil {
+		return false, err
+	}
+
+	if ipFailures >= ipThrottleAfter {
+		logging.Warn(fmt.Sprintf("Throttling login attempt from %s after %d failures", ipAddress, ipFailures))
+		return false, nil
+	}
+
+	ut := db.UsersTable{}
+	user, err := ut.SelectByUsername(db.Conn, username)
+	if err != nil {
+		return false, err
+	}
+
+	if len(user.UUID) > 0 {
+		alt := db.AccountLocksTable{}
+		lockedUntil, err := alt.ActiveLockUntil(db.Conn, user.UUID, now.Unix())
+		if err != nil {
+			return false, err
+		}
+		if lockedUntil > 0 {
+			logging.Warn(fmt.Sprintf("Rejecting login attempt as locked user %s from %s", username, ipAddress))
+			return false, nil
+		}
+	}
+
+	usernameFailures, latestFailure, err := lat.FailuresByUsernameSince(db.Conn, username, windowStart)
+	if err != nil {
+		return false, err
+	}
+
+	if usernameFailures >= loginBackoffAfter {
+		if now.Before(time.Unix(latestFailure, 0).Add(loginBackoff(usernameFailures))) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+//loginBackoff how long to wait after the latest failure before trying again, doubling with each failure
+func loginBackoff(failures int) time.Duration {
+	return doubleUpTo(time.Second, failures-loginBackoffAfter, loginMaxBackoff)
+}
+
+//doubleUpTo doubles the duration the given number of times, stopping at the limit
+func doubleUpTo(d time.Duration, times int, limit time.Duration) time.Duration {
+	for i := 0; i < times && d < limit; i++ {
+		d *= 2
+	}
+	if d > limit {
+		return limit
+	}
+	return d
+}
+
+//recordFailedLogin stores the failed attempt and locks the account if it's had too many
+func recordFailedLogin(r *http.Request, username string) error {
+	now := time.Now()
+	ipAddress := requestIPAddress(r)
+
+	lat := db.LoginAttemptsTable{}
+	err := lat.Insert(db.Conn, &db.LoginAttempt{
+		CreatedDateTime: now.Unix(),
+		Username:        username,
+		IPAddress:       ipAddress,
+	})
+	if err != nil {
+		return err
+	}
+
+	failures, _, err := lat.FailuresByUsernameSince(db.Conn, username, now.Add(-loginAttemptWindow).Unix())
+	if err != nil {
+		return err
+	}
+
+	if failures < accountLockAfter {
+		return nil
+	}
+
+	ut := db.UsersTable{}
+	user, err := ut.SelectByUsername(db.Conn, username)
+	if err != nil || len(user.UUID) == 0 {
+		return err
+	}
+
+	alt := db.AccountLocksTable{}
+	previousLocks, err := alt.CountSince(db.Conn, user.UUID, now.Add(-24*time.Hour).Unix())
+	if err != nil {
+		return err
+	}
+
+	lockDuration := doubleUpTo(accountLockDuration, previousLocks, accountMaxLockDuration)
+
+	logging.Warn(fmt.Sprintf("Locking user %s for %s after %d failed login attempts, latest from %s", username, lockDuration, failures, ipAddress))
+
+	err = alt.Insert(db.Conn, &db.AccountLock{
+		CreatedDateTime: now.Unix(),
+		UserUUID:        user.UUID,
+		IPAddress:       ipAddress,
+		LockedUntil:     now.Add(lockDuration).Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	//the lock itself takes over, the next lock is judged on fresh failures after this one ends
+	_, err = lat.DeleteByUsername(db.Conn, username)
+	return err
+}
+
+//recordSuccessfulLogin forgets the username's failed attempts
+func recordSuccessfulLogin(username string) error {
+	lat := db.LoginAttemptsTable{}
+	_, err := lat.DeleteByUsername(db.Conn, username)
+	return err
+}
@@ -0,0 +1,244 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gobuffalo/plush"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/util"
+	"github.com/tacusci/logging"
+)
+
+//twoFactorLoginTimeout how long after getting the password right the second login step has to be completed in
+const twoFactorLoginTimeout = 5 * time.Minute
+
+//LoginTwoFactorHandler second login step for users with two factor authentication enabled
+type LoginTwoFactorHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (ltfh *LoginTwoFactorHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if ltfh.pendingUser(r) == nil {
+		http.Redirect(w, r, ltfh.loginRoute(), http.StatusFound)
+		return
+	}
+
+	lh := LoginHandler{Router: ltfh.Router}
+
+	pctx := plush.NewContext()
+	pctx.Set("formname", "logintwofactorform")
+	pctx.Set("title", "Dashboard Login")
+	pctx.Set("quillenabled", false)
+	pctx.Set("formhash", lh.mapFormToHash(w, r, "logintwofactorform"))
+	pctx.Set("loginerrormessage", "")
+	pctx.Set("adminhiddenpassword", "")
+	if ltfh.Router.AdminHidden {
+		pctx.Set("adminhiddenpassword", fmt.Sprintf("/%s", ltfh.Router.AdminHiddenPassword))
+	}
+
+	loginErrorStore, err := sessionsstore.Get(r, "passerrmsg")
+
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	if loginErrorMessage := loginErrorStore.Values["errormessage"]; loginErrorMessage != nil && loginErrorMessage != "" {
+		pctx.Set("loginerrormessage", loginErrorMessage)
+		loginErrorStore.Values["errormessage"] = ""
+		loginErrorStore.Save(r, w)
+	}
+
+	RenderDefault(w, "login.twofactor.html", pctx)
+}
+
+//Post handles post requests to URI
+func (ltfh *LoginTwoFactorHandler) Post(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	lh := LoginHandler{Router: ltfh.Router}
+	if lh.fetchFormHash(w, r, r.PostFormValue("formname")) != r.PostFormValue("hashid") {
+		logging.Error("Two factor login form submitted with invalid uuid hash")
+		http.Redirect(w, r, ltfh.route, http.StatusFound)
+		return
+	}
+
+	user := ltfh.pendingUser(r)
+	if user == nil {
+		http.Redirect(w, r, ltfh.loginRoute(), http.StatusFound)
+		return
+	}
+
+	//codes are guessed far more easily than passwords, so they count towards the same lockout
+	allowed, err := loginAllowed(r, user.Username)
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	if !allowed {
+		ltfh.clearPendingUser(w, r)
+		ltfh.setErrorMessage(w, r, loginThrottledMessage)
+		http.Redirect(w, r, ltfh.loginRoute(), http.StatusFound)
+		return
+	}
+
+	verified, err := verifyTwoFactorCode(user, r.PostFormValue("code"))
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	if !verified {
+		logging.Debug("Two factor login unsuccessful...")
+
+		if err := recordFailedLogin(r, user.Username); err != nil {
+			logging.Error(err.Error())
+		}
+
+		ltfh.setErrorMessage(w, r, "Authentication code incorrect...")
+		http.Redirect(w, r, ltfh.route, http.StatusFound)
+		return
+	}
+
+	remember := ltfh.pendingRememberMe(r)
+	ltfh.clearPendingUser(w, r)
+
+	if err := recordSuccessfulLogin(user.Username); err != nil {
+		logging.Error(err.Error())
+	}
+
+	if err := startAuthSession(w, r, user, remember); err != nil {
+		Error(w, err)
+		return
+	}
+
+	http.Redirect(w, r, ltfh.loginRoute(), http.StatusFound)
+}
+
+//pendingUser get the user who has passed the first login step within the timeout, nil if there isn't one
+func (ltfh *LoginTwoFactorHandler) pendingUser(r *http.Request) *db.User {
+	twoFactorStore, err := sessionsstore.Get(r, "twofactor")
+	if err != nil {
+		return nil
+	}
+
+	userUUID, ok := twoFactorStore.Values["useruuid"].(string)
+	if !ok || len(userUUID) == 0 {
+		return nil
+	}
+
+	startedDateTime, ok := twoFactorStore.Values["starteddatetime"].(int64)
+	if !ok || time.Since(time.Unix(startedDateTime, 0)) > twoFactorLoginTimeout {
+		return nil
+	}
+
+	ut := db.UsersTable{}
+	user, err := ut.SelectByUUID(db.Conn, userUUID)
+	if err != nil || len(user.UUID) == 0 {
+		return nil
+	}
+
+	return user
+}
+
+//pendingRememberMe whether "remember me" was ticked in the first login step
+func (ltfh *LoginTwoFactorHandler) pendingRememberMe(r *http.Request) bool {
+	twoFactorStore, err := sessionsstore.Get(r, "twofactor")
+	if err != nil {
+		return false
+	}
+
+	remember, ok := twoFactorStore.Values["rememberme"].(bool)
+	return ok && remember
+}
+
+func (ltfh *LoginTwoFactorHandler) clearPendingUser(w http.ResponseWriter, r *http.Request) {
+	twoFactorStore, err := sessionsstore.Get(r, "twofactor")
+	if err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	twoFactorStore.Values["useruuid"] = ""
+	twoFactorStore.Options.MaxAge = -1
+	twoFactorStore.Save(r, w)
+}
+
+func (ltfh *LoginTwoFactorHandler) setErrorMessage(w http.ResponseWriter, r *http.Request, message string) {
+	loginErrorStore, err := sessionsstore.Get(r, "passerrmsg")
+	if err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	loginErrorStore.Values["errormessage"] = message
+	loginErrorStore.Save(r, w)
+}
+
+func (ltfh *LoginTwoFactorHandler) loginRoute() string {
+	if ltfh.Router.AdminHidden {
+		return fmt.Sprintf("/%s/login", ltfh.Router.AdminHiddenPassword)
+	}
+	return "/login"
+}
+
+//verifyTwoFactorCode checks the code is either the user's current TOTP code or one of their unused recovery codes
+func verifyTwoFactorCode(user *db.User, code string) (bool, error) {
+	utft := db.UserTwoFactorTable{}
+	twoFactor, err := utft.SelectByUserUUID(db.Conn, user.UUID)
+	if err != nil {
+		return false, err
+	}
+
+	if twoFactor == nil || !twoFactor.Enabled {
+		return false, nil
+	}
+
+	if step, ok := util.ValidateTOTP(twoFactor.Secret, code, time.Now()); ok {
+		//a code that's already been used can't be replayed, even if it's still within its time window
+		if step <= twoFactor.LastUsedStep {
+			return false, nil
+		}
+		twoFactor.LastUsedStep = step
+		return true, utft.Update(db.Conn, twoFactor)
+	}
+
+	rct := db.RecoveryCodesTable{}
+	return rct.Use(db.Conn, user.UUID, util.HashToken(util.NormaliseRecoveryCode(code)))
+}
+
+//Route get URI route for handler
+func (ltfh *LoginTwoFactorHandler) Route() string { return ltfh.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (ltfh *LoginTwoFactorHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (ltfh *LoginTwoFactorHandler) HandlesPost() bool { return true }
+
+//Permission get the permission a client needs to be granted to use handler
+func (ltfh *LoginTwoFactorHandler) Permission() db.Permission { return db.PERM_NONE }
@@ -79,3 +79,6 @@ func (lh *LogoutHandler) HandlesGet() bool { return false }
 
 //HandlesPost retrieve whether this handler handles post requests
 func (lh *LogoutHandler) HandlesPost() bool { return true }
+
+//Permission get the permission a client needs to be granted to use handler
+func (lh *LogoutHandler) Permission() db.Permission { return db.PERM_NONE }
@@ -0,0 +1,57 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/logging"
+)
+
+const pageSchedulerInterval = time.Second * 30
+
+//SchedulePages start checking every 30 seconds for scheduled pages which need publishing or unpublishing
+func SchedulePages(mr *MutableRouter, stop *chan bool) {
+	ticker := time.NewTicker(pageSchedulerInterval)
+	defer ticker.Stop()
+
+	pt := db.PagesTable{}
+	for {
+		select {
+		case <-*stop:
+			return
+		case <-ticker.C:
+			now := time.Now().Unix()
+
+			numPublished, err := pt.PublishScheduled(db.Conn, now)
+			if err != nil {
+				logging.Error(err.Error())
+			}
+
+			numUnpublished, err := pt.UnpublishExpired(db.Conn, now)
+			if err != nil {
+				logging.Error(err.Error())
+			}
+
+			//only remap page routes if something has actually changed
+			if numPublished > 0 || numUnpublished > 0 {
+				logging.Info(fmt.Sprintf("Published %d and unpublished %d scheduled pages, reloading routes...", numPublished, numUnpublished))
+				mr.Reload()
+			}
+		}
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gobuffalo/plush"
+	"github.com/gorilla/mux"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/mail"
+	"github.com/tacusci/berrycms/util"
+	"github.com/tacusci/logging"
+)
+
+//registrationVerifyExpiry how long the emailed link to verify a registration's address can be used for
+const registrationVerifyExpiry = 24 * time.Hour
+
+//registrationAvailable visitors can only register when it's been allowed and their address can be verified by an emailed link
+func registrationAvailable() bool {
+	settings := CurrentSettings()
+	return settings.RegistrationOpen && len(settings.BaseURL) > 0 && mail.Enabled()
+}
+
+//RegisterHandler lets visitors sign up for an account, which admins approve once the email address is verified
+type RegisterHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (rh *RegisterHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if !registrationAvailable() {
+		fourOhFour(w, r)
+		return
+	}
+
+	lh := LoginHandler{Router: rh.Router}
+
+	pctx := plush.NewContext()
+	pctx.Set("formname", "registerform")
+	pctx.Set("title", "Register")
+	pctx.Set("quillenabled", false)
+	pctx.Set("formhash", lh.mapFormToHash(w, r, "registerform"))
+	pctx.Set("loginerrormessage", "")
+	pctx.Set("adminhiddenpassword", "")
+	if rh.Router.AdminHidden {
+		pctx.Set("adminhiddenpassword", fmt.Sprintf("/%s", rh.Router.AdminHiddenPassword))
+	}
+
+	loginErrorStore, err := sessionsstore.Get(r, "passerrmsg")
+
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	if loginErrorMessage := loginErrorStore.Values["errormessage"]; loginErrorMessage != nil && loginErrorMessage != "" {
+		pctx.Set("loginerrormessage", loginErrorMessage)
+		loginErrorStore.Values["errormessage"] = ""
+		loginErrorStore.Save(r, w)
+	}
+
+	RenderDefault(w, "register.html", pctx)
+}
+
+//Post handles post requests to URI
+func (rh *RegisterHandler) Post(w http.ResponseWriter, r *http.Request) {
+	if !registrationAvailable() {
+		fourOhFour(w, r)
+		return
+	}
+
+	err := r.ParseForm()
+
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	lh := LoginHandler{Router: rh.Router}
+	if lh.fetchFormHash(w, r, r.PostFormValue("formname")) != r.PostFormValue("hashid") {
+		logging.Error("Register form submitted with invalid uuid hash")
+		http.Redirect(w, r, rh.route, http.StatusFound)
+		return
+	}
+
+	defer http.Redirect(w, r, rh.route, http.StatusFound)
+
+	if validated, err := validatePostForm(r); err != nil || !validated {
+		setLoginMessage(w, r, err.Error())
+		return
+	}
+
+	if len(r.PostFormValue("authhash")) == 0 {
+		setLoginMessage(w, r, "Password can't be blank")
+		return
+	}
+
+	message, err := rh.register(r)
+	if err != nil {
+		logging.Error(err.Error())
+		message = "Unable to register right now, please try again later"
+	}
+
+	setLoginMessage(w, r, message)
+}
+
+//register stores the registration and emails the link to verify its address, returning the message to show the visitor
+func (rh *RegisterHandler) register(r *http.Request) (string, error) {
+	username := r.PostFormValue("username")
+	email := r.PostFormValue("email")
+
+	ut := db.UsersTable{}
+	existingUser, err := ut.SelectByUsername(db.Conn, username)
+	if err != nil {
+		return "", err
+	}
+
+	if len(existingUser.UUID) == 0 {
+		existingUser, err = ut.SelectByEmail(db.Conn, email)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	rt := db.RegistrationsTable{}
+	taken, err := rt.Taken(db.Conn, username, email)
+	if err != nil {
+		return "", err
+	}
+
+	if taken || len(existingUser.UUID) > 0 {
+		return "Somebody has already registered with that username or email address", nil
+	}
+
+	linkBase, err := emailLinkBase()
+	if err != nil {
+		return "", err
+	}
+
+	token, err := util.GenerateToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	reg := &db.Registration{
+		CreatedDateTime: now.Unix(),
+		Username:        username,
+		Email:           email,
+		FirstName:       r.PostFormValue("firstname"),
+		LastName:        r.PostFormValue("lastname"),
+		AuthHash:        util.HashAndSalt([]byte(r.PostFormValue("authhash"))),
+		TokenHash:       util.HashToken(token),
+		ExpiresDateTime: now.Add(registrationVerifyExpiry).Unix(),
+	}
+	if err := rt.Insert(db.Conn, reg); err != nil {
+		return "", err
+	}
+
+	err = mail.Send(mail.Message{
+		To:      email,
+		Subject: fmt.Sprintf("Verify your email address for %s", CurrentSettings().SiteTitle),
+		Body: fmt.Sprintf("Hi %s,\n\nThanks for registering the account %s. To verify your email address, go to:\n\n%s%s/verify/%s\n\n"+
+			"The link stops working in %s. Once your address is verified an administrator will review your registration. "+
+			"If it wasn't you who registered, you can ignore this email.\n",
+			reg.FirstName, username, linkBase, rh.route, token, registrationVerifyExpiry),
+	})
+	if err != nil {
+		//without the link the registration could never be verified, so it shouldn't stop the address being used again
+		rt.DeleteByID(db.Conn, reg.Registrationid)
+		return "", err
+	}
+
+	logging.Info(fmt.Sprintf("Visitor registered account %s, waiting for email verification", username))
+	return "Check your email for a link to verify your address, you can login once an administrator has approved your account", nil
+}
+
+//Route get URI route for handler
+func (rh *RegisterHandler) Route() string { return rh.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (rh *RegisterHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (rh *RegisterHandler) HandlesPost() bool { return true }
+
+//Permission get the permission a client needs to be granted to use handler
+func (rh *RegisterHandler) Permission() db.Permission { return db.PERM_NONE }
+
+//RegisterVerifyHandler verifies the email address of a registration from the emailed link
+type RegisterVerifyHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (rvh *RegisterVerifyHandler) Get(w http.ResponseWriter, r *http.Request) {
+	rt := db.RegistrationsTable{}
+	verified, err := rt.Verify(db.Conn, util.HashToken(mux.Vars(r)["token"]), time.Now().Unix())
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	pctx := plush.NewContext()
+	pctx.Set("title", "Verify Email Address")
+	pctx.Set("quillenabled", false)
+	pctx.Set("verified", verified)
+	pctx.Set("adminhiddenpassword", "")
+	if rvh.Router.AdminHidden {
+		pctx.Set("adminhiddenpassword", fmt.Sprintf("/%s", rvh.Router.AdminHiddenPassword))
+	}
+
+	RenderDefault(w, "register.verify.html", pctx)
+}
+
+func (rvh *RegisterVerifyHandler) Post(w http.ResponseWriter, r *http.Request) {}
+
+//Route get URI route for handler
+func (rvh *RegisterVerifyHandler) Route() string { return rvh.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (rvh *RegisterVerifyHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (rvh *RegisterVerifyHandler) HandlesPost() bool { return false }
+
+//Permission get the permission a client needs to be granted to use handler
+func (rvh *RegisterVerifyHandler) Permission() db.Permission { return db.PERM_NONE }
@@ -17,6 +17,7 @@ package web
 import (
 	"net/http"
 
+	"github.com/tacusci/berrycms/db"
 	"github.com/tacusci/berrycms/robots"
 )
 
@@ -45,3 +46,6 @@ func (rh *RobotsHandler) HandlesGet() bool { return true }
 
 //HandlesPost retrieve whether this handler handles post requests
 func (rh *RobotsHandler) HandlesPost() bool { return false }
+
+//Permission get the permission a client needs to be granted to use handler
+func (rh *RobotsHandler) Permission() db.Permission { return db.PERM_NONE }
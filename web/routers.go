@@ -16,6 +16,7 @@ package web
 
 import (
 	"bytes"
+	"database/sql"
 	"fmt"
 	"html/template"
 	"io/ioutil"
@@ -32,6 +33,7 @@ import (
 	"github.com/tacusci/berrycms/db"
 	"github.com/tacusci/berrycms/plugins"
 	"github.com/tacusci/berrycms/robots"
+	"github.com/tacusci/berrycms/sitemap"
 	"github.com/tacusci/berrycms/util"
 	"github.com/tacusci/logging"
 )
@@ -45,8 +47,7 @@ type MutableRouter struct {
 	AdminHidden         bool
 	AdminHiddenPassword string
 	ActivityLogLoc      string
-	NoRobots            bool
-	NoSitemap           bool
+	SettingsOverride    func(*db.Settings)
 	CpuProfile          bool
 	staticwatcher       *watcher.Watcher
 	pluginswatcher      *watcher.Watcher
@@ -61,17 +62,47 @@ func (mr *MutableRouter) Swap(root *mux.Router) {
 	mr.Server.Handler = mr.Root
 }
 
+//ApplySettings loads the site settings from the DB, overrides them with any given on the command line and puts them into effect
+func (mr *MutableRouter) ApplySettings() error {
+	st := db.SettingsTable{}
+	settings, err := st.Select(db.Conn)
+	if err != nil {
+		return err
+	}
+
+	if mr.SettingsOverride != nil {
+		mr.SettingsOverride(settings)
+	}
+
+	if err := SetSessionTimeouts(sessionTimeoutsOf(*settings)); err != nil {
+		return err
+	}
+
+	setCurrentSettings(*settings)
+	return nil
+}
+
 //Reload map all admin/default page routes and load saved page routes from DB
 func (mr *MutableRouter) Reload() {
 
-	if !mr.NoRobots {
+	//carry on with the settings already in effect if the new ones can't be used
+	if err := mr.ApplySettings(); err != nil {
+		logging.Error(fmt.Sprintf("Unable to apply site settings: %s", err.Error()))
+	}
+
+	if CurrentSettings().RobotsEnabled {
 		//creates a robot string and loads into in-memory cache
 		err := robots.Generate(mr.AdminOff)
 		if err != nil {
 			logging.Error(err.Error())
 		}
+	} else {
+		robots.Invalidate()
 	}
 
+	//page routes may have changed, so the sitemap will need to be rebuilt
+	sitemap.Invalidate()
+
 	if mr.staticwatcher != nil {
 		mr.staticwatcher.Close()
 	}
@@ -106,15 +137,22 @@ func (mr *MutableRouter) Reload() {
 		for _, handler := range GetDefaultHandlers(mr) {
 			if handler.HandlesGet() {
 				logging.Debug(fmt.Sprintf("Mapping default GET route %s", handler.Route()))
-				r.HandleFunc(handler.Route(), handler.Get).Methods("GET")
+				r.HandleFunc(handler.Route(), mr.requirePermission(handler.Permission(), handler.Get)).Methods("GET")
 			}
 
 			if handler.HandlesPost() {
 				logging.Debug(fmt.Sprintf("Mapping default POST route %s", handler.Route()))
-				r.HandleFunc(handler.Route(), handler.Post).Methods("POST")
+				r.HandleFunc(handler.Route(), mr.requirePermission(handler.Permission(), handler.Post)).Methods("POST")
 			}
 		}
 
+		logging.Debug("Mapping JSON API routes...")
+
+		for _, endpoint := range GetAPIEndpoints(mr) {
+			logging.Debug(fmt.Sprintf("Mapping API %s route %s", endpoint.Method, endpoint.Route))
+			r.HandleFunc(endpoint.Route, mr.requireAPIPermission(endpoint.Permission, endpoint.Handle)).Methods(endpoint.Method)
+		}
+
 		ut := db.UsersTable{}
 		if !ut.RootUserExists() {
 			aunh := AdminUsersNewHandler{
@@ -197,19 +235,41 @@ func (mr *MutableRouter) Reload() {
 	mr.Swap(r)
 }
 
+//requirePermission wraps handler function so that only clients granted the permission get through to it
+func (mr *MutableRouter) requirePermission(permission db.Permission, next http.HandlerFunc) http.HandlerFunc {
+	if permission == db.PERM_NONE {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		amw := AuthMiddleware{Router: mr}
+		if !amw.HasPermission(r, permission) {
+			fourOhThree(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
 func (mr *MutableRouter) mapSavedPageRoutes(r *mux.Router) {
 	savedPageHandler := &SavedPageHandler{Router: mr}
 
 	pt := db.PagesTable{}
-	rows, err := pt.Select(db.Conn, "route", "")
-	defer rows.Close()
+	rows, err := db.From(&pt).Columns("route", "status", "publishdatetime", "unpublishdatetime").Query(db.Conn)
 	if err != nil {
 		logging.Error(err.Error())
 		return
 	}
+	defer rows.Close()
+	now := time.Now().Unix()
 	for rows.Next() {
 		p := db.Page{}
-		rows.Scan(&p.Route)
+		rows.Scan(&p.Route, &p.Status, &p.PublishDateTime, &p.UnpublishDateTime)
+		//drafts and pages scheduled for later get mapped by the page scheduler once they go live
+		if !p.IsLive(now) {
+			logging.Debug(fmt.Sprintf("Skipping unpublished database page route %s", p.Route))
+			continue
+		}
 		logging.Debug(fmt.Sprintf("Mapping database page route %s", p.Route))
 		r.HandleFunc(p.Route, savedPageHandler.Get).Methods("GET")
 		r.HandleFunc(p.Route, savedPageHandler.Post).Methods("POST")
@@ -331,9 +391,13 @@ type AuthMiddleware struct {
 func (amw *AuthMiddleware) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if amw.HasPermissionsForRoute(r) {
+			if amw.TwoFactorEnrolmentRequired(r) {
+				http.Redirect(w, r, amw.adminPrefix()+"/admin/twofactor", http.StatusFound)
+				return
+			}
 			next.ServeHTTP(w, r)
 		} else {
-			http.Error(w, "Access denied", http.StatusForbidden)
+			fourOhThree(w, r)
 		}
 	})
 }
@@ -342,13 +406,7 @@ func (amw *AuthMiddleware) Middleware(next http.Handler) http.Handler {
 func (amw *AuthMiddleware) HasPermissionsForRoute(r *http.Request) bool {
 	var routeIsProtected bool
 
-	var hiddenAdminPrefixURI = ""
-
-	if amw.Router.AdminHidden {
-		hiddenAdminPrefixURI = fmt.Sprintf("/%s", amw.Router.AdminHiddenPassword)
-	}
-
-	routeIsProtected = strings.HasPrefix(r.RequestURI, hiddenAdminPrefixURI+"/admin")
+	routeIsProtected = strings.HasPrefix(r.RequestURI, amw.adminPrefix()+"/admin")
 
 	if routeIsProtected && strings.Compare(r.RequestURI, "/admin/users/root/new") == 0 {
 		ut := db.UsersTable{}
@@ -365,7 +423,10 @@ func (amw *AuthMiddleware) HasPermissionsForRoute(r *http.Request) bool {
 		pt := db.PagesTable{}
 		page, err := pt.SelectByRoute(db.Conn, r.RequestURI)
 		if err == nil {
-			routeIsProtected = page.Roleprotected
+			if page.Roleprotected && !amw.IsLoggedIn(r) {
+				return false
+			}
+			return amw.HasPagePermission(r, page, db.PAGE_READ)
 		}
 	}
 
@@ -375,17 +436,143 @@ func (amw *AuthMiddleware) HasPermissionsForRoute(r *http.Request) bool {
 	return true
 }
 
+//TwoFactorEnrolmentRequired checks whether the client is logged in to the dashboard as a user who is in a group
+//requiring two factor authentication, but who hasn't enabled it yet
+func (amw *AuthMiddleware) TwoFactorEnrolmentRequired(r *http.Request) bool {
+	if !strings.HasPrefix(r.RequestURI, amw.adminPrefix()+"/admin") || strings.HasPrefix(r.RequestURI, amw.adminPrefix()+"/admin/twofactor") {
+		return false
+	}
+
+	//only web logins go through the second step, so tokens aren't held back by it
+	if amw.APITokenFromRequest(r) != nil || !amw.IsLoggedIn(r) {
+		return false
+	}
+
+	loggedInUser, err := amw.LoggedInUser(r)
+	if err != nil || loggedInUser == nil {
+		return false
+	}
+
+	ut := db.UsersTable{}
+	required, err := ut.TwoFactorRequired(db.Conn, loggedInUser)
+	if err != nil {
+		logging.Error(err.Error())
+		return false
+	}
+
+	if !required {
+		return false
+	}
+
+	utft := db.UserTwoFactorTable{}
+	enabled, err := utft.IsEnabled(db.Conn, loggedInUser.UUID)
+	if err != nil {
+		logging.Error(err.Error())
+		return false
+	}
+
+	return !enabled
+}
+
+func (amw *AuthMiddleware) adminPrefix() string {
+	if amw.Router != nil && amw.Router.AdminHidden {
+		return fmt.Sprintf("/%s", amw.Router.AdminHiddenPassword)
+	}
+	return ""
+}
+
+//HasPermission checks that requesting client is logged in as a user granted the permission by their role or groups
+func (amw *AuthMiddleware) HasPermission(r *http.Request, permission db.Permission) bool {
+	loggedInUser, err := amw.LoggedInUser(r)
+	if err != nil || loggedInUser == nil {
+		return false
+	}
+
+	//requests made with an API token are limited to what the token was scoped to, on top of what the user can do
+	if apiToken := amw.APITokenFromRequest(r); apiToken != nil && !apiToken.HasScope(permission) {
+		return false
+	}
+
+	ut := db.UsersTable{}
+	hasPermission, err := ut.HasPermission(db.Conn, loggedInUser, permission)
+	if err != nil {
+		logging.Error(err.Error())
+		return false
+	}
+
+	return hasPermission
+}
+
+//HasPagePermission checks that requesting client is in one of the groups granted the permission on the page
+func (amw *AuthMiddleware) HasPagePermission(r *http.Request, page *db.Page, permission db.PagePermission) bool {
+	var user *db.User
+	if amw.IsLoggedIn(r) {
+		loggedInUser, err := amw.LoggedInUser(r)
+		if err != nil {
+			logging.Error(err.Error())
+			return false
+		}
+		user = loggedInUser
+	}
+
+	pgpt := db.PageGroupPermissionsTable{}
+	hasPermission, err := pgpt.UserHasPermission(db.Conn, user, page.UUID, permission)
+	if err != nil {
+		logging.Error(err.Error())
+		return false
+	}
+
+	return hasPermission
+}
+
+//APITokenFromRequest get the unexpired API token the request was sent with as a bearer token, nil if there isn't one
+func (amw *AuthMiddleware) APITokenFromRequest(r *http.Request) *db.APIToken {
+	authHeader := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return nil
+	}
+
+	token := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
+	if len(token) == 0 {
+		return nil
+	}
+
+	att := db.APITokensTable{}
+	apiToken, err := att.SelectByTokenHash(db.Conn, util.HashToken(token))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logging.Error(err.Error())
+		}
+		return nil
+	}
+
+	if apiToken.IsExpired(time.Now().Unix()) {
+		return nil
+	}
+
+	return apiToken
+}
+
 //IsLoggedIn checks if the requesting client is currently logged in
 func (amw *AuthMiddleware) IsLoggedIn(r *http.Request) bool {
 	var isLoggedIn bool
 
+	if apiToken := amw.APITokenFromRequest(r); apiToken != nil {
+		att := db.APITokensTable{}
+		if err := att.UpdateLastUsed(db.Conn, apiToken, time.Now().Unix()); err != nil {
+			logging.Error(err.Error())
+		}
+		return true
+	}
+
 	authSessionStore, err := sessionsstore.Get(r, "auth")
 	if err == nil {
 		if authSessionUUID := authSessionStore.Values["sessionuuid"]; authSessionUUID != nil {
 			authSessionsTable := db.AuthSessionsTable{}
 			authSession, err := authSessionsTable.SelectBySessionUUID(db.Conn, authSessionUUID.(string))
 			if err == nil {
-				if len(authSession.UserUUID) > 0 {
+				//the session might have expired since the last time old sessions were cleared out
+				if len(authSession.UserUUID) > 0 && !sessionExpired(authSession, time.Now()) {
 					isLoggedIn = true
 					authSession.LastActiveDateTime = time.Now().Unix()
 					authSessionsTable.Update(db.Conn, authSession)
@@ -406,15 +593,40 @@ func (amw *AuthMiddleware) IsLoggedIn(r *http.Request) bool {
 	return isLoggedIn
 }
 
-//LoggedInUser get user of existing web session
+//CurrentSessionUUID get the UUID of the client's web session, blank if they haven't got one
+func (amw *AuthMiddleware) CurrentSessionUUID(r *http.Request) string {
+	authSessionStore, err := sessionsstore.Get(r, "auth")
+	if err != nil {
+		return ""
+	}
+
+	if sessionUUID, ok := authSessionStore.Values["sessionuuid"].(string); ok {
+		return sessionUUID
+	}
+	return ""
+}
+
+//LoggedInUser get user of existing web session, or of the API token the request was sent with
 func (amw *AuthMiddleware) LoggedInUser(r *http.Request) (*db.User, error) {
+	if apiToken := amw.APITokenFromRequest(r); apiToken != nil {
+		ut := db.UsersTable{}
+		tokenUser, err := ut.SelectByUUID(db.Conn, apiToken.UserUUID)
+		if err != nil {
+			return nil, err
+		}
+		if len(tokenUser.UUID) == 0 {
+			return nil, fmt.Errorf("API token %s belongs to a user which no longer exists", apiToken.UUID)
+		}
+		return tokenUser, nil
+	}
+
 	authSessionStore, err := sessionsstore.Get(r, "auth")
 	if err == nil {
 		authSessionsTable := db.AuthSessionsTable{}
 		if authSessionUUID := authSessionStore.Values["sessionuuid"]; authSessionUUID != nil {
 			authSession, err := authSessionsTable.SelectBySessionUUID(db.Conn, authSessionUUID.(string))
 			if err == nil {
-				if len(authSession.UserUUID) > 0 {
+				if len(authSession.UserUUID) > 0 && !sessionExpired(authSession, time.Now()) {
 					ut := db.UsersTable{}
 					loggedInUser, err := ut.SelectByUUID(db.Conn, authSession.UserUUID)
 					if err != nil {
@@ -433,7 +645,7 @@ func Error(w http.ResponseWriter, err error) {
 	logging.Error(err.Error())
 
 	pt := db.PagesTable{}
-	rows, err := pt.Select(db.Conn, "content", fmt.Sprintf("route = '%s'", "[500]"))
+	rows, err := db.From(&pt).Columns("content").Where(db.Equal("route", "[500]")).Query(db.Conn)
 
 	if err != nil {
 		//potential stack overflow, should change this
@@ -456,9 +668,10 @@ func Error(w http.ResponseWriter, err error) {
 	WriteHTMLAndStatus(w, RenderStr(ctx), http.StatusInternalServerError)
 }
 
-func renderFourOhFour() (*plush.Context, error) {
+//renderStatusPage loads the saved page for the given status route (e.g. "[404]") falling back to default content
+func renderStatusPage(statusRoute string, defaultContent string) (*plush.Context, error) {
 	pt := db.PagesTable{}
-	rows, err := pt.Select(db.Conn, "content", fmt.Sprintf("route = '%s'", "[404]"))
+	rows, err := db.From(&pt).Columns("content").Where(db.Equal("route", statusRoute)).Query(db.Conn)
 
 	if err != nil {
 		return nil, err
@@ -467,7 +680,7 @@ func renderFourOhFour() (*plush.Context, error) {
 	defer rows.Close()
 
 	p := &db.Page{}
-	p.Content = "<h1>404 page not found</h1>"
+	p.Content = defaultContent
 
 	for rows.Next() {
 		rows.Scan(&p.Content)
@@ -479,6 +692,14 @@ func renderFourOhFour() (*plush.Context, error) {
 	return ctx, nil
 }
 
+func renderFourOhFour() (*plush.Context, error) {
+	return renderStatusPage("[404]", "<h1>404 page not found</h1>")
+}
+
+func renderFourOhThree() (*plush.Context, error) {
+	return renderStatusPage("[403]", "<h1>403 access denied</h1>")
+}
+
 func fourOhFour(w http.ResponseWriter, r *http.Request) {
 	ctx, err := renderFourOhFour()
 	if err != nil {
@@ -488,6 +709,15 @@ func fourOhFour(w http.ResponseWriter, r *http.Request) {
 	WriteHTMLAndStatus(w, RenderStr(ctx), http.StatusNotFound)
 }
 
+func fourOhThree(w http.ResponseWriter, r *http.Request) {
+	ctx, err := renderFourOhThree()
+	if err != nil {
+		Error(w, err)
+		return
+	}
+	WriteHTMLAndStatus(w, RenderStr(ctx), http.StatusForbidden)
+}
+
 func WriteHTMLAndStatus(w http.ResponseWriter, error string, code int) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.Header().Set("X-Content-Type-Options", "nosniff")
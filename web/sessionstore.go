@@ -15,45 +15,163 @@
 package web
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"time"
 
 	"github.com/tacusci/logging"
 
 	"github.com/gorilla/sessions"
 	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/util"
 )
 
-var (
-	// need to change this to be random per db somehow
-	sessionStoreSecretKey = []byte("83fdjuif49f4fjdim93490cvk4gkirv349")
-	sessionsstore         = sessions.NewCookieStore(sessionStoreSecretKey)
-)
+//sessionsstore until ConfigureSessionStore is called, cookies are signed with throwaway keys which won't outlive the process
+var sessionsstore = newThrowawaySessionStore()
+
+func newThrowawaySessionStore() *sessions.CookieStore {
+	hashKey, err := util.GenerateKey(64)
+	if err != nil {
+		logging.ErrorAndExit(err.Error())
+	}
+	blockKey, err := util.GenerateKey(32)
+	if err != nil {
+		logging.ErrorAndExit(err.Error())
+	}
+	return newSessionStore([][]byte{hashKey, blockKey}, false)
+}
 
-func init() {
-	sessionsstore.Options = &sessions.Options{
+func newSessionStore(keyPairs [][]byte, secure bool) *sessions.CookieStore {
+	store := sessions.NewCookieStore(keyPairs...)
+	store.Options = &sessions.Options{
+		Path:     "/",
 		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	}
+	return store
+}
+
+//ConfigureSessionStore signs and encrypts cookies with the installation's keys from the database, cookies
+//are only sent over HTTPS if the server is serving it
+func ConfigureSessionStore(secure bool) error {
+	skt := db.SessionKeysTable{}
+	sessionKeys, err := skt.SelectAll(db.Conn)
+	if err != nil {
+		return err
+	}
+
+	if len(sessionKeys) == 0 {
+		return errors.New("No session keys found in the database")
+	}
+
+	//the newest pair signs new cookies, the rest only validate ones from before the last rotation
+	keyPairs := make([][]byte, 0, len(sessionKeys)*2)
+	for _, sessionKey := range sessionKeys {
+		hashKey, blockKey, err := sessionKey.Decode()
+		if err != nil {
+			return err
+		}
+		keyPairs = append(keyPairs, hashKey, blockKey)
+	}
+
+	sessionsstore = newSessionStore(keyPairs, secure)
+	return nil
+}
+
+const sessionReaperInterval = time.Second * 10
+
+//SessionTimeouts how long web sessions last
+type SessionTimeouts struct {
+	//Idle how long a session can go without any requests before it expires
+	Idle time.Duration
+	//MaxAge how long a session can last after logging in, however active it is
+	MaxAge time.Duration
+	//RememberMaxAge how long a "remember me" session lasts, they don't expire from being idle
+	RememberMaxAge time.Duration
+}
+
+//DefaultSessionTimeouts timeouts used unless configured otherwise
+var DefaultSessionTimeouts = sessionTimeoutsOf(db.DefaultSettings)
+
+//sessionTimeouts guarded by settingsMu as they're changed along with the rest of the settings
+var sessionTimeouts = DefaultSessionTimeouts
+
+//SetSessionTimeouts changes how long web sessions last, existing sessions are judged by the new timeouts too
+func SetSessionTimeouts(timeouts SessionTimeouts) error {
+	if timeouts.Idle <= 0 || timeouts.MaxAge <= 0 || timeouts.RememberMaxAge <= 0 {
+		return errors.New("Session timeouts must all be greater than zero")
+	}
+
+	if timeouts.Idle > timeouts.MaxAge {
+		return fmt.Errorf("Session idle timeout %s is longer than the maximum session age %s", timeouts.Idle, timeouts.MaxAge)
 	}
+
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	sessionTimeouts = timeouts
+	return nil
+}
+
+//currentSessionTimeouts the timeouts last set, safe to call while they're being changed
+func currentSessionTimeouts() SessionTimeouts {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return sessionTimeouts
+}
+
+//sessionExpired checks the session against the configured timeouts
+func sessionExpired(as *db.AuthSession, now time.Time) bool {
+	timeouts := currentSessionTimeouts()
+	return as.IsExpired(now.Unix(), int64(timeouts.Idle.Seconds()), int64(timeouts.MaxAge.Seconds()), int64(timeouts.RememberMaxAge.Seconds()))
 }
 
-//ClearOldSessions start checking every 10 seconds for existing sessions older than 20 minutes
-func ClearOldSessions(stop *chan bool) {
-	startTime := time.Now()
+//ClearOldSessions start checking every 10 seconds for expired sessions, API tokens, password resets and unverified registrations and stale login attempts, until the context is cancelled
+func ClearOldSessions(ctx context.Context) {
+	ticker := time.NewTicker(sessionReaperInterval)
+	defer ticker.Stop()
+
 	authSessionsTable := db.AuthSessionsTable{}
+	apiTokensTable := db.APITokensTable{}
+	passwordResetsTable := db.PasswordResetsTable{}
+	registrationsTable := db.RegistrationsTable{}
+	loginAttemptsTable := db.LoginAttemptsTable{}
 	for {
-		time.Sleep(5 * time.Millisecond)
 		select {
-		case <-*stop:
+		case <-ctx.Done():
 			return
-		default:
-			if time.Since(startTime).Seconds() > 10 {
-				err := authSessionsTable.Delete(db.Conn, fmt.Sprintf("lastactivedatetime + %d <= %d", 60*20, time.Now().Unix()))
+		case <-ticker.C:
+			now := time.Now()
+			timeouts := currentSessionTimeouts()
+
+			_, err := authSessionsTable.DeleteExpired(
+				db.Conn,
+				now.Unix(),
+				int64(timeouts.Idle.Seconds()),
+				int64(timeouts.MaxAge.Seconds()),
+				int64(timeouts.RememberMaxAge.Seconds()),
+			)
 
-				if err != nil {
-					logging.Error(err.Error())
-				}
+			if err != nil {
+				logging.Error(err.Error())
+			}
+
+			if _, err := apiTokensTable.DeleteExpired(db.Conn, now.Unix()); err != nil {
+				logging.Error(err.Error())
+			}
+
+			if _, err := passwordResetsTable.DeleteExpired(db.Conn, now.Unix()); err != nil {
+				logging.Error(err.Error())
+			}
+
+			if _, err := registrationsTable.DeleteExpired(db.Conn, now.Unix()); err != nil {
+				logging.Error(err.Error())
+			}
 
-				startTime = time.Now()
+			if _, err := loginAttemptsTable.DeleteOlderThan(db.Conn, now.Add(-loginAttemptWindow).Unix()); err != nil {
+				logging.Error(err.Error())
 			}
 		}
 	}
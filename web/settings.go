@@ -0,0 +1,66 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tacusci/berrycms/db"
+)
+
+var (
+	settingsMu      sync.RWMutex
+	currentSettings = db.DefaultSettings
+)
+
+//CurrentSettings the site settings the router was last reloaded with
+func CurrentSettings() db.Settings {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return currentSettings
+}
+
+func setCurrentSettings(s db.Settings) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	currentSettings = s
+}
+
+//sessionTimeoutsOf converts the settings' session timeouts from seconds
+func sessionTimeoutsOf(s db.Settings) SessionTimeouts {
+	return SessionTimeouts{
+		Idle:           time.Duration(s.SessionIdle) * time.Second,
+		MaxAge:         time.Duration(s.SessionMaxAge) * time.Second,
+		RememberMaxAge: time.Duration(s.RememberMaxAge) * time.Second,
+	}
+}
+
+//themeStylesheet route of the default theme's stylesheet
+func themeStylesheet() string {
+	return "/css/" + CurrentSettings().DefaultTheme + ".css"
+}
+
+//emailLinkBase scheme and host of links emailed to users, only ever the configured base URL as request headers
+//can be forged to send the links, and any tokens in them, to another site
+func emailLinkBase() (string, error) {
+	baseURL := CurrentSettings().BaseURL
+	if len(baseURL) == 0 {
+		return "", errors.New("Base URL needs to be set in the site settings before links can be emailed")
+	}
+	return strings.TrimSuffix(baseURL, "/"), nil
+}
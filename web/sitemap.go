@@ -3,7 +3,10 @@ package web
 import (
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 
+	"github.com/tacusci/berrycms/db"
 	"github.com/tacusci/berrycms/sitemap"
 	"github.com/tacusci/logging"
 )
@@ -15,16 +18,21 @@ type SitemapHandler struct {
 
 func (sh *SitemapHandler) Get(w http.ResponseWriter, r *http.Request) {
 	//if the sitemap.xml has been disabled, don't continue
-	if sh.Router.NoSitemap {
+	if !CurrentSettings().SitemapEnabled {
 		fourOhFour(w, r)
 		return
 	}
 
 	//if the sitemap.xml page hasn't been visited before cache won't have been generated
 	if !sitemap.CacheExists() {
-		logging.Debug(fmt.Sprintf("Sitemap.xml cache doesn't exist yet, creating it with URL hostname: %s", r.Host))
+		scheme, host := r.URL.Scheme, r.Host
+		//the configured base URL is the site's canonical address, whichever one the request came in on
+		if baseURL, err := url.Parse(CurrentSettings().BaseURL); err == nil && len(baseURL.Host) > 0 {
+			scheme, host = baseURL.Scheme, baseURL.Host+strings.TrimSuffix(baseURL.Path, "/")
+		}
+		logging.Debug(fmt.Sprintf("Sitemap.xml cache doesn't exist yet, creating it with URL hostname: %s", host))
 		//creates a sitemap string and loads into in-memory cache
-		err := sitemap.Generate(r.URL.Scheme, r.Host)
+		err := sitemap.Generate(scheme, host)
 		if err != nil {
 			logging.Error(err.Error())
 		}
@@ -43,3 +51,6 @@ func (rh *SitemapHandler) HandlesGet() bool { return true }
 
 //HandlesPost retrieve whether this handler handles post requests
 func (rh *SitemapHandler) HandlesPost() bool { return false }
+
+//Permission get the permission a client needs to be granted to use handler
+func (rh *SitemapHandler) Permission() db.Permission { return db.PERM_NONE }